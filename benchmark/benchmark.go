@@ -0,0 +1,445 @@
+// Package benchmark compares the framework implementations on the same workloads.
+// Cases run under `go test -bench . ./benchmark` or programmatically through Run,
+// which times them without the testing package and returns a machine readable Report.
+package benchmark
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vivekmv23/go-web-frameworks/database"
+	"github.com/vivekmv23/go-web-frameworks/lib"
+	"github.com/vivekmv23/go-web-frameworks/web"
+)
+
+const (
+	TRANSPORT_IN_PROCESS = "inprocess"
+	TRANSPORT_LOOPBACK   = "loopback"
+
+	SCENARIO_CRUD       = "crud"
+	SCENARIO_GET        = "get"
+	SCENARIO_LIST       = "list"
+	SCENARIO_ROUTING    = "routing"
+	SCENARIO_JSON       = "json"
+	SCENARIO_MIDDLEWARE = "middleware"
+
+	metricP50 = "p50-ns"
+	metricP99 = "p99-ns"
+
+	// maxIterations bounds a round, every call keeps its latency
+	maxIterations = 10_000_000
+
+	listSize    = 100
+	itemPayload = `{"name": "ItemName", "value": 1000, "description": "Item description", "isActive": true}`
+)
+
+var Transports = []string{TRANSPORT_IN_PROCESS, TRANSPORT_LOOPBACK}
+
+// Case is a single benchmark, op is measured once per iteration
+type Case struct {
+	Framework string
+	Scenario  string
+	Transport string
+	setup     func() (op func() error, teardown func())
+}
+
+func (c Case) Name() string {
+	parts := []string{c.Framework, c.Scenario}
+	if c.Transport != "" {
+		parts = append(parts, c.Transport)
+	}
+	return strings.Join(parts, "/")
+}
+
+// Budget is how long every case runs: for Duration, or for exactly Iterations calls when that is set
+type Budget struct {
+	Duration   time.Duration
+	Iterations int
+}
+
+// ParseBudget reads a run time like 500ms or an iteration count like 1000x, as go test -benchtime does
+func ParseBudget(s string) (Budget, error) {
+	if count, isCount := strings.CutSuffix(s, "x"); isCount {
+		n, err := strconv.Atoi(count)
+		if err != nil || n <= 0 {
+			return Budget{}, fmt.Errorf("invalid iteration count %q", s)
+		}
+		return Budget{Iterations: n}, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return Budget{}, fmt.Errorf("invalid run time %q", s)
+	}
+	return Budget{Duration: d}, nil
+}
+
+// round is one timed run of n calls
+type round struct {
+	latencies []time.Duration
+	elapsed   time.Duration
+	allocs    uint64
+	bytes     uint64
+}
+
+func runRound(op func() error, n int) (round, error) {
+	r := round{latencies: make([]time.Duration, n)}
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	start := time.Now()
+	for idx := range r.latencies {
+		opStart := time.Now()
+		if err := op(); err != nil {
+			return r, err
+		}
+		r.latencies[idx] = time.Since(opStart)
+	}
+	r.elapsed = time.Since(start)
+
+	runtime.ReadMemStats(&after)
+	r.allocs, r.bytes = after.Mallocs-before.Mallocs, after.TotalAlloc-before.TotalAlloc
+	return r, nil
+}
+
+// Measure runs the case within budget. Like testing.B it grows the rounds until one lasts the budget
+// and reports that round, with p50 and p99 latency next to the usual metrics.
+func (c Case) Measure(budget Budget) (Result, error) {
+	op, teardown := c.setup()
+	defer teardown()
+
+	n := max(budget.Iterations, 1)
+	for {
+		r, err := runRound(op, n)
+		if err != nil {
+			return Result{}, fmt.Errorf("%s: %w", c.Name(), err)
+		}
+		if budget.Iterations > 0 || r.elapsed >= budget.Duration || n >= maxIterations {
+			return c.result(r), nil
+		}
+
+		// aim 20% past the budget, growing at most a hundredfold per round
+		perOp := max(r.elapsed/time.Duration(n), 1)
+		next := min(int64(1.2*float64(budget.Duration)/float64(perOp)), 100*int64(n), maxIterations)
+		n = max(int(next), n+1)
+	}
+}
+
+func (c Case) result(r round) Result {
+	n := int64(len(r.latencies))
+	sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+
+	return Result{
+		Framework:   c.Framework,
+		Scenario:    c.Scenario,
+		Transport:   c.Transport,
+		Iterations:  len(r.latencies),
+		NsPerOp:     r.elapsed.Nanoseconds() / n,
+		AllocsPerOp: int64(r.allocs) / n,
+		BytesPerOp:  int64(r.bytes) / n,
+		P50Ns:       int64(percentile(r.latencies, 50)),
+		P99Ns:       int64(percentile(r.latencies, 99)),
+	}
+}
+
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[(len(sorted)-1)*p/100]
+}
+
+// Cases lists every benchmark for the given frameworks
+func Cases(frameworks []Framework) []Case {
+	var cases []Case
+
+	for _, f := range frameworks {
+		f := f
+		for _, t := range Transports {
+			t := t
+			cases = append(cases,
+				Case{f.Name, SCENARIO_CRUD, t, func() (func() error, func()) { return crudOp(f, t) }},
+				Case{f.Name, SCENARIO_GET, t, func() (func() error, func()) { return getOp(f, t) }},
+				Case{f.Name, SCENARIO_LIST, t, func() (func() error, func()) { return listOp(f, t) }},
+			)
+		}
+
+		cases = append(cases, Case{f.Name, SCENARIO_ROUTING, "", func() (func() error, func()) { return routingOp(f) }})
+
+		if f.Chain != nil {
+			cases = append(cases, Case{f.Name, SCENARIO_MIDDLEWARE, "", func() (func() error, func()) { return middlewareOp(f) }})
+		}
+	}
+
+	// encoding is shared by every framework through the web package
+	cases = append(cases, Case{"web", SCENARIO_JSON, "", jsonOp})
+
+	return cases
+}
+
+// client sends requests to a handler either directly or over a loopback TCP connection
+type client struct {
+	h      http.Handler
+	server *httptest.Server
+}
+
+func newClient(h http.Handler, transport string) *client {
+	c := &client{h: h}
+	if transport == TRANSPORT_LOOPBACK {
+		c.server = httptest.NewServer(h)
+	}
+	return c
+}
+
+func (c *client) close() {
+	if c.server != nil {
+		c.server.Close()
+	}
+}
+
+// do returns the status, headers and body of the response
+func (c *client) do(method, target, body string, headers map[string]string) (int, http.Header, []byte, error) {
+	var r *http.Request
+	var err error
+
+	if c.server == nil {
+		r = httptest.NewRequest(method, target, strings.NewReader(body))
+	} else {
+		r, err = http.NewRequest(method, c.server.URL+target, strings.NewReader(body))
+		if err != nil {
+			return 0, nil, nil, err
+		}
+	}
+
+	for k, v := range headers {
+		r.Header.Set(k, v)
+	}
+
+	if c.server == nil {
+		w := httptest.NewRecorder()
+		c.h.ServeHTTP(w, r)
+		return w.Code, w.Header(), w.Body.Bytes(), nil
+	}
+
+	res, err := c.server.Client().Do(r)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	defer res.Body.Close()
+
+	b, err := io.ReadAll(res.Body)
+	return res.StatusCode, res.Header, b, err
+}
+
+func expect(want, got int, target string, body []byte) error {
+	if want != got {
+		return fmt.Errorf("expected %d from %s, got %d: %s", want, target, got, body)
+	}
+	return nil
+}
+
+// crudOp creates, reads, lists, updates and deletes one item per iteration
+func crudOp(f Framework, transport string) (func() error, func()) {
+	c := newClient(f.NewHandler(database.NewMemoryDatabase()), transport)
+
+	op := func() error {
+		status, _, body, err := c.do(http.MethodPost, "/items", itemPayload, nil)
+		if err != nil {
+			return err
+		}
+		if err := expect(http.StatusCreated, status, "/items", body); err != nil {
+			return err
+		}
+
+		var created lib.Item
+		if err := json.Unmarshal(body, &created); err != nil {
+			return err
+		}
+		target := "/items/" + created.Id.String()
+
+		status, headers, body, err := c.do(http.MethodGet, target, "", nil)
+		if err != nil {
+			return err
+		}
+		if err := expect(http.StatusOK, status, target, body); err != nil {
+			return err
+		}
+
+		status, _, body, err = c.do(http.MethodGet, "/items", "", nil)
+		if err != nil {
+			return err
+		}
+		if err := expect(http.StatusOK, status, "/items", body); err != nil {
+			return err
+		}
+
+		status, _, body, err = c.do(http.MethodPut, target, itemPayload, map[string]string{"If-Match": headers.Get("Etag")})
+		if err != nil {
+			return err
+		}
+		if err := expect(http.StatusOK, status, target, body); err != nil {
+			return err
+		}
+
+		status, _, body, err = c.do(http.MethodDelete, target, "", nil)
+		if err != nil {
+			return err
+		}
+		return expect(http.StatusNoContent, status, target, body)
+	}
+
+	return op, c.close
+}
+
+func seeded(n int) (database.ItemDatabase, []lib.Item) {
+	d := database.NewMemoryDatabase()
+	items := make([]lib.Item, n)
+	for idx := range items {
+		items[idx] = lib.Item{Name: fmt.Sprintf("Item %d", idx), Value: idx, Description: "Seeded for benchmarks", Active: true}
+		d.SaveItem(&items[idx])
+	}
+	return d, items
+}
+
+func getOp(f Framework, transport string) (func() error, func()) {
+	d, items := seeded(1)
+	c := newClient(f.NewHandler(d), transport)
+	target := "/items/" + items[0].Id.String()
+
+	return func() error {
+		status, _, body, err := c.do(http.MethodGet, target, "", nil)
+		if err != nil {
+			return err
+		}
+		return expect(http.StatusOK, status, target, body)
+	}, c.close
+}
+
+func listOp(f Framework, transport string) (func() error, func()) {
+	d, _ := seeded(listSize)
+	c := newClient(f.NewHandler(d), transport)
+
+	return func() error {
+		status, _, body, err := c.do(http.MethodGet, "/items", "", nil)
+		if err != nil {
+			return err
+		}
+		return expect(http.StatusOK, status, "/items", body)
+	}, c.close
+}
+
+// routingOp matches a collection and an item path without running any handler
+func routingOp(f Framework) (func() error, func()) {
+	match := f.Router()
+	requests := []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/items", nil),
+		httptest.NewRequest(http.MethodGet, "/items/fe9dd883-7b95-4d7a-80d9-0c80423a8e16", nil),
+	}
+
+	return func() error {
+		for _, r := range requests {
+			if !match(r) {
+				return fmt.Errorf("%s was not routed", r.URL.Path)
+			}
+		}
+		return nil
+	}, func() {}
+}
+
+// middlewareOp runs the middleware chain around a handler that does nothing
+func middlewareOp(f Framework) (func() error, func()) {
+	h := f.Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/items", nil)
+
+	return func() error {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return expect(http.StatusNoContent, w.Code, "/items", w.Body.Bytes())
+	}, func() {}
+}
+
+// jsonOp encodes a list response the way every framework does through web.SuccessResponse
+func jsonOp() (func() error, func()) {
+	_, items := seeded(listSize)
+	r := httptest.NewRequest(http.MethodGet, "/items", nil)
+
+	return func() error {
+		w := httptest.NewRecorder()
+		web.SuccessResponse(http.StatusOK, w, r, items)
+		return expect(http.StatusOK, w.Code, "/items", nil)
+	}, func() {}
+}
+
+type Result struct {
+	Framework   string `json:"framework"`
+	Scenario    string `json:"scenario"`
+	Transport   string `json:"transport,omitempty"`
+	Iterations  int    `json:"iterations"`
+	NsPerOp     int64  `json:"nsPerOp"`
+	AllocsPerOp int64  `json:"allocsPerOp"`
+	BytesPerOp  int64  `json:"bytesPerOp"`
+	P50Ns       int64  `json:"p50Ns"`
+	P99Ns       int64  `json:"p99Ns"`
+}
+
+type Report struct {
+	StartedAt time.Time `json:"startedAt"`
+	GoVersion string    `json:"goVersion"`
+	GOOS      string    `json:"goos"`
+	GOARCH    string    `json:"goarch"`
+	CPUs      int       `json:"cpus"`
+	Results   []Result  `json:"results"`
+}
+
+// Run benchmarks every case whose name contains filter, request logging is discarded meanwhile
+func Run(cases []Case, filter string, budget Budget) (Report, error) {
+	report := Report{
+		StartedAt: time.Now(),
+		GoVersion: runtime.Version(),
+		GOOS:      runtime.GOOS,
+		GOARCH:    runtime.GOARCH,
+		CPUs:      runtime.NumCPU(),
+	}
+
+	out := log.Writer()
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(out)
+
+	for _, c := range cases {
+		if !strings.Contains(c.Name(), filter) {
+			continue
+		}
+
+		r, err := c.Measure(budget)
+		if err != nil {
+			return report, err
+		}
+		report.Results = append(report.Results, r)
+
+		fmt.Fprintf(out, "%-40s %10d %12d ns/op %8d allocs/op %10d p50-ns %10d p99-ns\n", c.Name(), r.Iterations, r.NsPerOp, r.AllocsPerOp, r.P50Ns, r.P99Ns)
+	}
+
+	return report, nil
+}
+
+func (r Report) JSON() ([]byte, error) {
+	var b bytes.Buffer
+	e := json.NewEncoder(&b)
+	e.SetIndent("", "  ")
+	err := e.Encode(r)
+	return b.Bytes(), err
+}
@@ -0,0 +1,102 @@
+package benchmark
+
+import (
+	"io"
+	"log"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func BenchmarkFrameworks(b *testing.B) {
+	out := log.Writer()
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(out)
+
+	for _, c := range Cases(Frameworks) {
+		b.Run(c.Name(), benchmarkCase(c))
+	}
+}
+
+// benchmarkCase reports p50 and p99 latency next to the usual metrics
+func benchmarkCase(c Case) func(b *testing.B) {
+	return func(b *testing.B) {
+		op, teardown := c.setup()
+		defer teardown()
+
+		latencies := make([]time.Duration, b.N)
+		b.ReportAllocs()
+		b.ResetTimer()
+
+		for n := 0; n < b.N; n++ {
+			start := time.Now()
+			if err := op(); err != nil {
+				b.Fatalf("%s: %s", c.Name(), err)
+			}
+			latencies[n] = time.Since(start)
+		}
+
+		b.StopTimer()
+
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		b.ReportMetric(float64(percentile(latencies, 50)), metricP50)
+		b.ReportMetric(float64(percentile(latencies, 99)), metricP99)
+	}
+}
+
+// Every case must succeed on its own before its numbers mean anything
+func TestCases(t *testing.T) {
+	out := log.Writer()
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(out)
+
+	for _, c := range Cases(Frameworks) {
+		t.Run(c.Name(), func(t *testing.T) {
+			op, teardown := c.setup()
+			defer teardown()
+
+			for n := 0; n < 3; n++ {
+				if err := op(); err != nil {
+					t.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestParseBudget(t *testing.T) {
+	b, err := ParseBudget("500ms")
+	require.NoError(t, err)
+	assert.Equal(t, Budget{Duration: 500 * time.Millisecond}, b)
+
+	b, err = ParseBudget("1000x")
+	require.NoError(t, err)
+	assert.Equal(t, Budget{Iterations: 1000}, b)
+
+	for _, invalid := range []string{"", "0x", "-1s", "often"} {
+		_, err = ParseBudget(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestMeasure(t *testing.T) {
+	var json Case
+	for _, c := range Cases(Frameworks) {
+		if c.Scenario == SCENARIO_JSON {
+			json = c
+		}
+	}
+
+	r, err := json.Measure(Budget{Iterations: 20})
+	require.NoError(t, err)
+	assert.Equal(t, 20, r.Iterations)
+	assert.Positive(t, r.AllocsPerOp)
+	assert.LessOrEqual(t, r.P50Ns, r.P99Ns)
+
+	r, err = json.Measure(Budget{Duration: 20 * time.Millisecond})
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Duration(r.Iterations*int(r.NsPerOp)), 20*time.Millisecond, "the reported round lasts the budget")
+}
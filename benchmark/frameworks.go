@@ -0,0 +1,77 @@
+package benchmark
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/vivekmv23/go-web-frameworks/config"
+	"github.com/vivekmv23/go-web-frameworks/database"
+	"github.com/vivekmv23/go-web-frameworks/web"
+	wfgorillamux "github.com/vivekmv23/go-web-frameworks/wf-gorilla-mux"
+	wfservemux "github.com/vivekmv23/go-web-frameworks/wf-servemux"
+	wfstandardlib "github.com/vivekmv23/go-web-frameworks/wf-standard-lib"
+)
+
+// Framework exposes the parts of an implementation the benchmarks measure separately
+type Framework struct {
+	Name       string
+	NewHandler func(d database.ItemDatabase) http.Handler
+	// Router returns a route matcher built once per benchmark, reporting whether r is routed
+	Router func() func(r *http.Request) bool
+	// Chain serves h on GET /items behind the standard middlewares, attached the way the framework
+	// attaches them, nil when it has no mechanism of its own
+	Chain func(h http.Handler) http.Handler
+}
+
+var Frameworks = []Framework{
+	{
+		Name: config.FRAMEWORK_STDLIB,
+		NewHandler: func(d database.ItemDatabase) http.Handler {
+			return wfstandardlib.NewStandardLibWebServer(d).Handler()
+		},
+		Router: func() func(r *http.Request) bool {
+			return func(r *http.Request) bool {
+				return wfstandardlib.RouteMethods(r.URL.Path) != nil
+			}
+		},
+	},
+	{
+		Name: config.FRAMEWORK_GORILLA,
+		NewHandler: func(d database.ItemDatabase) http.Handler {
+			return wfgorillamux.NewGorillaMuxWebServer(d).Handler()
+		},
+		Router: func() func(r *http.Request) bool {
+			router := wfgorillamux.NewGorillaMuxWebServer(database.NewMemoryDatabase()).Handler().(*mux.Router)
+			return func(r *http.Request) bool {
+				var match mux.RouteMatch
+				return router.Match(r, &match) && match.MatchErr == nil
+			}
+		},
+		Chain: func(h http.Handler) http.Handler {
+			router := mux.NewRouter()
+			itemsRouter := router.PathPrefix("/items").Subrouter()
+			itemsRouter.Use(web.LogRequestMiddleware, web.AuthenticationMiddleware, web.LogResponseMiddleware)
+			itemsRouter.Handle("", h).Methods(http.MethodGet)
+			return router
+		},
+	},
+	{
+		Name: config.FRAMEWORK_SERVEMUX,
+		NewHandler: func(d database.ItemDatabase) http.Handler {
+			return wfservemux.NewServeMuxWebServer(d).Handler()
+		},
+		Router: func() func(r *http.Request) bool {
+			router := wfservemux.NewServeMuxWebServer(database.NewMemoryDatabase()).Mux()
+			return func(r *http.Request) bool {
+				_, pattern := router.Handler(r)
+				return pattern != "/"
+			}
+		},
+		Chain: func(h http.Handler) http.Handler {
+			// every pattern is registered with its own chain
+			router := http.NewServeMux()
+			router.Handle("GET /items", web.Chain(h, web.LogRequestMiddleware, web.AuthenticationMiddleware, web.LogResponseMiddleware))
+			return router
+		},
+	},
+}
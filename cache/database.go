@@ -0,0 +1,192 @@
+// Package cache is a read-through cache for GetItemById in front of any ItemDatabase. Writes through
+// the cache evict the item they change, writes of other processes are seen once the cached item
+// expires, or right away when the cache follows the change events with InvalidateOn.
+package cache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vivekmv23/go-web-frameworks/config"
+	"github.com/vivekmv23/go-web-frameworks/database"
+	"github.com/vivekmv23/go-web-frameworks/events"
+	"github.com/vivekmv23/go-web-frameworks/lib"
+)
+
+// Stats counts reads by id since the cache was created. Misses that arrive while the same item is
+// already being read wait for that read, so Loads can be lower than Misses.
+type Stats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Loads     uint64 `json:"loads"`
+	Evictions uint64 `json:"evictions"`
+	Size      int    `json:"size"`
+}
+
+// load is a read of the store that concurrent misses of the same id wait for
+type load struct {
+	done chan struct{}
+	item lib.Item
+	err  error
+}
+
+// Should satisfy ItemDatabase interface, decorates another store with a cache of items by id
+type Database struct {
+	database.ItemDatabase
+	ttl time.Duration
+	now func() time.Time
+
+	mu    sync.Mutex
+	items *lru
+	loads map[uuid.UUID]*load
+	// generation changes with every invalidation, a load only fills the cache when none happened while it ran
+	generation uint64
+
+	hits, misses, loaded, evictions atomic.Uint64
+}
+
+func NewDatabase(d database.ItemDatabase, c config.CacheConfig) *Database {
+	return &Database{
+		ItemDatabase: d,
+		ttl:          time.Duration(c.TTL),
+		now:          time.Now,
+		items:        newLru(c.Size),
+		loads:        map[uuid.UUID]*load{},
+	}
+}
+
+func (d *Database) Unwrap() database.ItemDatabase {
+	return d.ItemDatabase
+}
+
+// GetItemById serves cached items, errors such as NotFound are never cached
+func (d *Database) GetItemById(id uuid.UUID) (lib.Item, error) {
+	d.mu.Lock()
+	if i, found := d.items.get(id, d.now()); found {
+		d.mu.Unlock()
+		d.hits.Add(1)
+		return i, nil
+	}
+	d.misses.Add(1)
+
+	l, loading := d.loads[id]
+	if loading {
+		d.mu.Unlock()
+		<-l.done
+		return l.item, l.err
+	}
+
+	l = &load{done: make(chan struct{})}
+	d.loads[id] = l
+	generation := d.generation
+	d.mu.Unlock()
+
+	d.load(id, l, generation)
+	return l.item, l.err
+}
+
+func (d *Database) load(id uuid.UUID, l *load, generation uint64) {
+	defer close(l.done)
+	d.loaded.Add(1)
+
+	l.item, l.err = d.ItemDatabase.GetItemById(id)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.loads[id] == l {
+		delete(d.loads, id)
+	}
+	if l.err == nil && d.generation == generation && d.items.put(id, l.item, d.now().Add(d.ttl)) {
+		d.evictions.Add(1)
+	}
+}
+
+func (d *Database) SaveItem(i *lib.Item) error {
+	err := d.ItemDatabase.SaveItem(i)
+	d.Invalidate(i.Id)
+	return err
+}
+
+// UpdateItem evicts the item even when the update fails, a conflict means the cached item is outdated
+func (d *Database) UpdateItem(i lib.Item, ifMatch string) (lib.Item, error) {
+	updated, err := d.ItemDatabase.UpdateItem(i, ifMatch)
+	d.Invalidate(i.Id)
+	return updated, err
+}
+
+func (d *Database) DeleteItemById(id uuid.UUID) error {
+	err := d.ItemDatabase.DeleteItemById(id)
+	d.Invalidate(id)
+	return err
+}
+
+// Invalidate evicts an item, a read of it that is under way is neither cached nor joined by later reads
+func (d *Database) Invalidate(id uuid.UUID) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.items.remove(id)
+	delete(d.loads, id)
+	d.generation++
+}
+
+// Purge evicts every item
+func (d *Database) Purge() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.items.purge()
+	d.loads = map[uuid.UUID]*load{}
+	d.generation++
+}
+
+func (d *Database) Stats() Stats {
+	d.mu.Lock()
+	size := d.items.len()
+	d.mu.Unlock()
+
+	return Stats{
+		Hits:      d.hits.Load(),
+		Misses:    d.misses.Load(),
+		Loads:     d.loaded.Load(),
+		Evictions: d.evictions.Load(),
+		Size:      size,
+	}
+}
+
+// InvalidateOn evicts the items of the change events on b until ctx ends. When the subscription is
+// dropped for falling behind, events were missed and the whole cache is purged.
+func (d *Database) InvalidateOn(ctx context.Context, b *events.Bus) {
+	for {
+		s := b.Subscribe("")
+		if !d.follow(ctx, s) {
+			return
+		}
+		d.Purge()
+	}
+}
+
+// follow invalidates on the events of s, it returns false when ctx ended and true when s was dropped
+func (d *Database) follow(ctx context.Context, s *events.Subscription) bool {
+	defer s.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case e, open := <-s.C:
+			if !open {
+				return true
+			}
+			if e.Type == events.RESET {
+				d.Purge()
+			} else {
+				d.Invalidate(e.Item.Id)
+			}
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vivekmv23/go-web-frameworks/config"
+	"github.com/vivekmv23/go-web-frameworks/database"
+	"github.com/vivekmv23/go-web-frameworks/events"
+	"github.com/vivekmv23/go-web-frameworks/lib"
+)
+
+// blockingStore holds every read by id until release is closed, when it is set
+type blockingStore struct {
+	database.ItemDatabase
+	release chan struct{}
+	started chan struct{}
+}
+
+func (s *blockingStore) GetItemById(id uuid.UUID) (lib.Item, error) {
+	if s.release != nil {
+		s.started <- struct{}{}
+		<-s.release
+	}
+	return s.ItemDatabase.GetItemById(id)
+}
+
+func newTestCache(t *testing.T, size int) (*Database, *blockingStore, *time.Time) {
+	store := &blockingStore{ItemDatabase: database.NewMemoryDatabase()}
+	now := time.Date(2024, 9, 1, 10, 0, 0, 0, time.UTC)
+
+	d := NewDatabase(store, config.CacheConfig{Size: size, TTL: config.Duration(time.Minute)})
+	d.now = func() time.Time { return now }
+	return d, store, &now
+}
+
+func save(t *testing.T, d database.ItemDatabase, name string) lib.Item {
+	i := lib.Item{Name: name}
+	require.NoError(t, d.SaveItem(&i))
+	return i
+}
+
+func TestHitsAndMisses(t *testing.T) {
+	d, _, _ := newTestCache(t, 10)
+	i := save(t, d, "a")
+
+	for range 3 {
+		found, err := d.GetItemById(i.Id)
+		require.NoError(t, err)
+		assert.Equal(t, "a", found.Name)
+	}
+
+	_, err := d.GetItemById(uuid.New())
+	assert.IsType(t, &database.NotFound{}, err)
+	_, err = d.GetItemById(uuid.New())
+	assert.IsType(t, &database.NotFound{}, err)
+
+	assert.Equal(t, Stats{Hits: 2, Misses: 3, Loads: 3, Size: 1}, d.Stats(), "errors are not cached")
+}
+
+func TestTTL(t *testing.T) {
+	d, _, now := newTestCache(t, 10)
+	i := save(t, d, "a")
+
+	d.GetItemById(i.Id)
+	*now = now.Add(59 * time.Second)
+	d.GetItemById(i.Id)
+	*now = now.Add(time.Second)
+	d.GetItemById(i.Id)
+
+	assert.Equal(t, uint64(1), d.Stats().Hits)
+	assert.Equal(t, uint64(2), d.Stats().Loads, "expired items are read again")
+}
+
+func TestLeastRecentlyUsedIsEvicted(t *testing.T) {
+	d, _, _ := newTestCache(t, 2)
+	a, b, c := save(t, d, "a"), save(t, d, "b"), save(t, d, "c")
+
+	d.GetItemById(a.Id)
+	d.GetItemById(b.Id)
+	d.GetItemById(a.Id)
+	d.GetItemById(c.Id)
+
+	s := d.Stats()
+	assert.Equal(t, uint64(1), s.Evictions)
+	assert.Equal(t, 2, s.Size)
+
+	d.GetItemById(a.Id)
+	d.GetItemById(b.Id)
+	assert.Equal(t, s.Hits+1, d.Stats().Hits, "a was used more recently than b")
+}
+
+func TestWritesInvalidate(t *testing.T) {
+	d, _, _ := newTestCache(t, 10)
+	i := save(t, d, "a")
+	d.GetItemById(i.Id)
+
+	i.Name = "b"
+	_, err := d.UpdateItem(i, i.UpdatedOn.String())
+	require.NoError(t, err)
+	found, err := d.GetItemById(i.Id)
+	require.NoError(t, err)
+	assert.Equal(t, "b", found.Name)
+
+	require.NoError(t, d.DeleteItemById(i.Id))
+	_, err = d.GetItemById(i.Id)
+	assert.IsType(t, &database.NotFound{}, err)
+}
+
+func TestConcurrentMissesShareOneLoad(t *testing.T) {
+	d, store, _ := newTestCache(t, 10)
+	i := save(t, d, "a")
+	store.release, store.started = make(chan struct{}), make(chan struct{}, 10)
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			found, err := d.GetItemById(i.Id)
+			assert.NoError(t, err)
+			assert.Equal(t, "a", found.Name)
+		}()
+	}
+
+	<-store.started
+	assert.Eventually(t, func() bool { return d.Stats().Misses == 10 }, time.Second, time.Millisecond)
+	close(store.release)
+	wg.Wait()
+
+	assert.Equal(t, uint64(1), d.Stats().Loads)
+}
+
+func TestInvalidationDuringLoad(t *testing.T) {
+	d, store, _ := newTestCache(t, 10)
+	i := save(t, d, "a")
+	store.release, store.started = make(chan struct{}), make(chan struct{}, 10)
+
+	done := make(chan struct{})
+	go func() {
+		d.GetItemById(i.Id)
+		close(done)
+	}()
+
+	<-store.started
+	d.Invalidate(i.Id)
+	close(store.release)
+	<-done
+
+	assert.Equal(t, 0, d.Stats().Size, "a read that started before the invalidation may be outdated")
+}
+
+func TestInvalidateOnEvents(t *testing.T) {
+	d, _, _ := newTestCache(t, 10)
+	i := save(t, d, "a")
+	d.GetItemById(i.Id)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bus := events.NewBus(10)
+	go d.InvalidateOn(ctx, bus)
+
+	assert.Eventually(t, func() bool {
+		// a write of another process, the cache only learns about it from its event
+		bus.Publish(events.ITEM_UPDATED, i)
+		return d.Stats().Size == 0
+	}, time.Second, time.Millisecond)
+}
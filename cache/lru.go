@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"container/list"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vivekmv23/go-web-frameworks/lib"
+)
+
+type entry struct {
+	id      uuid.UUID
+	item    lib.Item
+	expires time.Time
+}
+
+// lru holds at most size items, the front of ll is the most recently used one. It is not safe for
+// concurrent use.
+type lru struct {
+	size int
+	ll   *list.List
+	byId map[uuid.UUID]*list.Element
+}
+
+func newLru(size int) *lru {
+	return &lru{size: size, ll: list.New(), byId: map[uuid.UUID]*list.Element{}}
+}
+
+// get finds an item that has not expired at now and marks it as used
+func (c *lru) get(id uuid.UUID, now time.Time) (lib.Item, bool) {
+	e, found := c.byId[id]
+	if !found {
+		return lib.Item{}, false
+	}
+
+	if en := e.Value.(*entry); now.Before(en.expires) {
+		c.ll.MoveToFront(e)
+		return en.item, true
+	}
+
+	c.remove(id)
+	return lib.Item{}, false
+}
+
+// put adds or replaces an item and reports whether the least recently used one made room for it
+func (c *lru) put(id uuid.UUID, i lib.Item, expires time.Time) (evicted bool) {
+	if e, found := c.byId[id]; found {
+		e.Value = &entry{id: id, item: i, expires: expires}
+		c.ll.MoveToFront(e)
+		return false
+	}
+
+	c.byId[id] = c.ll.PushFront(&entry{id: id, item: i, expires: expires})
+	if c.ll.Len() <= c.size {
+		return false
+	}
+
+	oldest := c.ll.Back()
+	c.ll.Remove(oldest)
+	delete(c.byId, oldest.Value.(*entry).id)
+	return true
+}
+
+func (c *lru) remove(id uuid.UUID) {
+	if e, found := c.byId[id]; found {
+		c.ll.Remove(e)
+		delete(c.byId, id)
+	}
+}
+
+func (c *lru) purge() {
+	c.ll.Init()
+	c.byId = map[uuid.UUID]*list.Element{}
+}
+
+func (c *lru) len() int {
+	return c.ll.Len()
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/vivekmv23/go-web-frameworks/benchmark"
+	"github.com/vivekmv23/go-web-frameworks/config"
+	"github.com/vivekmv23/go-web-frameworks/database"
+	"github.com/vivekmv23/go-web-frameworks/database/migrations"
+	"github.com/vivekmv23/go-web-frameworks/fixtures"
+	"github.com/vivekmv23/go-web-frameworks/lib"
+	"github.com/vivekmv23/go-web-frameworks/web"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func serveCommand(name string, args []string) error {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	cf := config.RegisterFlags(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	c, err := cf.Resolve(os.LookupEnv)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Effective config: %s", c)
+
+	web.ConfigureAuth(c.Auth)
+
+	ctx := context.Background()
+	store, err := NewItemDatabase(c)
+	if err != nil {
+		return err
+	}
+	defer CloseItemDatabase(store)
+
+	if err := EnsureIndexes(ctx, c, store); err != nil {
+		return err
+	}
+
+	faulty, err := NewFaultyDatabase(c, store)
+	if err != nil {
+		return err
+	}
+
+	relay, err := NewOutboxRelay(c, store)
+	if err != nil {
+		return err
+	}
+	if relay != nil {
+		go relay.Run(ctx)
+	}
+
+	d := NewEventsDatabase(ctx, c, NewCacheDatabase(c, NewResilientDatabase(c, faulty)))
+
+	h, err := NewWebhooksHandler(ctx, c, d, NewWebServer(c, d).Handler())
+	if err != nil {
+		return err
+	}
+	h = NewCacheHandler(ctx, c, d, h)
+
+	rec, err := NewRecorder(c)
+	if err != nil {
+		return err
+	}
+	if rec != nil {
+		defer rec.Close()
+	}
+
+	web.Serve(c.Framework, web.Chain(h, NewServerMiddlewares(c, rec)...), c.Server)
+
+	return nil
+}
+
+func seedCommand(name string, args []string) error {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	cf := config.RegisterFlags(fs)
+	count := fs.Int("count", 10, "number of items to generate")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	c, err := cf.Resolve(os.LookupEnv)
+	if err != nil {
+		return err
+	}
+
+	d, err := NewItemDatabase(c)
+	if err != nil {
+		return err
+	}
+	defer CloseItemDatabase(d)
+
+	for n := 1; n <= *count; n++ {
+		i := lib.Item{
+			Name:        fmt.Sprintf("Item %d", n),
+			Value:       rand.Intn(10000),
+			Description: fmt.Sprintf("Seeded item number %d", n),
+			Active:      rand.Intn(2) == 0,
+		}
+		if err := d.SaveItem(&i); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Seeded %d items into %s store", *count, c.Store.Backend)
+
+	return nil
+}
+
+func exportCommand(name string, args []string) error {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	cf := config.RegisterFlags(fs)
+	out := fs.String("out", "-", "file to write to, - for stdout")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	c, err := cf.Resolve(os.LookupEnv)
+	if err != nil {
+		return err
+	}
+
+	d, err := NewItemDatabase(c)
+	if err != nil {
+		return err
+	}
+	defer CloseItemDatabase(d)
+
+	items, err := d.GetAllItems()
+	if err != nil {
+		return err
+	}
+
+	w := io.Writer(os.Stdout)
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	if err := e.Encode(items); err != nil {
+		return err
+	}
+
+	log.Printf("Exported %d items from %s store", len(items), c.Store.Backend)
+
+	return nil
+}
+
+func importCommand(name string, args []string) error {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	cf := config.RegisterFlags(fs)
+	in := fs.String("in", "-", "file to read from, - for stdin")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	c, err := cf.Resolve(os.LookupEnv)
+	if err != nil {
+		return err
+	}
+
+	r := io.Reader(os.Stdin)
+	if *in != "-" {
+		f, err := os.Open(*in)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var items []lib.Item
+	if err := json.NewDecoder(r).Decode(&items); err != nil {
+		return fmt.Errorf("failed to read items: %s", err)
+	}
+
+	d, err := NewItemDatabase(c)
+	if err != nil {
+		return err
+	}
+	defer CloseItemDatabase(d)
+
+	imported, skipped := 0, 0
+
+	for idx := range items {
+		err := d.SaveItem(&items[idx])
+
+		var conflict *database.Conflict
+		if errors.As(err, &conflict) {
+			log.Printf("Skipping item with id %s: %s", items[idx].Id, err)
+			skipped++
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+		imported++
+	}
+
+	log.Printf("Imported %d items into %s store, skipped %d existing", imported, c.Store.Backend, skipped)
+
+	return nil
+}
+
+func indexesCommand(name string, args []string) error {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	cf := config.RegisterFlags(fs)
+	check := fs.Bool("check", false, "only report missing and drifted indexes, fail when there are any")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	c, err := cf.Resolve(os.LookupEnv)
+	if err != nil {
+		return err
+	}
+
+	d, err := NewItemDatabase(c)
+	if err != nil {
+		return err
+	}
+	defer CloseItemDatabase(d)
+
+	md, isMongo := database.Unwrap(d).(*database.Database)
+	if !isMongo {
+		return fmt.Errorf("the %s store has no indexes to manage", c.Store.Backend)
+	}
+
+	var reports []database.IndexReport
+	if *check {
+		reports, err = md.CheckIndexes(context.Background())
+	} else {
+		reports, err = md.EnsureIndexes(context.Background())
+	}
+
+	inSync := true
+	for _, r := range reports {
+		fmt.Println(r)
+		inSync = inSync && r.InSync()
+	}
+
+	if err == nil && !inSync {
+		err = errors.New("indexes differ from their definitions")
+	}
+	return err
+}
+
+func migrateCommand(name string, args []string) error {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	cf := config.RegisterFlags(fs)
+	status := fs.Bool("status", false, "list the migrations and when they were applied")
+	down := fs.Bool("down", false, "roll back the migrations above -to instead of applying")
+	to := fs.Int("to", migrations.LATEST, "version to migrate to, the latest when up and 0 when down by default")
+	dryRun := fs.Bool("dry-run", false, "only print the migrations that would run")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	c, err := cf.Resolve(os.LookupEnv)
+	if err != nil {
+		return err
+	}
+	if c.Store.Backend != config.STORE_MONGO {
+		return fmt.Errorf("the %s store has no migrations, items are stored as lib.Item is", c.Store.Backend)
+	}
+
+	ctx := context.Background()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(c.Store.Mongo.URL))
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(ctx)
+
+	m, err := migrations.New(client.Database(c.Store.Mongo.Database).Collection(c.Store.Mongo.Collection), migrations.Items)
+	if err != nil {
+		return err
+	}
+
+	if *status {
+		all, err := m.Status(ctx)
+		for _, s := range all {
+			switch {
+			case s.Unknown:
+				fmt.Printf("%d: %s, applied %s, unknown to this build\n", s.Version, s.Description, s.AppliedOn.Format(time.RFC3339))
+			case s.AppliedOn.IsZero():
+				fmt.Printf("%d: %s, pending\n", s.Version, s.Description)
+			default:
+				fmt.Printf("%d: %s, applied %s\n", s.Version, s.Description, s.AppliedOn.Format(time.RFC3339))
+			}
+		}
+		return err
+	}
+
+	var steps []migrations.Step
+	if *down {
+		steps, err = m.Down(ctx, max(*to, 0), *dryRun)
+	} else {
+		steps, err = m.Up(ctx, *to, *dryRun)
+	}
+
+	for _, s := range steps {
+		if *dryRun {
+			fmt.Printf("would run %s\n", s)
+		} else {
+			fmt.Printf("ran %s\n", s)
+		}
+	}
+	if err == nil && len(steps) == 0 {
+		log.Print("Nothing to migrate")
+	}
+	return err
+}
+
+func replayCommand(name string, args []string) error {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	cf := config.RegisterFlags(fs)
+	in := fs.String("in", "", "JSON lines file of recorded requests, e.g. from serve -record")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	c, err := cf.Resolve(os.LookupEnv)
+	if err != nil {
+		return err
+	}
+	if *in == "" {
+		return errors.New("-in is required")
+	}
+
+	exchanges, err := fixtures.Load(*in)
+	if err != nil {
+		return err
+	}
+
+	web.ConfigureAuth(c.Auth)
+
+	// a replay always starts from an empty memory store, so that it is repeatable and leaves real data alone
+	d := database.NewMemoryDatabase()
+	h := web.Chain(NewWebServer(c, d).Handler(), NewServerMiddlewares(c, nil)...)
+
+	diffs := fixtures.Replay(h, exchanges)
+	for _, diff := range diffs {
+		fmt.Println(diff)
+	}
+
+	log.Printf("Replayed %d requests against %s, %d differences", len(exchanges), c.Framework, len(diffs))
+	if len(diffs) > 0 {
+		return fmt.Errorf("the responses differ from the recording in %d places", len(diffs))
+	}
+	return nil
+}
+
+func benchCommand(name string, args []string) error {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	out := fs.String("out", "-", "file to write the JSON report to, - for stdout")
+	filter := fs.String("filter", "", "only run cases whose name contains this, e.g. gorilla/crud")
+	benchtime := fs.String("benchtime", "1s", "run time or iteration count of each case, e.g. 500ms or 1000x")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	budget, err := benchmark.ParseBudget(*benchtime)
+	if err != nil {
+		return err
+	}
+
+	report, err := benchmark.Run(benchmark.Cases(benchmark.Frameworks), *filter, budget)
+	if err != nil {
+		return err
+	}
+
+	b, err := report.JSON()
+	if err != nil {
+		return err
+	}
+
+	if *out == "-" {
+		_, err = os.Stdout.Write(b)
+		return err
+	}
+
+	return os.WriteFile(*out, b, 0o644)
+}
@@ -0,0 +1,572 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	FRAMEWORK_STDLIB   = "stdlib"
+	FRAMEWORK_GORILLA  = "gorilla"
+	FRAMEWORK_SERVEMUX = "servemux"
+
+	STORE_MONGO  = "mongo"
+	STORE_MEMORY = "memory"
+	STORE_SQLITE = "sqlite"
+	STORE_FILE   = "file"
+
+	FSYNC_ALWAYS   = "always"
+	FSYNC_INTERVAL = "interval"
+	FSYNC_NEVER    = "never"
+
+	AUTH_STUB   = "stub"
+	AUTH_APIKEY = "apikey"
+	AUTH_NONE   = "none"
+
+	RATE_LIMIT_BY_PRINCIPAL = "principal"
+	RATE_LIMIT_BY_IP        = "ip"
+
+	EVENTS_FROM_STORE = "store"
+	EVENTS_FROM_MONGO = "mongo"
+
+	OUTBOX_SINK_LOG     = "log"
+	OUTBOX_SINK_FILE    = "file"
+	OUTBOX_SINK_WEBHOOK = "webhook"
+
+	redacted = "REDACTED"
+)
+
+var (
+	Frameworks    = []string{FRAMEWORK_STDLIB, FRAMEWORK_GORILLA, FRAMEWORK_SERVEMUX}
+	Stores        = []string{STORE_MONGO, STORE_MEMORY, STORE_SQLITE, STORE_FILE}
+	AuthModes     = []string{AUTH_STUB, AUTH_APIKEY, AUTH_NONE}
+	RateLimitKeys = []string{RATE_LIMIT_BY_PRINCIPAL, RATE_LIMIT_BY_IP}
+	EventSources  = []string{EVENTS_FROM_STORE, EVENTS_FROM_MONGO}
+	OutboxSinks   = []string{OUTBOX_SINK_LOG, OUTBOX_SINK_FILE, OUTBOX_SINK_WEBHOOK}
+	FsyncPolicies = []string{FSYNC_ALWAYS, FSYNC_INTERVAL, FSYNC_NEVER}
+)
+
+// Config is the effective configuration of the application, assembled by Load
+// from defaults, an optional config file, environment variables and flags.
+type Config struct {
+	Framework   string            `json:"framework" yaml:"framework"`
+	Server      ServerConfig      `json:"server" yaml:"server"`
+	Auth        AuthConfig        `json:"auth" yaml:"auth"`
+	RateLimit   RateLimitConfig   `json:"rateLimit" yaml:"rateLimit"`
+	CORS        CORSConfig        `json:"cors" yaml:"cors"`
+	Compression CompressionConfig `json:"compression" yaml:"compression"`
+	Events      EventsConfig      `json:"events" yaml:"events"`
+	Webhooks    WebhooksConfig    `json:"webhooks" yaml:"webhooks"`
+	Outbox      OutboxConfig      `json:"outbox" yaml:"outbox"`
+	Cache       CacheConfig       `json:"cache" yaml:"cache"`
+	Resilience  ResilienceConfig  `json:"resilience" yaml:"resilience"`
+	Store       StoreConfig       `json:"store" yaml:"store"`
+}
+
+type ServerConfig struct {
+	Addr            string    `json:"addr" yaml:"addr"`
+	TLS             TLSConfig `json:"tls" yaml:"tls"`
+	ReadTimeout     Duration  `json:"readTimeout" yaml:"readTimeout"`
+	WriteTimeout    Duration  `json:"writeTimeout" yaml:"writeTimeout"`
+	IdleTimeout     Duration  `json:"idleTimeout" yaml:"idleTimeout"`
+	ShutdownTimeout Duration  `json:"shutdownTimeout" yaml:"shutdownTimeout"`
+	// Record is a JSON lines file every request is appended to with its response, for replay
+	Record string `json:"record" yaml:"record"`
+}
+
+type TLSConfig struct {
+	Enabled  bool   `json:"enabled" yaml:"enabled"`
+	CertFile string `json:"certFile" yaml:"certFile"`
+	KeyFile  string `json:"keyFile" yaml:"keyFile"`
+}
+
+type AuthConfig struct {
+	Mode    string   `json:"mode" yaml:"mode"`
+	Header  string   `json:"header" yaml:"header"`
+	APIKeys []string `json:"apiKeys" yaml:"apiKeys"`
+}
+
+// RateLimitConfig sets token bucket quotas, reads are GET, HEAD and OPTIONS requests
+type RateLimitConfig struct {
+	Enabled bool        `json:"enabled" yaml:"enabled"`
+	KeyBy   string      `json:"keyBy" yaml:"keyBy"`
+	Read    QuotaConfig `json:"read" yaml:"read"`
+	Write   QuotaConfig `json:"write" yaml:"write"`
+}
+
+type QuotaConfig struct {
+	// Rate is the number of requests per second refilled into the bucket
+	Rate  float64 `json:"rate" yaml:"rate"`
+	Burst int     `json:"burst" yaml:"burst"`
+}
+
+// CORSConfig lets browser clients on other origins call the API, an origin may be "*" or contain one "*" wildcard
+type CORSConfig struct {
+	Enabled          bool     `json:"enabled" yaml:"enabled"`
+	AllowedOrigins   []string `json:"allowedOrigins" yaml:"allowedOrigins"`
+	AllowedMethods   []string `json:"allowedMethods" yaml:"allowedMethods"`
+	AllowedHeaders   []string `json:"allowedHeaders" yaml:"allowedHeaders"`
+	ExposedHeaders   []string `json:"exposedHeaders" yaml:"exposedHeaders"`
+	AllowCredentials bool     `json:"allowCredentials" yaml:"allowCredentials"`
+	MaxAge           Duration `json:"maxAge" yaml:"maxAge"`
+}
+
+type CompressionConfig struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+	// MinSize is the smallest response body in bytes that gets compressed
+	MinSize int `json:"minSize" yaml:"minSize"`
+	// Level is a compress/flate level, -1 for the default
+	Level int `json:"level" yaml:"level"`
+}
+
+// EventsConfig enables the item change feed, store publishes the writes of this process while
+// mongo follows a change stream and also sees writes of other processes
+type EventsConfig struct {
+	Enabled bool   `json:"enabled" yaml:"enabled"`
+	Source  string `json:"source" yaml:"source"`
+	// Backlog is the number of events kept for clients that reconnect
+	Backlog int `json:"backlog" yaml:"backlog"`
+}
+
+// WebhooksConfig enables outbound webhooks, which are fed by the item change feed
+type WebhooksConfig struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+	// MaxAttempts is the number of attempts before a delivery is dead-lettered
+	MaxAttempts int `json:"maxAttempts" yaml:"maxAttempts"`
+	// Backoff is the wait after the first failed attempt, it doubles after every further one up to MaxBackoff
+	Backoff    Duration `json:"backoff" yaml:"backoff"`
+	MaxBackoff Duration `json:"maxBackoff" yaml:"maxBackoff"`
+	Timeout    Duration `json:"timeout" yaml:"timeout"`
+	// AllowedNetworks are the CIDRs of internal receivers, any other private, loopback or link-local
+	// address is refused when delivering
+	AllowedNetworks []string `json:"allowedNetworks" yaml:"allowedNetworks"`
+}
+
+// OutboxConfig makes item writes record their change in an outbox within the same transaction,
+// a relay publishes the records to the sinks at least once
+type OutboxConfig struct {
+	Enabled    bool     `json:"enabled" yaml:"enabled"`
+	Collection string   `json:"collection" yaml:"collection"`
+	Interval   Duration `json:"interval" yaml:"interval"`
+	Sinks      []string `json:"sinks" yaml:"sinks"`
+	// File is the JSON lines file of the file sink
+	File    string              `json:"file" yaml:"file"`
+	Webhook OutboxWebhookConfig `json:"webhook" yaml:"webhook"`
+}
+
+type OutboxWebhookConfig struct {
+	URL string `json:"url" yaml:"url"`
+	// Secret signs the requests like webhook deliveries when set
+	Secret string `json:"secret" yaml:"secret"`
+}
+
+// CacheConfig keeps recently read items in memory, writes through this process evict them right away
+// while writes of other processes are only seen after TTL, or on their change event with Events
+type CacheConfig struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+	// Size is the number of items kept, the least recently read ones are evicted first
+	Size int      `json:"size" yaml:"size"`
+	TTL  Duration `json:"ttl" yaml:"ttl"`
+	// Events evicts items on their change events, it needs events to be enabled
+	Events bool `json:"events" yaml:"events"`
+}
+
+// ResilienceConfig retries store calls that failed with a transient error and stops calling a store
+// that keeps failing: after FailureThreshold failed calls in a row the circuit opens and calls fail
+// right away for OpenTimeout, then a single call tries the store again
+type ResilienceConfig struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+	// MaxAttempts includes the first call, 1 disables retries
+	MaxAttempts int `json:"maxAttempts" yaml:"maxAttempts"`
+	// Backoff is the longest wait before the first retry, it doubles up to MaxBackoff and the actual
+	// wait is a random duration below it
+	Backoff    Duration `json:"backoff" yaml:"backoff"`
+	MaxBackoff Duration `json:"maxBackoff" yaml:"maxBackoff"`
+	// RetryWrites also retries writes, a write that failed with a network error may have been applied,
+	// so its retry can fail with a conflict or outdated error
+	RetryWrites      bool     `json:"retryWrites" yaml:"retryWrites"`
+	FailureThreshold int      `json:"failureThreshold" yaml:"failureThreshold"`
+	OpenTimeout      Duration `json:"openTimeout" yaml:"openTimeout"`
+}
+
+type StoreConfig struct {
+	Backend string       `json:"backend" yaml:"backend"`
+	Mongo   MongoConfig  `json:"mongo" yaml:"mongo"`
+	Sqlite  SqliteConfig `json:"sqlite" yaml:"sqlite"`
+	File    FileConfig   `json:"file" yaml:"file"`
+	// Faults is a JSON fault scenario that makes the store misbehave on purpose, for chaos testing only
+	Faults string `json:"faults" yaml:"faults"`
+}
+
+type MongoConfig struct {
+	URL        string `json:"url" yaml:"url"`
+	Database   string `json:"database" yaml:"database"`
+	Collection string `json:"collection" yaml:"collection"`
+	// EnsureIndexes creates missing indexes on startup, drift is only logged
+	EnsureIndexes bool `json:"ensureIndexes" yaml:"ensureIndexes"`
+}
+
+type SqliteConfig struct {
+	// Path of the database file, it is created and migrated on startup
+	Path string `json:"path" yaml:"path"`
+}
+
+// FileConfig is the append-only log store, Sync decides when writes reach the disk: always before
+// a write returns, interval every SyncInterval or never, leaving it to the operating system
+type FileConfig struct {
+	Path         string   `json:"path" yaml:"path"`
+	Sync         string   `json:"sync" yaml:"sync"`
+	SyncInterval Duration `json:"syncInterval" yaml:"syncInterval"`
+	// CompactInterval is how often the log is checked for being mostly stale records, 0 disables compaction
+	CompactInterval Duration `json:"compactInterval" yaml:"compactInterval"`
+}
+
+// Duration is a time.Duration that reads and writes as "5s" in config files
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func Default() Config {
+	return Config{
+		Framework: FRAMEWORK_GORILLA,
+		Server: ServerConfig{
+			Addr:            ":8080",
+			ReadTimeout:     Duration(15 * time.Second),
+			WriteTimeout:    Duration(15 * time.Second),
+			IdleTimeout:     Duration(60 * time.Second),
+			ShutdownTimeout: Duration(10 * time.Second),
+		},
+		Auth: AuthConfig{
+			Mode:   AUTH_STUB,
+			Header: "X-API-Key",
+		},
+		RateLimit: RateLimitConfig{
+			KeyBy: RATE_LIMIT_BY_PRINCIPAL,
+			Read:  QuotaConfig{Rate: 50, Burst: 100},
+			Write: QuotaConfig{Rate: 10, Burst: 20},
+		},
+		CORS: CORSConfig{
+			AllowedMethods: []string{"GET", "POST", "PUT", "DELETE"},
+			AllowedHeaders: []string{"Content-Type", "If-Match", "X-API-Key"},
+			ExposedHeaders: []string{"Etag", "Retry-After", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset"},
+			MaxAge:         Duration(10 * time.Minute),
+		},
+		Compression: CompressionConfig{
+			MinSize: 1024,
+			Level:   -1,
+		},
+		Events: EventsConfig{
+			Source:  EVENTS_FROM_STORE,
+			Backlog: 1000,
+		},
+		Webhooks: WebhooksConfig{
+			MaxAttempts: 8,
+			Backoff:     Duration(5 * time.Second),
+			MaxBackoff:  Duration(time.Hour),
+			Timeout:     Duration(10 * time.Second),
+		},
+		Outbox: OutboxConfig{
+			Collection: "outbox",
+			Interval:   Duration(time.Second),
+			Sinks:      []string{OUTBOX_SINK_LOG},
+		},
+		Cache: CacheConfig{
+			Size: 10000,
+			TTL:  Duration(time.Minute),
+		},
+		Resilience: ResilienceConfig{
+			MaxAttempts:      3,
+			Backoff:          Duration(50 * time.Millisecond),
+			MaxBackoff:       Duration(time.Second),
+			FailureThreshold: 5,
+			OpenTimeout:      Duration(10 * time.Second),
+		},
+		Store: StoreConfig{
+			Backend: STORE_MONGO,
+			Mongo: MongoConfig{
+				URL:           "mongodb://localhost:27017",
+				Database:      "itemDB",
+				Collection:    "items",
+				EnsureIndexes: true,
+			},
+			Sqlite: SqliteConfig{
+				Path: "items.db",
+			},
+			File: FileConfig{
+				Path:            "items.log",
+				Sync:            FSYNC_INTERVAL,
+				SyncInterval:    Duration(time.Second),
+				CompactInterval: Duration(10 * time.Minute),
+			},
+		},
+	}
+}
+
+// Validate reports every problem found in the config, not just the first one
+func (c Config) Validate() error {
+	var problems []string
+
+	if !oneOf(c.Framework, Frameworks) {
+		problems = append(problems, fmt.Sprintf("framework %q must be one of %v", c.Framework, Frameworks))
+	}
+
+	if _, _, err := net.SplitHostPort(c.Server.Addr); err != nil {
+		problems = append(problems, fmt.Sprintf("server.addr %q is not a valid listen address: %s", c.Server.Addr, err))
+	}
+
+	if c.Server.TLS.Enabled && (c.Server.TLS.CertFile == "" || c.Server.TLS.KeyFile == "") {
+		problems = append(problems, "server.tls.certFile and server.tls.keyFile are required when tls is enabled")
+	}
+
+	for name, d := range map[string]Duration{
+		"server.readTimeout":     c.Server.ReadTimeout,
+		"server.writeTimeout":    c.Server.WriteTimeout,
+		"server.idleTimeout":     c.Server.IdleTimeout,
+		"server.shutdownTimeout": c.Server.ShutdownTimeout,
+	} {
+		if d < 0 {
+			problems = append(problems, fmt.Sprintf("%s must not be negative", name))
+		}
+	}
+
+	if !oneOf(c.Auth.Mode, AuthModes) {
+		problems = append(problems, fmt.Sprintf("auth.mode %q must be one of %v", c.Auth.Mode, AuthModes))
+	}
+
+	if c.Auth.Mode == AUTH_APIKEY {
+		if c.Auth.Header == "" {
+			problems = append(problems, "auth.header is required for apikey auth")
+		}
+		if len(c.Auth.APIKeys) == 0 {
+			problems = append(problems, "auth.apiKeys requires at least one key for apikey auth")
+		}
+	}
+
+	if c.RateLimit.Enabled {
+		if !oneOf(c.RateLimit.KeyBy, RateLimitKeys) {
+			problems = append(problems, fmt.Sprintf("rateLimit.keyBy %q must be one of %v", c.RateLimit.KeyBy, RateLimitKeys))
+		}
+		for name, q := range map[string]QuotaConfig{"rateLimit.read": c.RateLimit.Read, "rateLimit.write": c.RateLimit.Write} {
+			if q.Rate <= 0 || q.Burst < 1 {
+				problems = append(problems, fmt.Sprintf("%s needs a positive rate and a burst of at least 1", name))
+			}
+		}
+	}
+
+	if c.CORS.Enabled {
+		if len(c.CORS.AllowedOrigins) == 0 {
+			problems = append(problems, "cors.allowedOrigins requires at least one origin when cors is enabled")
+		}
+		for _, o := range c.CORS.AllowedOrigins {
+			if strings.Count(o, "*") > 1 {
+				problems = append(problems, fmt.Sprintf("cors.allowedOrigins %q may contain only one wildcard", o))
+			}
+			if o == "*" && c.CORS.AllowCredentials {
+				problems = append(problems, "cors.allowCredentials can not be combined with the \"*\" origin")
+			}
+		}
+		if c.CORS.MaxAge < 0 {
+			problems = append(problems, "cors.maxAge must not be negative")
+		}
+	}
+
+	if c.Compression.Enabled {
+		if c.Compression.MinSize < 0 {
+			problems = append(problems, "compression.minSize must not be negative")
+		}
+		if c.Compression.Level < -2 || c.Compression.Level > 9 {
+			problems = append(problems, fmt.Sprintf("compression.level %d must be between -2 and 9", c.Compression.Level))
+		}
+	}
+
+	if c.Events.Enabled {
+		if !oneOf(c.Events.Source, EventSources) {
+			problems = append(problems, fmt.Sprintf("events.source %q must be one of %v", c.Events.Source, EventSources))
+		}
+		if c.Events.Source == EVENTS_FROM_MONGO && c.Store.Backend != STORE_MONGO {
+			problems = append(problems, "events.source mongo needs the mongo store")
+		}
+		if c.Events.Backlog < 1 {
+			problems = append(problems, "events.backlog must be at least 1")
+		}
+	}
+
+	if c.Webhooks.Enabled {
+		if !c.Events.Enabled {
+			problems = append(problems, "webhooks need events to be enabled")
+		}
+		if c.Store.Backend == STORE_SQLITE || c.Store.Backend == STORE_FILE {
+			// their deliveries would only be queued in process and lost on a restart
+			problems = append(problems, fmt.Sprintf("webhooks need the mongo or memory store, not %s", c.Store.Backend))
+		}
+		if c.Webhooks.MaxAttempts < 1 {
+			problems = append(problems, "webhooks.maxAttempts must be at least 1")
+		}
+		if c.Webhooks.Backoff <= 0 || c.Webhooks.MaxBackoff < c.Webhooks.Backoff {
+			problems = append(problems, "webhooks.backoff must be positive and at most webhooks.maxBackoff")
+		}
+		if c.Webhooks.Timeout <= 0 {
+			problems = append(problems, "webhooks.timeout must be positive")
+		}
+		for _, network := range c.Webhooks.AllowedNetworks {
+			if _, err := netip.ParsePrefix(network); err != nil {
+				problems = append(problems, fmt.Sprintf("webhooks.allowedNetworks %q must be a CIDR like 10.0.0.0/8", network))
+			}
+		}
+	}
+
+	if c.Cache.Enabled {
+		if c.Cache.Size < 1 {
+			problems = append(problems, "cache.size must be at least 1")
+		}
+		if c.Cache.TTL <= 0 {
+			problems = append(problems, "cache.ttl must be positive")
+		}
+		if c.Cache.Events && !c.Events.Enabled {
+			problems = append(problems, "cache.events needs events to be enabled")
+		}
+	}
+
+	if c.Resilience.Enabled {
+		if c.Resilience.MaxAttempts < 1 {
+			problems = append(problems, "resilience.maxAttempts must be at least 1")
+		}
+		if c.Resilience.Backoff <= 0 || c.Resilience.MaxBackoff < c.Resilience.Backoff {
+			problems = append(problems, "resilience.backoff must be positive and at most resilience.maxBackoff")
+		}
+		if c.Resilience.FailureThreshold < 1 {
+			problems = append(problems, "resilience.failureThreshold must be at least 1")
+		}
+		if c.Resilience.OpenTimeout <= 0 {
+			problems = append(problems, "resilience.openTimeout must be positive")
+		}
+	}
+
+	if c.Outbox.Enabled {
+		if c.Outbox.Collection == "" {
+			problems = append(problems, "outbox.collection is required")
+		}
+		if c.Outbox.Interval <= 0 {
+			problems = append(problems, "outbox.interval must be positive")
+		}
+		if len(c.Outbox.Sinks) == 0 {
+			problems = append(problems, "outbox.sinks needs at least one sink")
+		}
+		for _, s := range c.Outbox.Sinks {
+			if !oneOf(s, OutboxSinks) {
+				problems = append(problems, fmt.Sprintf("outbox.sinks %q must be one of %v", s, OutboxSinks))
+			}
+		}
+		if oneOf(OUTBOX_SINK_FILE, c.Outbox.Sinks) && c.Outbox.File == "" {
+			problems = append(problems, "outbox.file is required for the file sink")
+		}
+		if oneOf(OUTBOX_SINK_WEBHOOK, c.Outbox.Sinks) {
+			if u, err := url.Parse(c.Outbox.Webhook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				problems = append(problems, fmt.Sprintf("outbox.webhook.url %q must be an http or https url", c.Outbox.Webhook.URL))
+			}
+		}
+	}
+
+	if !oneOf(c.Store.Backend, Stores) {
+		problems = append(problems, fmt.Sprintf("store.backend %q must be one of %v", c.Store.Backend, Stores))
+	}
+
+	if c.Store.Backend == STORE_MONGO {
+		if _, err := url.Parse(c.Store.Mongo.URL); err != nil || c.Store.Mongo.URL == "" {
+			problems = append(problems, fmt.Sprintf("store.mongo.url %q is not a valid url", c.Store.Mongo.URL))
+		}
+		if c.Store.Mongo.Database == "" || c.Store.Mongo.Collection == "" {
+			problems = append(problems, "store.mongo.database and store.mongo.collection are required")
+		}
+	}
+
+	if c.Store.Backend == STORE_SQLITE && c.Store.Sqlite.Path == "" {
+		problems = append(problems, "store.sqlite.path is required")
+	}
+
+	if c.Store.Backend == STORE_FILE {
+		if c.Store.File.Path == "" {
+			problems = append(problems, "store.file.path is required")
+		}
+		if !oneOf(c.Store.File.Sync, FsyncPolicies) {
+			problems = append(problems, fmt.Sprintf("store.file.sync %q must be one of %v", c.Store.File.Sync, FsyncPolicies))
+		}
+		if c.Store.File.Sync == FSYNC_INTERVAL && c.Store.File.SyncInterval <= 0 {
+			problems = append(problems, "store.file.syncInterval must be positive")
+		}
+		if c.Store.File.CompactInterval < 0 {
+			problems = append(problems, "store.file.compactInterval must not be negative")
+		}
+		if c.Outbox.Enabled {
+			problems = append(problems, "outbox is not supported by the file store")
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid config: %s", strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// Redacted returns a copy of the config that is safe to log
+func (c Config) Redacted() Config {
+	r := c
+
+	if len(c.Auth.APIKeys) > 0 {
+		r.Auth.APIKeys = make([]string, len(c.Auth.APIKeys))
+		for i := range r.Auth.APIKeys {
+			r.Auth.APIKeys[i] = redacted
+		}
+	}
+
+	if c.Outbox.Webhook.Secret != "" {
+		r.Outbox.Webhook.Secret = redacted
+	}
+
+	if u, err := url.Parse(c.Store.Mongo.URL); err == nil && u.User != nil {
+		if _, hasPassword := u.User.Password(); hasPassword {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+		}
+		r.Store.Mongo.URL = u.String()
+	}
+
+	return r
+}
+
+func (c Config) String() string {
+	b, err := json.Marshal(c.Redacted())
+	if err != nil {
+		return fmt.Sprintf("failed to print config: %s", err)
+	}
+	return string(b)
+}
+
+func oneOf(v string, allowed []string) bool {
+	for _, a := range allowed {
+		if v == a {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,293 @@
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	ENV_PREFIX = "WF_"
+	FLAG_FILE  = "config"
+)
+
+// setting binds one config field to its flag name and environment variable
+type setting struct {
+	name  string
+	usage string
+	value func(c *Config) flag.Value
+}
+
+var settings = []setting{
+	{"framework", "web framework to serve with: stdlib|gorilla|servemux", func(c *Config) flag.Value { return (*stringValue)(&c.Framework) }},
+	{"addr", "listen address, e.g. :8080", func(c *Config) flag.Value { return (*stringValue)(&c.Server.Addr) }},
+	{"tls", "serve over TLS", func(c *Config) flag.Value { return (*boolValue)(&c.Server.TLS.Enabled) }},
+	{"tls.cert", "TLS certificate file", func(c *Config) flag.Value { return (*stringValue)(&c.Server.TLS.CertFile) }},
+	{"tls.key", "TLS private key file", func(c *Config) flag.Value { return (*stringValue)(&c.Server.TLS.KeyFile) }},
+	{"timeout.read", "server read timeout", func(c *Config) flag.Value { return &c.Server.ReadTimeout }},
+	{"timeout.write", "server write timeout", func(c *Config) flag.Value { return &c.Server.WriteTimeout }},
+	{"timeout.idle", "server idle timeout", func(c *Config) flag.Value { return &c.Server.IdleTimeout }},
+	{"timeout.shutdown", "graceful shutdown timeout", func(c *Config) flag.Value { return &c.Server.ShutdownTimeout }},
+	{"record", "JSON lines file every request and response is recorded to, for replay", func(c *Config) flag.Value { return (*stringValue)(&c.Server.Record) }},
+	{"auth.mode", "authentication mode: stub|apikey|none", func(c *Config) flag.Value { return (*stringValue)(&c.Auth.Mode) }},
+	{"auth.header", "header carrying the api key", func(c *Config) flag.Value { return (*stringValue)(&c.Auth.Header) }},
+	{"auth.keys", "comma separated list of accepted api keys", func(c *Config) flag.Value { return (*listValue)(&c.Auth.APIKeys) }},
+	{"ratelimit", "enable rate limiting", func(c *Config) flag.Value { return (*boolValue)(&c.RateLimit.Enabled) }},
+	{"ratelimit.key", "rate limit bucket key: principal|ip", func(c *Config) flag.Value { return (*stringValue)(&c.RateLimit.KeyBy) }},
+	{"ratelimit.read.rate", "read requests per second", func(c *Config) flag.Value { return (*floatValue)(&c.RateLimit.Read.Rate) }},
+	{"ratelimit.read.burst", "read requests allowed in a burst", func(c *Config) flag.Value { return (*intValue)(&c.RateLimit.Read.Burst) }},
+	{"ratelimit.write.rate", "write requests per second", func(c *Config) flag.Value { return (*floatValue)(&c.RateLimit.Write.Rate) }},
+	{"ratelimit.write.burst", "write requests allowed in a burst", func(c *Config) flag.Value { return (*intValue)(&c.RateLimit.Write.Burst) }},
+	{"cors", "enable CORS for browser clients", func(c *Config) flag.Value { return (*boolValue)(&c.CORS.Enabled) }},
+	{"cors.origins", "comma separated list of allowed origins", func(c *Config) flag.Value { return (*listValue)(&c.CORS.AllowedOrigins) }},
+	{"cors.methods", "comma separated list of allowed methods", func(c *Config) flag.Value { return (*listValue)(&c.CORS.AllowedMethods) }},
+	{"cors.headers", "comma separated list of allowed request headers", func(c *Config) flag.Value { return (*listValue)(&c.CORS.AllowedHeaders) }},
+	{"cors.expose", "comma separated list of response headers readable by clients", func(c *Config) flag.Value { return (*listValue)(&c.CORS.ExposedHeaders) }},
+	{"cors.credentials", "allow cookies and auth headers on cross origin requests", func(c *Config) flag.Value { return (*boolValue)(&c.CORS.AllowCredentials) }},
+	{"cors.maxage", "how long browsers may cache a preflight response", func(c *Config) flag.Value { return &c.CORS.MaxAge }},
+	{"compression", "compress responses and accept compressed requests", func(c *Config) flag.Value { return (*boolValue)(&c.Compression.Enabled) }},
+	{"compression.minsize", "smallest response in bytes that gets compressed", func(c *Config) flag.Value { return (*intValue)(&c.Compression.MinSize) }},
+	{"compression.level", "compression level from -2 to 9, -1 for the default", func(c *Config) flag.Value { return (*intValue)(&c.Compression.Level) }},
+	{"events", "serve the item change feed on /items/events", func(c *Config) flag.Value { return (*boolValue)(&c.Events.Enabled) }},
+	{"events.source", "where item changes come from: store|mongo", func(c *Config) flag.Value { return (*stringValue)(&c.Events.Source) }},
+	{"events.backlog", "number of events kept for reconnecting clients", func(c *Config) flag.Value { return (*intValue)(&c.Events.Backlog) }},
+	{"webhooks", "deliver item changes to registered webhooks", func(c *Config) flag.Value { return (*boolValue)(&c.Webhooks.Enabled) }},
+	{"webhooks.attempts", "attempts before a webhook delivery is dead-lettered", func(c *Config) flag.Value { return (*intValue)(&c.Webhooks.MaxAttempts) }},
+	{"webhooks.backoff", "wait after the first failed webhook delivery, doubled after every further one", func(c *Config) flag.Value { return &c.Webhooks.Backoff }},
+	{"webhooks.maxbackoff", "longest wait between webhook delivery attempts", func(c *Config) flag.Value { return &c.Webhooks.MaxBackoff }},
+	{"webhooks.timeout", "timeout of a webhook delivery attempt", func(c *Config) flag.Value { return &c.Webhooks.Timeout }},
+	{"webhooks.allow", "comma separated CIDRs of internal webhook receivers", func(c *Config) flag.Value { return (*listValue)(&c.Webhooks.AllowedNetworks) }},
+	{"outbox", "record item changes in an outbox and relay them to the sinks", func(c *Config) flag.Value { return (*boolValue)(&c.Outbox.Enabled) }},
+	{"outbox.collection", "mongo collection of the outbox", func(c *Config) flag.Value { return (*stringValue)(&c.Outbox.Collection) }},
+	{"outbox.interval", "how often the relay looks for unpublished changes", func(c *Config) flag.Value { return &c.Outbox.Interval }},
+	{"outbox.sinks", "comma separated list of sinks: log|file|webhook", func(c *Config) flag.Value { return (*listValue)(&c.Outbox.Sinks) }},
+	{"outbox.file", "JSON lines file of the file sink", func(c *Config) flag.Value { return (*stringValue)(&c.Outbox.File) }},
+	{"outbox.webhook.url", "url the webhook sink posts changes to", func(c *Config) flag.Value { return (*stringValue)(&c.Outbox.Webhook.URL) }},
+	{"outbox.webhook.secret", "secret signing the requests of the webhook sink", func(c *Config) flag.Value { return (*stringValue)(&c.Outbox.Webhook.Secret) }},
+	{"cache", "cache items read by id in memory", func(c *Config) flag.Value { return (*boolValue)(&c.Cache.Enabled) }},
+	{"cache.size", "number of items kept in the cache", func(c *Config) flag.Value { return (*intValue)(&c.Cache.Size) }},
+	{"cache.ttl", "how long a cached item is served before it is read again", func(c *Config) flag.Value { return &c.Cache.TTL }},
+	{"cache.events", "evict cached items on their change events, e.g. writes of other processes", func(c *Config) flag.Value { return (*boolValue)(&c.Cache.Events) }},
+	{"resilience", "retry transient store failures and fail fast while the store keeps failing", func(c *Config) flag.Value { return (*boolValue)(&c.Resilience.Enabled) }},
+	{"resilience.attempts", "attempts of a store call including the first", func(c *Config) flag.Value { return (*intValue)(&c.Resilience.MaxAttempts) }},
+	{"resilience.backoff", "longest wait before the first retry, doubled for every further one", func(c *Config) flag.Value { return &c.Resilience.Backoff }},
+	{"resilience.maxbackoff", "longest wait between retries", func(c *Config) flag.Value { return &c.Resilience.MaxBackoff }},
+	{"resilience.retrywrites", "also retry writes, which may have been applied before failing", func(c *Config) flag.Value { return (*boolValue)(&c.Resilience.RetryWrites) }},
+	{"resilience.threshold", "failed store calls in a row that open the circuit", func(c *Config) flag.Value { return (*intValue)(&c.Resilience.FailureThreshold) }},
+	{"resilience.opentimeout", "how long the open circuit fails calls before trying the store again", func(c *Config) flag.Value { return &c.Resilience.OpenTimeout }},
+	{"store", "item store backend: mongo|memory|sqlite|file", func(c *Config) flag.Value { return (*stringValue)(&c.Store.Backend) }},
+	{"store.faults", "JSON scenario of faults injected into the store, for chaos testing", func(c *Config) flag.Value { return (*stringValue)(&c.Store.Faults) }},
+	{"mongo.url", "mongo connection url", func(c *Config) flag.Value { return (*stringValue)(&c.Store.Mongo.URL) }},
+	{"mongo.db", "mongo database name", func(c *Config) flag.Value { return (*stringValue)(&c.Store.Mongo.Database) }},
+	{"mongo.collection", "mongo collection name", func(c *Config) flag.Value { return (*stringValue)(&c.Store.Mongo.Collection) }},
+	{"mongo.ensureindexes", "create missing mongo indexes on startup", func(c *Config) flag.Value { return (*boolValue)(&c.Store.Mongo.EnsureIndexes) }},
+	{"sqlite.path", "sqlite database file", func(c *Config) flag.Value { return (*stringValue)(&c.Store.Sqlite.Path) }},
+	{"file.path", "log file of the file store", func(c *Config) flag.Value { return (*stringValue)(&c.Store.File.Path) }},
+	{"file.sync", "when the file store syncs writes to disk: always|interval|never", func(c *Config) flag.Value { return (*stringValue)(&c.Store.File.Sync) }},
+	{"file.sync.interval", "how often the file store syncs with the interval policy", func(c *Config) flag.Value { return &c.Store.File.SyncInterval }},
+	{"file.compact.interval", "how often the file store checks whether to compact its log, 0 to disable", func(c *Config) flag.Value { return &c.Store.File.CompactInterval }},
+}
+
+// EnvName maps a setting name to its environment variable, e.g. tls.cert => WF_TLS_CERT
+func EnvName(name string) string {
+	return ENV_PREFIX + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(name))
+}
+
+// Load builds the config with precedence flags > environment > config file > defaults.
+// lookupEnv is usually os.LookupEnv and is a parameter so callers can isolate tests.
+func Load(name string, args []string, lookupEnv func(string) (string, bool)) (Config, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags := RegisterFlags(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	return flags.Resolve(lookupEnv)
+}
+
+// Flags holds the raw flag values captured by RegisterFlags until they are resolved
+type Flags struct {
+	fs  *flag.FlagSet
+	set map[string]string
+}
+
+// RegisterFlags adds every config flag to fs so commands can mix them with their own flags
+func RegisterFlags(fs *flag.FlagSet) *Flags {
+	f := &Flags{fs: fs, set: map[string]string{}}
+	defaults := Default()
+
+	fs.Func(FLAG_FILE, fmt.Sprintf("path to a JSON or YAML config file (env %s)", EnvName(FLAG_FILE)), f.capture(FLAG_FILE))
+
+	for _, s := range settings {
+		usage := fmt.Sprintf("%s (env %s)", s.usage, EnvName(s.name))
+		v := s.value(&defaults)
+		if b, isBool := v.(*boolValue); isBool {
+			fs.Var(&capturedBool{capture: f.capture(s.name), def: b.String()}, s.name, usage)
+			continue
+		}
+		fs.Var(&captured{capture: f.capture(s.name), def: v.String()}, s.name, usage)
+	}
+
+	return f
+}
+
+func (f *Flags) capture(name string) func(string) error {
+	return func(v string) error {
+		f.set[name] = v
+		return nil
+	}
+}
+
+func (f *Flags) Resolve(lookupEnv func(string) (string, bool)) (Config, error) {
+	c := Default()
+
+	file, fromFlag := f.set[FLAG_FILE]
+	if !fromFlag {
+		file, _ = lookupEnv(EnvName(FLAG_FILE))
+	}
+
+	if file != "" {
+		if err := loadFile(file, &c); err != nil {
+			return c, err
+		}
+	}
+
+	for _, s := range settings {
+		if v, ok := lookupEnv(EnvName(s.name)); ok {
+			if err := s.value(&c).Set(v); err != nil {
+				return c, fmt.Errorf("invalid value %q for %s: %s", v, EnvName(s.name), err)
+			}
+		}
+	}
+
+	for _, s := range settings {
+		if v, ok := f.set[s.name]; ok {
+			if err := s.value(&c).Set(v); err != nil {
+				return c, fmt.Errorf("invalid value %q for flag -%s: %s", v, s.name, err)
+			}
+		}
+	}
+
+	return c, c.Validate()
+}
+
+func loadFile(path string, c *Config) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open config file: %s", err)
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		d := json.NewDecoder(f)
+		d.DisallowUnknownFields()
+		err = d.Decode(c)
+	case ".yaml", ".yml":
+		d := yaml.NewDecoder(f)
+		d.KnownFields(true)
+		err = d.Decode(c)
+	default:
+		return fmt.Errorf("unsupported config file %s, expected .json, .yaml or .yml", path)
+	}
+
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("failed to parse config file %s: %s", path, err)
+	}
+
+	return nil
+}
+
+type stringValue string
+
+func (s *stringValue) String() string     { return string(*s) }
+func (s *stringValue) Set(v string) error { *s = stringValue(v); return nil }
+
+type boolValue bool
+
+func (b *boolValue) String() string { return strconv.FormatBool(bool(*b)) }
+func (b *boolValue) Set(v string) error {
+	p, err := strconv.ParseBool(v)
+	if err != nil {
+		return err
+	}
+	*b = boolValue(p)
+	return nil
+}
+
+type intValue int
+
+func (i *intValue) String() string { return strconv.Itoa(int(*i)) }
+func (i *intValue) Set(v string) error {
+	p, err := strconv.Atoi(v)
+	if err != nil {
+		return err
+	}
+	*i = intValue(p)
+	return nil
+}
+
+type floatValue float64
+
+func (f *floatValue) String() string { return strconv.FormatFloat(float64(*f), 'g', -1, 64) }
+func (f *floatValue) Set(v string) error {
+	p, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return err
+	}
+	*f = floatValue(p)
+	return nil
+}
+
+type listValue []string
+
+func (l *listValue) String() string { return strings.Join(*l, ",") }
+func (l *listValue) Set(v string) error {
+	*l = nil
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			*l = append(*l, s)
+		}
+	}
+	return nil
+}
+
+func (d *Duration) Set(v string) error {
+	return d.UnmarshalText([]byte(v))
+}
+
+// captured defers applying a flag until Resolve, so flags win over env and file
+type captured struct {
+	capture func(string) error
+	def     string
+	val     *string
+}
+
+func (c *captured) String() string {
+	if c == nil {
+		return ""
+	}
+	if c.val != nil {
+		return *c.val
+	}
+	return c.def
+}
+
+func (c *captured) Set(v string) error {
+	c.val = &v
+	return c.capture(v)
+}
+
+type capturedBool captured
+
+func (c *capturedBool) String() string     { return (*captured)(c).String() }
+func (c *capturedBool) Set(v string) error { return (*captured)(c).Set(v) }
+func (c *capturedBool) IsBoolFlag() bool   { return true }
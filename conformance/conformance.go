@@ -0,0 +1,710 @@
+// Package conformance holds the HTTP contract every framework implementation of the items API must satisfy.
+// A framework package proves equivalence by running the suite against its handler:
+//
+//	func TestConformance(t *testing.T) {
+//		conformance.Run(t, func(d database.ItemDatabase, middlewares ...web.Middleware) http.Handler {
+//			return NewGorillaMuxWebServer(d, middlewares...).Handler()
+//		})
+//	}
+package conformance
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	_ "embed"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vivekmv23/go-web-frameworks/config"
+	"github.com/vivekmv23/go-web-frameworks/database"
+	"github.com/vivekmv23/go-web-frameworks/database/faults"
+	"github.com/vivekmv23/go-web-frameworks/events"
+	"github.com/vivekmv23/go-web-frameworks/fixtures"
+	"github.com/vivekmv23/go-web-frameworks/lib"
+	"github.com/vivekmv23/go-web-frameworks/ratelimit"
+	"github.com/vivekmv23/go-web-frameworks/resilience"
+	"github.com/vivekmv23/go-web-frameworks/web"
+)
+
+const ItemPayload = `{"name": "ItemName", "value": 1000, "description": "Item description", "isActive": true}`
+
+// golden is traffic recorded from the gorilla mux server with serve -record, every framework must answer it alike
+//
+//go:embed testdata/golden.jsonl
+var golden []byte
+
+// HandlerFactory builds the complete handler of a framework implementation on top of d,
+// running middlewares on authenticated items requests
+type HandlerFactory func(d database.ItemDatabase, middlewares ...web.Middleware) http.Handler
+
+type request struct {
+	method  string
+	target  string
+	body    string
+	headers map[string]string
+}
+
+func Run(t *testing.T, newHandler HandlerFactory) {
+	t.Run("ListEmpty", func(t *testing.T) { testListEmpty(t, newHandler) })
+	t.Run("CreateAndGet", func(t *testing.T) { testCreateAndGet(t, newHandler) })
+	t.Run("ListTrailingSlash", func(t *testing.T) { testListTrailingSlash(t, newHandler) })
+	t.Run("QueryString", func(t *testing.T) { testQueryString(t, newHandler) })
+	t.Run("UpdateWithEtag", func(t *testing.T) { testUpdateWithEtag(t, newHandler) })
+	t.Run("UpdateUnknownItem", func(t *testing.T) { testUpdateUnknownItem(t, newHandler) })
+	t.Run("Delete", func(t *testing.T) { testDelete(t, newHandler) })
+	t.Run("BadUUID", func(t *testing.T) { testBadUUID(t, newHandler) })
+	t.Run("BadBody", func(t *testing.T) { testBadBody(t, newHandler) })
+	t.Run("UnknownPaths", func(t *testing.T) { testUnknownPaths(t, newHandler) })
+	t.Run("MethodNotAllowed", func(t *testing.T) { testMethodNotAllowed(t, newHandler) })
+	t.Run("Unauthorized", func(t *testing.T) { testUnauthorized(t, newHandler) })
+	t.Run("StoreFailure", func(t *testing.T) { testStoreFailure(t, newHandler) })
+	t.Run("InjectedFaults", func(t *testing.T) { testInjectedFaults(t, newHandler) })
+	t.Run("RateLimit", func(t *testing.T) { testRateLimit(t, newHandler) })
+	t.Run("CORS", func(t *testing.T) { testCORS(t, newHandler) })
+	t.Run("Compression", func(t *testing.T) { testCompression(t, newHandler) })
+	t.Run("ContentNegotiation", func(t *testing.T) { testContentNegotiation(t, newHandler) })
+	t.Run("Streaming", func(t *testing.T) { testStreaming(t, newHandler) })
+	t.Run("Events", func(t *testing.T) { testEvents(t, newHandler) })
+	t.Run("WebSocket", func(t *testing.T) { testWebSocket(t, newHandler) })
+	t.Run("Golden", func(t *testing.T) { testGolden(t, newHandler) })
+}
+
+func do(h http.Handler, req request) *httptest.ResponseRecorder {
+	var body io.Reader
+	if req.body != "" {
+		body = strings.NewReader(req.body)
+	}
+
+	r := httptest.NewRequest(req.method, req.target, body)
+	for k, v := range req.headers {
+		r.Header.Set(k, v)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+// assertError checks the status and that the body is the lib.Error shared by all implementations
+func assertError(t *testing.T, w *httptest.ResponseRecorder, status int, target string) {
+	t.Helper()
+
+	assert.Equal(t, status, w.Code, "status for %s", target)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"), "content type for %s", target)
+
+	var e lib.Error
+	if assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &e), "error body for %s: %s", target, w.Body.String()) {
+		assert.NotEmpty(t, e.Error)
+		assert.Equal(t, target, e.Path)
+	}
+}
+
+func decode[T any](t *testing.T, w *httptest.ResponseRecorder) T {
+	t.Helper()
+
+	var v T
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &v), "body: %s", w.Body.String())
+	return v
+}
+
+func create(t *testing.T, h http.Handler) lib.Item {
+	t.Helper()
+
+	w := do(h, request{method: http.MethodPost, target: "/items", body: ItemPayload})
+	require.Equal(t, http.StatusCreated, w.Code, "body: %s", w.Body.String())
+	return decode[lib.Item](t, w)
+}
+
+func testListEmpty(t *testing.T, newHandler HandlerFactory) {
+	h := newHandler(database.NewMemoryDatabase())
+
+	w := do(h, request{method: http.MethodGet, target: "/items"})
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, decode[[]lib.Item](t, w))
+	assert.JSONEq(t, "[]", w.Body.String())
+}
+
+func testCreateAndGet(t *testing.T, newHandler HandlerFactory) {
+	h := newHandler(database.NewMemoryDatabase())
+
+	created := create(t, h)
+	assert.NotEqual(t, uuid.Nil, created.Id)
+	assert.Equal(t, "ItemName", created.Name)
+	assert.Equal(t, 1000, created.Value)
+	assert.False(t, created.CreatedOn.IsZero())
+	assert.False(t, created.UpdatedOn.IsZero())
+
+	w := do(h, request{method: http.MethodGet, target: "/items/" + created.Id.String()})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Etag"))
+	assert.Equal(t, created.Id, decode[lib.Item](t, w).Id)
+
+	w = do(h, request{method: http.MethodGet, target: "/items"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, decode[[]lib.Item](t, w), 1)
+}
+
+func testListTrailingSlash(t *testing.T, newHandler HandlerFactory) {
+	h := newHandler(database.NewMemoryDatabase())
+	create(t, h)
+
+	w := do(h, request{method: http.MethodGet, target: "/items/"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, decode[[]lib.Item](t, w), 1)
+
+	w = do(h, request{method: http.MethodPost, target: "/items/", body: ItemPayload})
+	assert.Equal(t, http.StatusCreated, w.Code)
+}
+
+func testQueryString(t *testing.T, newHandler HandlerFactory) {
+	h := newHandler(database.NewMemoryDatabase())
+	created := create(t, h)
+
+	w := do(h, request{method: http.MethodGet, target: "/items/" + created.Id.String() + "?unused=true"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, created.Id, decode[lib.Item](t, w).Id)
+
+	w = do(h, request{method: http.MethodGet, target: "/items?unused=true"})
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func testUpdateWithEtag(t *testing.T, newHandler HandlerFactory) {
+	h := newHandler(database.NewMemoryDatabase())
+	created := create(t, h)
+	target := "/items/" + created.Id.String()
+
+	etag := do(h, request{method: http.MethodGet, target: target}).Header().Get("Etag")
+	require.NotEmpty(t, etag)
+
+	w := do(h, request{method: http.MethodPut, target: target, body: ItemPayload})
+	assertError(t, w, http.StatusPreconditionRequired, target)
+
+	w = do(h, request{method: http.MethodPut, target: target, body: `{"name": "Renamed"}`, headers: map[string]string{"If-Match": etag}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	updated := decode[lib.Item](t, w)
+	assert.Equal(t, "Renamed", updated.Name)
+	assert.Equal(t, created.Id, updated.Id)
+	assert.True(t, created.CreatedOn.Equal(updated.CreatedOn))
+
+	newEtag := w.Header().Get("Etag")
+	assert.NotEmpty(t, newEtag)
+	assert.NotEqual(t, etag, newEtag)
+	assert.Equal(t, newEtag, do(h, request{method: http.MethodGet, target: target}).Header().Get("Etag"))
+
+	w = do(h, request{method: http.MethodPut, target: target, body: ItemPayload, headers: map[string]string{"If-Match": etag}})
+	assertError(t, w, http.StatusPreconditionFailed, target)
+}
+
+func testUpdateUnknownItem(t *testing.T, newHandler HandlerFactory) {
+	h := newHandler(database.NewMemoryDatabase())
+	target := "/items/" + uuid.NewString()
+
+	w := do(h, request{method: http.MethodPut, target: target, body: ItemPayload, headers: map[string]string{"If-Match": "some-e-tag"}})
+	assertError(t, w, http.StatusNotFound, target)
+}
+
+func testDelete(t *testing.T, newHandler HandlerFactory) {
+	h := newHandler(database.NewMemoryDatabase())
+	created := create(t, h)
+	target := "/items/" + created.Id.String()
+
+	w := do(h, request{method: http.MethodDelete, target: target})
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	assertError(t, do(h, request{method: http.MethodDelete, target: target}), http.StatusNotFound, target)
+	assertError(t, do(h, request{method: http.MethodGet, target: target}), http.StatusNotFound, target)
+}
+
+func testBadUUID(t *testing.T, newHandler HandlerFactory) {
+	h := newHandler(database.NewMemoryDatabase())
+
+	for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodDelete} {
+		for _, target := range []string{"/items/not-a-uuid", "/items/fe9dd883-7b95-4d7a-80d9-0c80423a8e1"} {
+			w := do(h, request{method: method, target: target, body: ItemPayload, headers: map[string]string{"If-Match": "some-e-tag"}})
+			assertError(t, w, http.StatusBadRequest, target)
+		}
+	}
+}
+
+func testBadBody(t *testing.T, newHandler HandlerFactory) {
+	h := newHandler(database.NewMemoryDatabase())
+	created := create(t, h)
+	target := "/items/" + created.Id.String()
+
+	assertError(t, do(h, request{method: http.MethodPost, target: "/items", body: `{"name": `}), http.StatusBadRequest, "/items")
+	assertError(t, do(h, request{method: http.MethodPost, target: "/items", body: `{"value": "not a number"}`}), http.StatusBadRequest, "/items")
+
+	w := do(h, request{method: http.MethodPut, target: target, body: `[]`, headers: map[string]string{"If-Match": "some-e-tag"}})
+	assertError(t, w, http.StatusBadRequest, target)
+
+	// each 0x91 opens another msgpack array, decoding must not recurse without bound
+	nested := request{method: http.MethodPost, target: "/items", body: strings.Repeat("\x91", 100_000), headers: map[string]string{"Content-Type": "application/msgpack"}}
+	assertError(t, do(h, nested), http.StatusBadRequest, "/items")
+
+	large := request{method: http.MethodPost, target: "/items", body: `{"name": "` + strings.Repeat("a", 2<<20) + `"}`}
+	assertError(t, do(h, large), http.StatusRequestEntityTooLarge, "/items")
+}
+
+func testUnknownPaths(t *testing.T, newHandler HandlerFactory) {
+	h := newHandler(database.NewMemoryDatabase())
+
+	for _, target := range []string{"/", "/foo", "/itemsx", "/items/fe9dd883-7b95-4d7a-80d9-0c80423a8e16/extra"} {
+		assertError(t, do(h, request{method: http.MethodGet, target: target}), http.StatusNotFound, target)
+	}
+}
+
+func testMethodNotAllowed(t *testing.T, newHandler HandlerFactory) {
+	h := newHandler(database.NewMemoryDatabase())
+
+	cases := []struct {
+		method string
+		target string
+		allow  string
+	}{
+		{http.MethodPatch, "/items", "GET, POST"},
+		{http.MethodDelete, "/items", "GET, POST"},
+		{http.MethodPost, "/items/fe9dd883-7b95-4d7a-80d9-0c80423a8e16", "GET, PUT, DELETE"},
+		{http.MethodPatch, "/items/fe9dd883-7b95-4d7a-80d9-0c80423a8e16", "GET, PUT, DELETE"},
+		{http.MethodHead, "/items", "GET, POST"},
+		{http.MethodHead, "/items/fe9dd883-7b95-4d7a-80d9-0c80423a8e16", "GET, PUT, DELETE"},
+	}
+
+	for _, c := range cases {
+		w := do(h, request{method: c.method, target: c.target})
+		assertError(t, w, http.StatusMethodNotAllowed, c.target)
+		assert.Equal(t, c.allow, w.Header().Get("Allow"), "%s %s", c.method, c.target)
+	}
+}
+
+func testUnauthorized(t *testing.T, newHandler HandlerFactory) {
+	h := newHandler(database.NewMemoryDatabase())
+	created := create(t, h)
+	target := "/items/" + created.Id.String()
+	unauthorized := map[string]string{"unauthorized": "true", "If-Match": "some-e-tag"}
+
+	for _, req := range []request{
+		{method: http.MethodGet, target: "/items"},
+		{method: http.MethodPost, target: "/items", body: ItemPayload},
+		{method: http.MethodGet, target: target},
+		{method: http.MethodPut, target: target, body: ItemPayload},
+		{method: http.MethodDelete, target: target},
+		{method: http.MethodGet, target: "/items/not-a-uuid"},
+	} {
+		req.headers = unauthorized
+		assertError(t, do(h, req), http.StatusUnauthorized, req.target)
+	}
+
+	w := do(h, request{method: http.MethodGet, target: target})
+	assert.Equal(t, http.StatusOK, w.Code, "unauthorized delete must not remove the item")
+}
+
+func testStoreFailure(t *testing.T, newHandler HandlerFactory) {
+	h := newHandler(database.NewMockedDatabase(fmt.Errorf("store unavailable")))
+	target := "/items/fe9dd883-7b95-4d7a-80d9-0c80423a8e16"
+
+	for _, req := range []request{
+		{method: http.MethodGet, target: "/items"},
+		{method: http.MethodPost, target: "/items", body: ItemPayload},
+		{method: http.MethodGet, target: target},
+		{method: http.MethodPut, target: target, body: ItemPayload, headers: map[string]string{"If-Match": "some-e-tag"}},
+		{method: http.MethodDelete, target: target},
+	} {
+		assertError(t, do(h, req), http.StatusInternalServerError, req.target)
+	}
+}
+
+func testInjectedFaults(t *testing.T, newHandler HandlerFactory) {
+	f := faults.New(database.NewMemoryDatabase(), faults.Scenario{})
+	h := newHandler(f)
+	created := create(t, h)
+	target := "/items/" + created.Id.String()
+	get := request{method: http.MethodGet, target: target}
+
+	f.Reset(faults.Scenario{Rules: []faults.Rule{
+		{Ops: []string{faults.OP_GET}, Sequence: []string{faults.ERROR_UNAVAILABLE, faults.ERROR_NOT_FOUND, faults.ERROR_NETWORK}},
+		{Ops: []string{faults.OP_UPDATE}, Error: faults.ERROR_OUTDATED},
+	}})
+	for _, status := range []int{http.StatusServiceUnavailable, http.StatusNotFound, http.StatusInternalServerError} {
+		assertError(t, do(h, get), status, target)
+	}
+	assert.Equal(t, http.StatusOK, do(h, get).Code)
+
+	put := request{method: http.MethodPut, target: target, body: ItemPayload, headers: map[string]string{"If-Match": created.UpdatedOn.String()}}
+	assertError(t, do(h, put), http.StatusPreconditionFailed, target)
+
+	c := config.Default().Resilience
+	c.Backoff, c.MaxBackoff = config.Duration(time.Millisecond), config.Duration(time.Millisecond)
+	h = newHandler(resilience.NewDatabase(f, c))
+	f.Reset(faults.Scenario{Rules: []faults.Rule{{Ops: []string{faults.OP_GET}, Sequence: []string{faults.ERROR_NETWORK, faults.ERROR_TIMEOUT}}}})
+
+	assert.Equal(t, http.StatusOK, do(h, get).Code, "transient failures are retried")
+	assert.Equal(t, 3, f.Calls(faults.OP_GET))
+}
+
+func testRateLimit(t *testing.T, newHandler HandlerFactory) {
+	reads := ratelimit.NewTokenBucketLimiter(0.001, 2)
+	writes := ratelimit.NewTokenBucketLimiter(0.001, 1)
+	h := newHandler(database.NewMemoryDatabase(), web.RateLimitMiddleware(reads, writes, web.RateLimitKey(config.RATE_LIMIT_BY_IP)))
+
+	w := do(h, request{method: http.MethodGet, target: "/items"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+	assert.NotEmpty(t, w.Header().Get("RateLimit-Reset"))
+
+	create(t, h)
+	assertError(t, do(h, request{method: http.MethodPost, target: "/items", body: ItemPayload}), http.StatusTooManyRequests, "/items")
+
+	assert.Equal(t, http.StatusOK, do(h, request{method: http.MethodGet, target: "/items"}).Code, "writes do not use the read quota")
+
+	w = do(h, request{method: http.MethodGet, target: "/items"})
+	assertError(t, w, http.StatusTooManyRequests, "/items")
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	w = do(h, request{method: http.MethodGet, target: "/items", headers: map[string]string{"unauthorized": "true"}})
+	assertError(t, w, http.StatusUnauthorized, "/items")
+}
+
+func testCORS(t *testing.T, newHandler HandlerFactory) {
+	c := config.Default().CORS
+	c.Enabled = true
+	c.AllowedOrigins = []string{"https://dashboard.example.com"}
+	h := web.CORSMiddleware(c)(newHandler(database.NewMemoryDatabase()))
+	created := create(t, h)
+	target := "/items/" + created.Id.String()
+	origin := "https://dashboard.example.com"
+
+	preflight := map[string]string{
+		"Origin":                         origin,
+		"Access-Control-Request-Method":  http.MethodPut,
+		"Access-Control-Request-Headers": "content-type, if-match",
+	}
+	w := do(h, request{method: http.MethodOptions, target: target, headers: preflight})
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, origin, w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Contains(t, w.Header().Get("Access-Control-Allow-Methods"), http.MethodPut)
+	assert.Contains(t, w.Header().Get("Access-Control-Allow-Headers"), "If-Match")
+	assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+	assert.Contains(t, w.Header().Values("Vary"), "Origin")
+
+	preflight["Origin"] = "https://elsewhere.example.com"
+	w = do(h, request{method: http.MethodOptions, target: target, headers: preflight})
+	assertError(t, w, http.StatusForbidden, target)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+
+	w = do(h, request{method: http.MethodGet, target: target, headers: map[string]string{"Origin": origin}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, origin, w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Contains(t, w.Header().Get("Access-Control-Expose-Headers"), "Etag")
+	assert.Contains(t, w.Header().Values("Vary"), "Origin")
+
+	w = do(h, request{method: http.MethodGet, target: "/items/not-a-uuid", headers: map[string]string{"Origin": origin}})
+	assertError(t, w, http.StatusBadRequest, "/items/not-a-uuid")
+	assert.Equal(t, origin, w.Header().Get("Access-Control-Allow-Origin"), "errors must be readable by the browser too")
+
+	w = do(h, request{method: http.MethodOptions, target: target})
+	assertError(t, w, http.StatusMethodNotAllowed, target)
+}
+
+func testCompression(t *testing.T, newHandler HandlerFactory) {
+	c := config.Default().Compression
+	c.MinSize = 512
+	h := web.CompressionMiddleware(c)(newHandler(database.NewMemoryDatabase()))
+	gzipped := map[string]string{"Accept-Encoding": "gzip"}
+
+	w := do(h, request{method: http.MethodGet, target: "/items", headers: gzipped})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Content-Encoding"), "small responses stay uncompressed")
+	assert.Contains(t, w.Header().Values("Vary"), "Accept-Encoding")
+
+	var compressedBody bytes.Buffer
+	gz := gzip.NewWriter(&compressedBody)
+	gz.Write([]byte(ItemPayload))
+	gz.Close()
+
+	var created lib.Item
+	for n := 0; n < 10; n++ {
+		w = do(h, request{method: http.MethodPost, target: "/items", body: compressedBody.String(), headers: map[string]string{"Content-Encoding": "gzip"}})
+		require.Equal(t, http.StatusCreated, w.Code, "body: %s", w.Body.String())
+		created = decode[lib.Item](t, w)
+	}
+
+	w = do(h, request{method: http.MethodGet, target: "/items", headers: map[string]string{"Accept-Encoding": "deflate;q=0.5, gzip"}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	r, err := gzip.NewReader(w.Body)
+	require.NoError(t, err)
+	var items []lib.Item
+	assert.NoError(t, json.NewDecoder(r).Decode(&items))
+	assert.Len(t, items, 10)
+
+	w = do(h, request{method: http.MethodGet, target: "/items", headers: map[string]string{"Accept-Encoding": "gzip;q=0, br"}})
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+
+	w = do(h, request{method: http.MethodDelete, target: "/items/" + created.Id.String(), headers: gzipped})
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Empty(t, w.Body.String())
+
+	w = do(h, request{method: http.MethodPost, target: "/items", body: ItemPayload, headers: map[string]string{"Content-Encoding": "br"}})
+	assertError(t, w, http.StatusUnsupportedMediaType, "/items")
+
+	w = do(h, request{method: http.MethodPost, target: "/items", body: ItemPayload, headers: map[string]string{"Content-Encoding": "gzip"}})
+	assertError(t, w, http.StatusBadRequest, "/items")
+}
+
+func testContentNegotiation(t *testing.T, newHandler HandlerFactory) {
+	h := newHandler(database.NewMemoryDatabase())
+
+	w := do(h, request{method: http.MethodPost, target: "/items", headers: map[string]string{"Content-Type": "application/xml", "Accept": "application/xml"},
+		body: `<item><name>From XML</name><value>7</value><isActive>true</isActive></item>`})
+	require.Equal(t, http.StatusCreated, w.Code, "body: %s", w.Body.String())
+	assert.Equal(t, "application/xml", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "<name>From XML</name>")
+
+	w = do(h, request{method: http.MethodPost, target: "/items", headers: map[string]string{"Content-Type": "text/csv; charset=utf-8"},
+		body: "name,value,isActive\nFrom CSV,8,false\n"})
+	require.Equal(t, http.StatusCreated, w.Code, "body: %s", w.Body.String())
+	assert.Equal(t, "From CSV", decode[lib.Item](t, w).Name)
+
+	w = do(h, request{method: http.MethodGet, target: "/items", headers: map[string]string{"Accept": "text/csv"}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv", w.Header().Get("Content-Type"))
+	rows, err := csv.NewReader(w.Body).ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, rows, 3)
+	assert.Equal(t, "id", rows[0][0])
+
+	w = do(h, request{method: http.MethodGet, target: "/items", headers: map[string]string{"Accept": "application/msgpack"}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/msgpack", w.Header().Get("Content-Type"))
+	assert.Equal(t, byte(0x92), w.Body.Bytes()[0], "a msgpack array of two items")
+
+	w = do(h, request{method: http.MethodGet, target: "/items", headers: map[string]string{"Accept": "text/html, application/*;q=0.5"}})
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	assertError(t, do(h, request{method: http.MethodGet, target: "/items", headers: map[string]string{"Accept": "image/png"}}), http.StatusNotAcceptable, "/items")
+	assertError(t, do(h, request{method: http.MethodPost, target: "/items", body: ItemPayload, headers: map[string]string{"Accept": "image/png"}}), http.StatusNotAcceptable, "/items")
+	assertError(t, do(h, request{method: http.MethodPost, target: "/items", body: ItemPayload, headers: map[string]string{"Content-Type": "application/pdf"}}), http.StatusUnsupportedMediaType, "/items")
+
+	w = do(h, request{method: http.MethodGet, target: "/items"})
+	assert.Len(t, decode[[]lib.Item](t, w), 2, "refused requests must not create items")
+}
+
+func testStreaming(t *testing.T, newHandler HandlerFactory) {
+	h := newHandler(database.NewMemoryDatabase())
+	ndjson := map[string]string{"Accept": "application/x-ndjson"}
+
+	w := do(h, request{method: http.MethodGet, target: "/items", headers: ndjson})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+	assert.Empty(t, w.Body.String())
+
+	var created []lib.Item
+	for range 3 {
+		created = append(created, create(t, h))
+	}
+
+	w = do(h, request{method: http.MethodGet, target: "/items", headers: ndjson})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, w.Flushed, "items are flushed as they are written")
+
+	lines := strings.Split(strings.TrimSuffix(w.Body.String(), "\n"), "\n")
+	require.Len(t, lines, len(created))
+	for idx, line := range lines {
+		var i lib.Item
+		require.NoError(t, json.Unmarshal([]byte(line), &i))
+		assert.Equal(t, created[idx].Id, i.Id)
+	}
+
+	h = newHandler(database.NewMockedDatabase(fmt.Errorf("store unavailable")))
+	assertError(t, do(h, request{method: http.MethodGet, target: "/items", headers: ndjson}), http.StatusInternalServerError, "/items")
+}
+
+type sseEvent struct {
+	id, event, data string
+}
+
+// openEvents connects to the change feed of a real server, SSE needs flushing that a recorder does not show
+func openEvents(t *testing.T, url string, lastEventId string) *bufio.Reader {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, url+"/items/events", nil)
+	require.NoError(t, err)
+	if lastEventId != "" {
+		r.Header.Set("Last-Event-ID", lastEventId)
+	}
+
+	resp, err := http.DefaultClient.Do(r)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	return bufio.NewReader(resp.Body)
+}
+
+// nextEvent reads up to the next named event, skipping retry and heartbeat blocks
+func nextEvent(t *testing.T, r *bufio.Reader) sseEvent {
+	t.Helper()
+
+	var e sseEvent
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			if e.event != "" {
+				return e
+			}
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ": ")
+		switch field {
+		case "id":
+			e.id = value
+		case "event":
+			e.event = value
+		case "data":
+			e.data = value
+		}
+	}
+}
+
+func testEvents(t *testing.T, newHandler HandlerFactory) {
+	h := newHandler(events.NewPublishingDatabase(database.NewMemoryDatabase(), events.NewBus(10)))
+	s := httptest.NewServer(h)
+	// cleanups run last in first out, so the streams are cancelled before the server waits for them
+	t.Cleanup(s.Close)
+
+	feed := openEvents(t, s.URL, "")
+
+	created := create(t, h)
+	e := nextEvent(t, feed)
+	assert.Equal(t, events.ITEM_CREATED, e.event)
+	assert.NotEmpty(t, e.id)
+	assert.Contains(t, e.data, created.Id.String())
+	createdEventId := e.id
+
+	target := "/items/" + created.Id.String()
+	w := do(h, request{method: http.MethodPut, target: target, body: ItemPayload, headers: map[string]string{"If-Match": created.UpdatedOn.String()}})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, events.ITEM_UPDATED, nextEvent(t, feed).event)
+
+	require.Equal(t, http.StatusNoContent, do(h, request{method: http.MethodDelete, target: target}).Code)
+	assert.Equal(t, events.ITEM_DELETED, nextEvent(t, feed).event)
+
+	resumed := openEvents(t, s.URL, createdEventId)
+	assert.Equal(t, events.ITEM_UPDATED, nextEvent(t, resumed).event)
+	assert.Equal(t, events.ITEM_DELETED, nextEvent(t, resumed).event)
+
+	assert.Equal(t, events.RESET, nextEvent(t, openEvents(t, s.URL, "unknown-1")).event)
+
+	// stores without a bus have no change feed
+	h = newHandler(database.NewMemoryDatabase())
+	assertError(t, do(h, request{method: http.MethodGet, target: "/items/events"}), http.StatusNotFound, "/items/events")
+}
+
+func readSocketJSON[T any](t *testing.T, ws *web.WebSocket) T {
+	t.Helper()
+
+	op, data, err := ws.ReadMessage()
+	require.NoError(t, err)
+	require.Equal(t, web.WS_OP_TEXT, op)
+
+	var v T
+	require.NoError(t, json.Unmarshal(data, &v), "message: %s", data)
+	return v
+}
+
+func testWebSocket(t *testing.T, newHandler HandlerFactory) {
+	h := newHandler(events.NewPublishingDatabase(database.NewMemoryDatabase(), events.NewBus(10)))
+	s := httptest.NewServer(h)
+	t.Cleanup(s.Close)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	url := "ws" + strings.TrimPrefix(s.URL, "http") + "/items/socket"
+
+	// the upgrade request is authenticated like any other
+	_, resp, err := web.DialWebSocket(ctx, url, http.Header{"Unauthorized": {"true"}})
+	assert.Error(t, err)
+	if assert.NotNil(t, resp) {
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	}
+
+	w := do(h, request{method: http.MethodGet, target: "/items/socket"})
+	assertError(t, w, http.StatusUpgradeRequired, "/items/socket")
+
+	watched := create(t, h)
+
+	ws, _, err := web.DialWebSocket(ctx, url, nil)
+	require.NoError(t, err)
+	defer ws.Close(web.WS_CLOSE_NORMAL, "")
+
+	require.NoError(t, ws.WriteJSON(web.SocketRequest{Action: web.SOCKET_SUBSCRIBE, Ids: []string{watched.Id.String()}}))
+	reply := readSocketJSON[web.SocketReply](t, ws)
+	assert.Equal(t, web.SOCKET_SUBSCRIBED, reply.Type)
+	assert.False(t, reply.All)
+	assert.Equal(t, []string{watched.Id.String()}, reply.Ids)
+
+	// only changes of subscribed items are sent
+	create(t, h)
+	w = do(h, request{method: http.MethodPut, target: "/items/" + watched.Id.String(), body: ItemPayload, headers: map[string]string{"If-Match": watched.UpdatedOn.String()}})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	ev := readSocketJSON[events.Event](t, ws)
+	assert.Equal(t, events.ITEM_UPDATED, ev.Type)
+	assert.Equal(t, watched.Id, ev.Item.Id)
+
+	require.NoError(t, ws.WriteJSON(web.SocketRequest{Action: web.SOCKET_SUBSCRIBE}))
+	assert.True(t, readSocketJSON[web.SocketReply](t, ws).All)
+
+	created := create(t, h)
+	ev = readSocketJSON[events.Event](t, ws)
+	assert.Equal(t, events.ITEM_CREATED, ev.Type)
+	assert.Equal(t, created.Id, ev.Item.Id)
+
+	require.NoError(t, ws.WriteJSON(web.SocketRequest{Action: web.SOCKET_SUBSCRIBE, Ids: []string{"not-a-uuid"}}))
+	assert.Equal(t, web.SOCKET_ERROR, readSocketJSON[web.SocketReply](t, ws).Type)
+
+	require.NoError(t, ws.WriteMessage(web.WS_OP_BINARY, []byte{1}))
+	_, _, err = ws.ReadMessage()
+	var ce *web.CloseError
+	if assert.ErrorAs(t, err, &ce) {
+		assert.Equal(t, web.WS_CLOSE_UNSUPPORTED, ce.Code)
+	}
+}
+
+func testGolden(t *testing.T, newHandler HandlerFactory) {
+	exchanges, err := fixtures.Read(bytes.NewReader(golden))
+	require.NoError(t, err)
+	require.NotEmpty(t, exchanges)
+
+	for _, d := range fixtures.Replay(newHandler(database.NewMemoryDatabase()), exchanges) {
+		t.Error(d)
+	}
+}
@@ -0,0 +1,79 @@
+package database_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/vivekmv23/go-web-frameworks/config"
+	"github.com/vivekmv23/go-web-frameworks/database"
+	"github.com/vivekmv23/go-web-frameworks/database/dbconformance"
+	"github.com/vivekmv23/go-web-frameworks/database/mongofake"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// closing closes d when the test ends if the backend holds resources
+func closing(t *testing.T, d database.ItemDatabase, err error) database.ItemDatabase {
+	require.NoError(t, err)
+	if c, isCloser := d.(io.Closer); isCloser {
+		t.Cleanup(func() { c.Close() })
+	}
+	return d
+}
+
+func TestMemoryConformance(t *testing.T) {
+	dbconformance.Run(t, func(t *testing.T) database.ItemDatabase {
+		return database.NewMemoryDatabase()
+	})
+}
+
+func TestSqliteConformance(t *testing.T) {
+	dbconformance.Run(t, func(t *testing.T) database.ItemDatabase {
+		d, err := database.NewSqliteDatabase(filepath.Join(t.TempDir(), "items.db"))
+		return closing(t, d, err)
+	})
+}
+
+func TestFileConformance(t *testing.T) {
+	dbconformance.Run(t, func(t *testing.T) database.ItemDatabase {
+		c := config.Default().Store.File
+		c.Path = filepath.Join(t.TempDir(), "items.log")
+		d, err := database.NewFileDatabase(c)
+		return closing(t, d, err)
+	})
+}
+
+// mongoURL is WF_TEST_MONGO_URL when set, e.g. mongodb://localhost:27017, and an in-process fake otherwise
+func mongoURL(t *testing.T) string {
+	if url := os.Getenv("WF_TEST_MONGO_URL"); url != "" {
+		return url
+	}
+
+	s, err := mongofake.Start()
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	return s.URL()
+}
+
+func TestMongoConformance(t *testing.T) {
+	url := mongoURL(t)
+
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(url))
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Disconnect(context.Background()) })
+
+	dbconformance.Run(t, func(t *testing.T) database.ItemDatabase {
+		mc := client.Database("itemDB_test").Collection("items_" + uuid.NewString())
+		t.Cleanup(func() { mc.Drop(context.Background()) })
+
+		d := database.NewDatabaseWithNames(url, "itemDB_test", mc.Name())
+		_, err := d.(*database.Database).EnsureIndexes(context.Background())
+		require.NoError(t, err)
+		return closing(t, d, nil)
+	})
+}
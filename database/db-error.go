@@ -2,6 +2,7 @@ package database
 
 import (
 	"fmt"
+	"time"
 )
 
 type NotFound struct {
@@ -33,3 +34,22 @@ type Unclassified struct {
 func (u *Unclassified) Error() string {
 	return fmt.Sprintf("unclassified error: %s", u.Err)
 }
+
+func (u *Unclassified) Unwrap() error {
+	return u.Err
+}
+
+// Unavailable is returned without asking the store, e.g. while a circuit breaker is open after repeated failures
+type Unavailable struct {
+	Err error
+	// RetryAfter is when the store is tried again, zero when unknown
+	RetryAfter time.Duration
+}
+
+func (u *Unavailable) Error() string {
+	return fmt.Sprintf("store unavailable: %s", u.Err)
+}
+
+func (u *Unavailable) Unwrap() error {
+	return u.Err
+}
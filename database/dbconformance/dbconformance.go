@@ -0,0 +1,255 @@
+// Package dbconformance holds the contract every ItemDatabase backend must satisfy. A backend proves it
+// by running the suite with a factory that returns a new, empty store for every test:
+//
+//	func TestConformance(t *testing.T) {
+//		dbconformance.Run(t, func(t *testing.T) database.ItemDatabase {
+//			return database.NewMemoryDatabase()
+//		})
+//	}
+package dbconformance
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vivekmv23/go-web-frameworks/database"
+	"github.com/vivekmv23/go-web-frameworks/lib"
+)
+
+// DatabaseFactory returns an empty store, it registers the cleanup of the store with t
+type DatabaseFactory func(t *testing.T) database.ItemDatabase
+
+// precision is the coarsest timestamp resolution a backend may store, Mongo keeps milliseconds
+const precision = time.Millisecond
+
+func Run(t *testing.T, newDatabase DatabaseFactory) {
+	t.Run("ListEmpty", func(t *testing.T) { testListEmpty(t, newDatabase(t)) })
+	t.Run("SaveSetsDeterminations", func(t *testing.T) { testSaveSetsDeterminations(t, newDatabase(t)) })
+	t.Run("SaveKeepsId", func(t *testing.T) { testSaveKeepsId(t, newDatabase(t)) })
+	t.Run("SaveDuplicate", func(t *testing.T) { testSaveDuplicate(t, newDatabase(t)) })
+	t.Run("GetUnknown", func(t *testing.T) { testGetUnknown(t, newDatabase(t)) })
+	t.Run("ListInCreationOrder", func(t *testing.T) { testListInCreationOrder(t, newDatabase(t)) })
+	t.Run("Cursor", func(t *testing.T) { testCursor(t, newDatabase(t)) })
+	t.Run("UpdateWithEtag", func(t *testing.T) { testUpdateWithEtag(t, newDatabase(t)) })
+	t.Run("UpdateOutdated", func(t *testing.T) { testUpdateOutdated(t, newDatabase(t)) })
+	t.Run("UpdateUnknown", func(t *testing.T) { testUpdateUnknown(t, newDatabase(t)) })
+	t.Run("Delete", func(t *testing.T) { testDelete(t, newDatabase(t)) })
+	t.Run("DeleteUnknown", func(t *testing.T) { testDeleteUnknown(t, newDatabase(t)) })
+}
+
+func newItem(name string) lib.Item {
+	return lib.Item{Name: name, Value: 1000, Description: name + " description", Active: true}
+}
+
+func save(t *testing.T, d database.ItemDatabase, name string) lib.Item {
+	i := newItem(name)
+	require.NoError(t, d.SaveItem(&i))
+	return i
+}
+
+// assertSameItem compares the stored fields, timestamps only as precise as every backend keeps them
+func assertSameItem(t *testing.T, expected lib.Item, actual lib.Item) {
+	assert.Equal(t, expected.Id, actual.Id)
+	assert.Equal(t, expected.Name, actual.Name)
+	assert.Equal(t, expected.Value, actual.Value)
+	assert.Equal(t, expected.Description, actual.Description)
+	assert.Equal(t, expected.Active, actual.Active)
+	assert.WithinDuration(t, expected.CreatedOn, actual.CreatedOn, precision)
+	assert.WithinDuration(t, expected.UpdatedOn, actual.UpdatedOn, precision)
+}
+
+func testListEmpty(t *testing.T, d database.ItemDatabase) {
+	items, err := d.GetAllItems()
+
+	require.NoError(t, err)
+	assert.NotNil(t, items, "an empty store lists an empty slice, which encodes as []")
+	assert.Empty(t, items)
+}
+
+func testSaveSetsDeterminations(t *testing.T, d database.ItemDatabase) {
+	before := time.Now()
+	i := newItem("determined")
+
+	require.NoError(t, d.SaveItem(&i))
+
+	assert.NotEqual(t, uuid.Nil, i.Id)
+	assert.WithinRange(t, i.CreatedOn, before.Add(-precision), time.Now())
+	assert.Equal(t, i.CreatedOn, i.UpdatedOn)
+	assert.NotContains(t, i.UpdatedOn.String(), "m=", "the Etag must not carry a monotonic clock reading")
+
+	found, err := d.GetItemById(i.Id)
+	require.NoError(t, err)
+	assertSameItem(t, i, found)
+}
+
+func testSaveKeepsId(t *testing.T, d database.ItemDatabase) {
+	id := uuid.New()
+	i := newItem("with id")
+	i.Id = id
+
+	require.NoError(t, d.SaveItem(&i))
+
+	assert.Equal(t, id, i.Id)
+	_, err := d.GetItemById(id)
+	assert.NoError(t, err)
+}
+
+func testSaveDuplicate(t *testing.T, d database.ItemDatabase) {
+	i := save(t, d, "original")
+
+	duplicate := newItem("duplicate")
+	duplicate.Id = i.Id
+	err := d.SaveItem(&duplicate)
+
+	assert.IsType(t, &database.Conflict{}, err)
+	found, err := d.GetItemById(i.Id)
+	require.NoError(t, err)
+	assert.Equal(t, "original", found.Name)
+	items, err := d.GetAllItems()
+	require.NoError(t, err)
+	assert.Len(t, items, 1)
+}
+
+func testGetUnknown(t *testing.T, d database.ItemDatabase) {
+	id := uuid.New()
+
+	_, err := d.GetItemById(id)
+
+	require.IsType(t, &database.NotFound{}, err)
+	assert.Equal(t, id, err.(*database.NotFound).Id)
+	assert.Contains(t, err.Error(), id.String())
+}
+
+func testListInCreationOrder(t *testing.T, d database.ItemDatabase) {
+	first := save(t, d, "first")
+	second := save(t, d, "second")
+	third := save(t, d, "third")
+
+	// an update does not move an item
+	first.Value = 1
+	_, err := d.UpdateItem(first, etagOf(t, d, first.Id))
+	require.NoError(t, err)
+
+	items, err := d.GetAllItems()
+
+	require.NoError(t, err)
+	require.Len(t, items, 3)
+	assert.Equal(t, []uuid.UUID{first.Id, second.Id, third.Id}, []uuid.UUID{items[0].Id, items[1].Id, items[2].Id})
+	assert.Equal(t, 1, items[0].Value)
+	assertSameItem(t, second, items[1])
+}
+
+func testCursor(t *testing.T, d database.ItemDatabase) {
+	for n := range 5 {
+		save(t, d, strings.Repeat("c", n+1))
+	}
+	items, err := d.GetAllItems()
+	require.NoError(t, err)
+
+	cur, err := d.GetItemCursor(context.Background())
+	require.NoError(t, err)
+
+	var walked []lib.Item
+	for cur.Next(context.Background()) {
+		walked = append(walked, cur.Item())
+	}
+
+	assert.NoError(t, cur.Err())
+	assert.NoError(t, cur.Close(context.Background()))
+	require.Len(t, walked, len(items))
+	for idx := range items {
+		assertSameItem(t, items[idx], walked[idx])
+	}
+}
+
+// etagOf reads the item back like a client does before an update
+func etagOf(t *testing.T, d database.ItemDatabase, id uuid.UUID) string {
+	found, err := d.GetItemById(id)
+	require.NoError(t, err)
+	return found.UpdatedOn.String()
+}
+
+func testUpdateWithEtag(t *testing.T, d database.ItemDatabase) {
+	i := save(t, d, "before")
+	etag := etagOf(t, d, i.Id)
+	time.Sleep(2 * precision)
+
+	change := newItem("after")
+	change.Id = i.Id
+	change.Value = 2000
+	updated, err := d.UpdateItem(change, etag)
+
+	require.NoError(t, err)
+	assert.Equal(t, "after", updated.Name)
+	assert.WithinDuration(t, i.CreatedOn, updated.CreatedOn, precision, "the creation time is kept")
+	assert.True(t, updated.UpdatedOn.After(i.UpdatedOn))
+
+	found, err := d.GetItemById(i.Id)
+	require.NoError(t, err)
+	assertSameItem(t, updated, found)
+	assert.NotEqual(t, etag, found.UpdatedOn.String(), "an update changes the Etag")
+}
+
+func testUpdateOutdated(t *testing.T, d database.ItemDatabase) {
+	i := save(t, d, "contended")
+	etag := etagOf(t, d, i.Id)
+	time.Sleep(2 * precision)
+
+	i.Value = 1
+	_, err := d.UpdateItem(i, etag)
+	require.NoError(t, err)
+
+	i.Value = 2
+	_, err = d.UpdateItem(i, etag)
+	assert.IsType(t, &database.Outdated{}, err)
+	_, err = d.UpdateItem(i, "not an etag")
+	assert.IsType(t, &database.Outdated{}, err)
+
+	found, err := d.GetItemById(i.Id)
+	require.NoError(t, err)
+	assert.Equal(t, 1, found.Value, "a rejected update changes nothing")
+}
+
+func testUpdateUnknown(t *testing.T, d database.ItemDatabase) {
+	i := newItem("unknown")
+	i.Id = uuid.New()
+
+	_, err := d.UpdateItem(i, time.Now().String())
+
+	assert.IsType(t, &database.NotFound{}, err)
+	items, err := d.GetAllItems()
+	require.NoError(t, err)
+	assert.Empty(t, items, "an update never creates an item")
+}
+
+func testDelete(t *testing.T, d database.ItemDatabase) {
+	kept := save(t, d, "kept")
+	deleted := save(t, d, "deleted")
+
+	require.NoError(t, d.DeleteItemById(deleted.Id))
+
+	_, err := d.GetItemById(deleted.Id)
+	assert.IsType(t, &database.NotFound{}, err)
+	items, err := d.GetAllItems()
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, kept.Id, items[0].Id)
+
+	assert.IsType(t, &database.NotFound{}, d.DeleteItemById(deleted.Id), "a second delete finds nothing")
+	_, err = d.UpdateItem(deleted, deleted.UpdatedOn.String())
+	assert.IsType(t, &database.NotFound{}, err)
+}
+
+func testDeleteUnknown(t *testing.T, d database.ItemDatabase) {
+	id := uuid.New()
+
+	err := d.DeleteItemById(id)
+
+	require.IsType(t, &database.NotFound{}, err)
+	assert.Equal(t, id, err.(*database.NotFound).Id)
+}
@@ -0,0 +1,349 @@
+// Package faults is an ItemDatabase that makes the store it wraps misbehave on purpose: calls can be
+// slowed down and fail with any of the store errors, for some operations, with a probability or in a
+// scripted sequence. Scenarios are written in Go or loaded from a JSON file:
+//
+//	d := faults.New(database.NewMemoryDatabase(), faults.Scenario{Rules: []faults.Rule{
+//		{Ops: []string{faults.OP_GET}, Sequence: []string{faults.ERROR_NETWORK, faults.ERROR_NETWORK, faults.OK}},
+//		{Latency: config.Duration(50 * time.Millisecond)},
+//	}})
+//
+// Probabilities draw from a generator seeded with Scenario.Seed, so a scenario fails the same calls
+// on every run as long as the calls arrive in the same order.
+package faults
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vivekmv23/go-web-frameworks/config"
+	"github.com/vivekmv23/go-web-frameworks/database"
+	"github.com/vivekmv23/go-web-frameworks/lib"
+)
+
+const (
+	OP_SAVE    = "save"
+	OP_GET     = "get"
+	OP_GET_ALL = "getAll"
+	OP_CURSOR  = "cursor"
+	OP_UPDATE  = "update"
+	OP_DELETE  = "delete"
+
+	// OK is a sequence step that lets the call succeed
+	OK = "ok"
+
+	ERROR_NOT_FOUND    = "notFound"
+	ERROR_CONFLICT     = "conflict"
+	ERROR_OUTDATED     = "outdated"
+	ERROR_UNAVAILABLE  = "unavailable"
+	ERROR_NETWORK      = "network"
+	ERROR_TIMEOUT      = "timeout"
+	ERROR_UNCLASSIFIED = "unclassified"
+)
+
+var (
+	Ops    = []string{OP_SAVE, OP_GET, OP_GET_ALL, OP_CURSOR, OP_UPDATE, OP_DELETE}
+	Errors = []string{ERROR_NOT_FOUND, ERROR_CONFLICT, ERROR_OUTDATED, ERROR_UNAVAILABLE, ERROR_NETWORK, ERROR_TIMEOUT, ERROR_UNCLASSIFIED}
+
+	// ErrInjected is the cause of injected unavailable and unclassified errors
+	ErrInjected = errors.New("injected fault")
+)
+
+// Scenario is a list of rules, the first rule that fires decides how a call misbehaves
+type Scenario struct {
+	Seed  int64  `json:"seed"`
+	Rules []Rule `json:"rules"`
+}
+
+// Rule fires for the calls of Ops, or of every operation when empty. It adds Latency and fails the call
+// with Error, or with the next step of Sequence. A rule with a Sequence stops firing once every step
+// was taken.
+type Rule struct {
+	Ops     []string        `json:"ops"`
+	Latency config.Duration `json:"latency"`
+	Error   string          `json:"error"`
+	// Probability that the rule fires for a call, 0 fires for every call
+	Probability float64 `json:"probability"`
+	// Times is how often the rule fires at most, 0 is unlimited
+	Times    int      `json:"times"`
+	Sequence []string `json:"sequence"`
+	// Partial calls the store before failing, so a write is applied although it reports an error and a
+	// cursor fails after its first item
+	Partial bool `json:"partial"`
+}
+
+func (r Rule) validate() error {
+	for _, op := range r.Ops {
+		if !slices.Contains(Ops, op) {
+			return fmt.Errorf("op %q must be one of %v", op, Ops)
+		}
+	}
+	for _, e := range append([]string{r.Error}, r.Sequence...) {
+		if e != "" && e != OK && !slices.Contains(Errors, e) {
+			return fmt.Errorf("error %q must be one of %v", e, Errors)
+		}
+	}
+	if r.Probability < 0 || r.Probability > 1 {
+		return fmt.Errorf("probability %v must be between 0 and 1", r.Probability)
+	}
+	if r.Latency < 0 || r.Times < 0 {
+		return errors.New("latency and times must not be negative")
+	}
+	return nil
+}
+
+// Load reads a JSON scenario, unknown fields are rejected so that a typo does not go unnoticed
+func Load(path string) (Scenario, error) {
+	var s Scenario
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return s, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(content))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&s); err != nil {
+		return s, fmt.Errorf("invalid fault scenario %s: %w", path, err)
+	}
+
+	for idx, r := range s.Rules {
+		if err := r.validate(); err != nil {
+			return s, fmt.Errorf("invalid rule %d of fault scenario %s: %w", idx, path, err)
+		}
+	}
+	return s, nil
+}
+
+type rule struct {
+	Rule
+	fired int
+}
+
+// fault is what a call runs into, the zero fault lets it through
+type fault struct {
+	latency time.Duration
+	err     string
+	partial bool
+}
+
+// Should satisfy ItemDatabase interface, decorates another store with injected faults
+type Database struct {
+	database.ItemDatabase
+	sleep func(d time.Duration)
+
+	mu    sync.Mutex
+	rnd   *rand.Rand
+	rules []*rule
+	calls map[string]int
+}
+
+func New(d database.ItemDatabase, s Scenario) *Database {
+	f := &Database{ItemDatabase: d, sleep: time.Sleep}
+	f.Reset(s)
+	return f
+}
+
+func (f *Database) Unwrap() database.ItemDatabase {
+	return f.ItemDatabase
+}
+
+// Reset replaces the scenario and forgets the calls so far
+func (f *Database) Reset(s Scenario) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.rnd = rand.New(rand.NewSource(s.Seed))
+	f.rules = nil
+	for _, r := range s.Rules {
+		f.rules = append(f.rules, &rule{Rule: r})
+	}
+	f.calls = map[string]int{}
+}
+
+// Add appends a rule to the scenario, it fires after the rules before it
+func (f *Database) Add(r Rule) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rules = append(f.rules, &rule{Rule: r})
+}
+
+// Calls is the number of calls of op so far, including the failed ones
+func (f *Database) Calls(op string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[op]
+}
+
+func (f *Database) next(op string) fault {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls[op]++
+	for _, r := range f.rules {
+		if len(r.Ops) > 0 && !slices.Contains(r.Ops, op) {
+			continue
+		}
+		if (r.Times > 0 && r.fired >= r.Times) || (len(r.Sequence) > 0 && r.fired >= len(r.Sequence)) {
+			continue
+		}
+		if r.Probability > 0 && f.rnd.Float64() >= r.Probability {
+			continue
+		}
+
+		err := r.Error
+		if len(r.Sequence) > 0 {
+			err = r.Sequence[r.fired]
+		}
+		r.fired++
+
+		if err == OK {
+			err = ""
+		}
+		return fault{latency: time.Duration(r.Latency), err: err, partial: r.Partial}
+	}
+	return fault{}
+}
+
+// inject waits out the latency of the next fault of op and returns it
+func (f *Database) inject(op string) fault {
+	ft := f.next(op)
+	if ft.latency > 0 {
+		f.sleep(ft.latency)
+	}
+	return ft
+}
+
+func toError(kind string, id any) error {
+	switch kind {
+	case "":
+		return nil
+	case ERROR_NOT_FOUND:
+		return &database.NotFound{Id: id}
+	case ERROR_CONFLICT:
+		return &database.Conflict{}
+	case ERROR_OUTDATED:
+		return &database.Outdated{}
+	case ERROR_UNAVAILABLE:
+		return &database.Unavailable{Err: ErrInjected}
+	case ERROR_NETWORK:
+		return &database.Unclassified{Err: &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}}
+	case ERROR_TIMEOUT:
+		return &database.Unclassified{Err: context.DeadlineExceeded}
+	default:
+		return &database.Unclassified{Err: ErrInjected}
+	}
+}
+
+// firstError prefers the error of the store, a partial fault only fails calls the store completed
+func firstError(storeErr error, injected error) error {
+	if storeErr != nil {
+		return storeErr
+	}
+	return injected
+}
+
+func (f *Database) SaveItem(i *lib.Item) error {
+	ft := f.inject(OP_SAVE)
+	if ft.err != "" && !ft.partial {
+		return toError(ft.err, i.Id)
+	}
+	if err := f.ItemDatabase.SaveItem(i); err != nil {
+		return err
+	}
+	return toError(ft.err, i.Id)
+}
+
+func (f *Database) GetItemById(id uuid.UUID) (lib.Item, error) {
+	ft := f.inject(OP_GET)
+	if ft.err != "" && !ft.partial {
+		return lib.Item{}, toError(ft.err, id)
+	}
+	i, err := f.ItemDatabase.GetItemById(id)
+	if err != nil || ft.err != "" {
+		return lib.Item{}, firstError(err, toError(ft.err, id))
+	}
+	return i, nil
+}
+
+func (f *Database) GetAllItems() ([]lib.Item, error) {
+	ft := f.inject(OP_GET_ALL)
+	if ft.err != "" && !ft.partial {
+		return nil, toError(ft.err, nil)
+	}
+	items, err := f.ItemDatabase.GetAllItems()
+	if err != nil || ft.err != "" {
+		return nil, firstError(err, toError(ft.err, nil))
+	}
+	return items, nil
+}
+
+func (f *Database) GetItemCursor(ctx context.Context) (database.ItemCursor, error) {
+	ft := f.inject(OP_CURSOR)
+	if ft.err != "" && !ft.partial {
+		return nil, toError(ft.err, nil)
+	}
+	c, err := f.ItemDatabase.GetItemCursor(ctx)
+	if err != nil || ft.err == "" {
+		return c, err
+	}
+	return &failingCursor{ItemCursor: c, err: toError(ft.err, nil)}, nil
+}
+
+func (f *Database) DeleteItemById(id uuid.UUID) error {
+	ft := f.inject(OP_DELETE)
+	if ft.err != "" && !ft.partial {
+		return toError(ft.err, id)
+	}
+	if err := f.ItemDatabase.DeleteItemById(id); err != nil {
+		return err
+	}
+	return toError(ft.err, id)
+}
+
+func (f *Database) UpdateItem(i lib.Item, ifMatch string) (lib.Item, error) {
+	ft := f.inject(OP_UPDATE)
+	if ft.err != "" && !ft.partial {
+		return lib.Item{}, toError(ft.err, i.Id)
+	}
+	updated, err := f.ItemDatabase.UpdateItem(i, ifMatch)
+	if err != nil || ft.err != "" {
+		return lib.Item{}, firstError(err, toError(ft.err, i.Id))
+	}
+	return updated, nil
+}
+
+// failingCursor yields the first item of the cursor it wraps and then stops with err
+type failingCursor struct {
+	database.ItemCursor
+	err   error
+	moved bool
+}
+
+func (c *failingCursor) Next(ctx context.Context) bool {
+	if c.moved {
+		return false
+	}
+	c.moved = true
+	return c.ItemCursor.Next(ctx)
+}
+
+func (c *failingCursor) Err() error {
+	if err := c.ItemCursor.Err(); err != nil {
+		return err
+	}
+	if c.moved {
+		return c.err
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package faults
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vivekmv23/go-web-frameworks/config"
+	"github.com/vivekmv23/go-web-frameworks/database"
+	"github.com/vivekmv23/go-web-frameworks/lib"
+)
+
+func newTestFaults(s Scenario) (*Database, database.ItemDatabase, *[]time.Duration) {
+	store := database.NewMemoryDatabase()
+	var sleeps []time.Duration
+
+	f := New(store, s)
+	f.sleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+	return f, store, &sleeps
+}
+
+func TestSequence(t *testing.T) {
+	f, store, _ := newTestFaults(Scenario{Rules: []Rule{
+		{Ops: []string{OP_GET}, Sequence: []string{ERROR_NETWORK, ERROR_NOT_FOUND, OK, ERROR_OUTDATED}},
+	}})
+	i := lib.Item{Name: "a"}
+	require.NoError(t, store.SaveItem(&i))
+
+	_, err := f.GetItemById(i.Id)
+	assert.IsType(t, &database.Unclassified{}, err)
+	_, err = f.GetItemById(i.Id)
+	assert.IsType(t, &database.NotFound{}, err)
+	_, err = f.GetItemById(i.Id)
+	assert.NoError(t, err)
+	_, err = f.GetItemById(i.Id)
+	assert.IsType(t, &database.Outdated{}, err)
+	_, err = f.GetItemById(i.Id)
+	assert.NoError(t, err, "the sequence is over")
+
+	_, err = f.GetAllItems()
+	assert.NoError(t, err, "other operations are not affected")
+	assert.Equal(t, 5, f.Calls(OP_GET))
+}
+
+func TestTimesAndRuleOrder(t *testing.T) {
+	f, _, sleeps := newTestFaults(Scenario{Rules: []Rule{
+		{Error: ERROR_UNAVAILABLE, Times: 2},
+		{Latency: config.Duration(30 * time.Millisecond)},
+	}})
+
+	for range 2 {
+		_, err := f.GetAllItems()
+		assert.IsType(t, &database.Unavailable{}, err)
+	}
+	_, err := f.GetAllItems()
+	assert.NoError(t, err)
+
+	assert.Equal(t, []time.Duration{30 * time.Millisecond}, *sleeps, "the first rule that fires decides")
+}
+
+func TestProbabilityIsSeeded(t *testing.T) {
+	outcomes := func() []bool {
+		f, _, _ := newTestFaults(Scenario{Seed: 42, Rules: []Rule{{Error: ERROR_TIMEOUT, Probability: 0.5}}})
+
+		var failed []bool
+		for range 20 {
+			_, err := f.GetAllItems()
+			failed = append(failed, err != nil)
+		}
+		return failed
+	}
+
+	first := outcomes()
+	assert.Equal(t, first, outcomes())
+	assert.Contains(t, first, true)
+	assert.Contains(t, first, false)
+}
+
+func TestPartialWriteIsApplied(t *testing.T) {
+	f, store, _ := newTestFaults(Scenario{Rules: []Rule{{Ops: []string{OP_SAVE, OP_DELETE}, Error: ERROR_TIMEOUT, Partial: true}}})
+
+	i := lib.Item{Name: "a"}
+	assert.IsType(t, &database.Unclassified{}, f.SaveItem(&i))
+	_, err := store.GetItemById(i.Id)
+	assert.NoError(t, err, "the item was saved although saving failed")
+
+	assert.IsType(t, &database.Unclassified{}, f.DeleteItemById(i.Id))
+	assert.IsType(t, &database.NotFound{}, f.DeleteItemById(i.Id), "errors of the store come first")
+}
+
+func TestPartialCursor(t *testing.T) {
+	f, store, _ := newTestFaults(Scenario{Rules: []Rule{{Ops: []string{OP_CURSOR}, Error: ERROR_NETWORK, Partial: true}}})
+	for _, name := range []string{"a", "b"} {
+		require.NoError(t, store.SaveItem(&lib.Item{Name: name}))
+	}
+
+	c, err := f.GetItemCursor(context.Background())
+	require.NoError(t, err)
+	defer c.Close(context.Background())
+
+	assert.True(t, c.Next(context.Background()))
+	assert.False(t, c.Next(context.Background()))
+	assert.IsType(t, &database.Unclassified{}, c.Err())
+}
+
+func TestLoad(t *testing.T) {
+	s, err := Load("../../testdata/fault-scenario.json")
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), s.Seed)
+	require.Len(t, s.Rules, 3)
+	assert.Equal(t, config.Duration(20*time.Millisecond), s.Rules[2].Latency)
+
+	invalid := filepath.Join(t.TempDir(), "invalid.json")
+	require.NoError(t, os.WriteFile(invalid, []byte(`{"rules": [{"ops": ["read"]}]}`), 0o644))
+	_, err = Load(invalid)
+	assert.ErrorContains(t, err, `op "read"`)
+
+	require.NoError(t, os.WriteFile(invalid, []byte(`{"rules": [{"eror": "network"}]}`), 0o644))
+	_, err = Load(invalid)
+	assert.ErrorContains(t, err, "unknown field")
+}
@@ -0,0 +1,493 @@
+package database
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vivekmv23/go-web-frameworks/config"
+	"github.com/vivekmv23/go-web-frameworks/lib"
+)
+
+const (
+	LOG_PUT    = "put"
+	LOG_DELETE = "del"
+)
+
+// logRecord is one line of the log: the crc32 of the JSON in hex, a space and the JSON
+type logRecord struct {
+	Op   string   `json:"op"`
+	Item lib.Item `json:"item"`
+}
+
+// logEntry locates the JSON of the latest put of an item in the log
+type logEntry struct {
+	offset int64
+	size   int
+	// seq is the position of the item in listings, it is kept across updates
+	seq uint64
+}
+
+// Should satisfy ItemDatabase interface, appends every write to a log file and keeps only the
+// location of the latest version of each item in memory. The log is replayed on open, a torn last
+// record left by a crash is cut off while a corrupt complete record fails the open. Only one process
+// may open a log at a time.
+type FileDatabase struct {
+	mu      sync.RWMutex
+	c       config.FileConfig
+	f       *os.File
+	size    int64
+	index   map[uuid.UUID]logEntry
+	nextSeq uint64
+	// records counts the records in the log, those not in index are stale
+	records int
+	dirty   bool
+	syncLog func(f *os.File) error
+	syncDir func(dir string) error
+	done    chan struct{}
+	stopped sync.WaitGroup
+}
+
+// NewFileDatabase opens the log at c.Path, creating it when missing, and starts syncing and compacting it
+// in the background as configured until Close
+func NewFileDatabase(c config.FileConfig) (ItemDatabase, error) {
+	return openFileDatabase(c)
+}
+
+func openFileDatabase(c config.FileConfig) (*FileDatabase, error) {
+	f, err := os.OpenFile(c.Path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &FileDatabase{c: c, f: f, syncLog: (*os.File).Sync, syncDir: syncDir, done: make(chan struct{})}
+	if err := d.replay(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to replay %s: %w", c.Path, err)
+	}
+
+	if c.Sync == config.FSYNC_INTERVAL {
+		d.every(time.Duration(c.SyncInterval), d.sync)
+	}
+	if c.CompactInterval > 0 {
+		d.every(time.Duration(c.CompactInterval), d.compactIfStale)
+	}
+
+	return d, nil
+}
+
+func (d *FileDatabase) every(interval time.Duration, fn func()) {
+	d.stopped.Add(1)
+	go func() {
+		defer d.stopped.Done()
+
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-d.done:
+				return
+			case <-t.C:
+				fn()
+			}
+		}
+	}()
+}
+
+// replay rebuilds the index from the log and truncates a torn last record, it fails on a corrupt
+// record anywhere before that
+func (d *FileDatabase) replay() error {
+	d.index = map[uuid.UUID]logEntry{}
+	d.records, d.nextSeq, d.size = 0, 0, 0
+
+	if _, err := d.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(d.f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			break
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		// a crash while appending leaves a last record without its newline, only that one is cut off
+		if err == io.EOF {
+			log.Printf("WARN: cutting off %s at offset %d after a torn record", d.c.Path, d.size)
+			if err := d.f.Truncate(d.size); err != nil {
+				return err
+			}
+			break
+		}
+
+		rec, err := decodeLogLine(line)
+		if err != nil {
+			// the records after a corrupt one are intact, cutting it off would lose them
+			return fmt.Errorf("corrupt record at offset %d: %w", d.size, err)
+		}
+
+		d.apply(rec, logEntry{offset: d.size + 9, size: len(line) - 10})
+		d.size += int64(len(line))
+	}
+
+	_, err := d.f.Seek(d.size, io.SeekStart)
+	return err
+}
+
+func (d *FileDatabase) apply(rec logRecord, e logEntry) {
+	d.records++
+
+	switch rec.Op {
+	case LOG_PUT:
+		if existing, found := d.index[rec.Item.Id]; found {
+			e.seq = existing.seq
+		} else {
+			e.seq = d.nextSeq
+			d.nextSeq++
+		}
+		d.index[rec.Item.Id] = e
+	case LOG_DELETE:
+		delete(d.index, rec.Item.Id)
+	}
+}
+
+func encodeLogLine(rec logRecord) ([]byte, error) {
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	return fmt.Appendf(nil, "%08x %s\n", crc32.ChecksumIEEE(payload), payload), nil
+}
+
+// decodeLogLine returns the record of a complete line, the JSON starts at byte 9 and ends before the newline
+func decodeLogLine(line []byte) (logRecord, error) {
+	var rec logRecord
+
+	if len(line) < 10 || line[8] != ' ' || line[len(line)-1] != '\n' {
+		return rec, errors.New("malformed record")
+	}
+
+	payload := line[9 : len(line)-1]
+	if fmt.Sprintf("%08x", crc32.ChecksumIEEE(payload)) != string(line[:8]) {
+		return rec, errors.New("checksum mismatch")
+	}
+
+	err := json.Unmarshal(payload, &rec)
+	return rec, err
+}
+
+// appendRecord writes rec at the end of the log and syncs it if the policy says so. A failed write
+// or sync is cut off again, so that later records stay readable and a restart does not replay it.
+func (d *FileDatabase) appendRecord(rec logRecord) error {
+	line, err := encodeLogLine(rec)
+	if err != nil {
+		return err
+	}
+
+	if _, err := d.f.Write(line); err != nil {
+		d.cutOff()
+		return err
+	}
+
+	if d.c.Sync == config.FSYNC_ALWAYS {
+		if err := d.syncLog(d.f); err != nil {
+			d.cutOff()
+			return err
+		}
+	} else {
+		d.dirty = true
+	}
+
+	d.apply(rec, logEntry{offset: d.size + 9, size: len(line) - 10})
+	d.size += int64(len(line))
+	return nil
+}
+
+// cutOff drops what a failed append left behind the last complete record
+func (d *FileDatabase) cutOff() {
+	d.f.Truncate(d.size)
+	d.f.Seek(d.size, io.SeekStart)
+}
+
+func (d *FileDatabase) sync() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.dirty {
+		return
+	}
+	if err := d.syncLog(d.f); err != nil {
+		log.Printf("ERROR: failed to sync %s: %s", d.c.Path, err)
+		return
+	}
+	d.dirty = false
+}
+
+// read loads the item at e, the caller holds the lock
+func (d *FileDatabase) read(e logEntry) (lib.Item, error) {
+	payload := make([]byte, e.size)
+	if _, err := d.f.ReadAt(payload, e.offset); err != nil {
+		return lib.Item{}, err
+	}
+
+	var rec logRecord
+	err := json.Unmarshal(payload, &rec)
+
+	// in the local zone like the timestamps set by determinations, the Etag depends on the zone name
+	rec.Item.CreatedOn = rec.Item.CreatedOn.Local()
+	rec.Item.UpdatedOn = rec.Item.UpdatedOn.Local()
+	return rec.Item, err
+}
+
+func (d *FileDatabase) SaveItem(i *lib.Item) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	determinations(i)
+
+	if _, exists := d.index[i.Id]; exists {
+		return &Conflict{}
+	}
+
+	return mapFileError(d.appendRecord(logRecord{Op: LOG_PUT, Item: *i}))
+}
+
+func (d *FileDatabase) GetItemById(id uuid.UUID) (lib.Item, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	e, found := d.index[id]
+	if !found {
+		return lib.Item{}, &NotFound{Id: id}
+	}
+
+	i, err := d.read(e)
+	return i, mapFileError(err)
+}
+
+func (d *FileDatabase) GetAllItems() ([]lib.Item, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	items := make([]lib.Item, 0, len(d.index))
+	for _, e := range d.ordered() {
+		i, err := d.read(e)
+		if err != nil {
+			return items, mapFileError(err)
+		}
+		items = append(items, i)
+	}
+
+	return items, nil
+}
+
+// ordered lists the index entries in the order the items were created
+func (d *FileDatabase) ordered() []logEntry {
+	entries := make([]logEntry, 0, len(d.index))
+	for _, e := range d.index {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(a, b int) bool { return entries[a].seq < entries[b].seq })
+	return entries
+}
+
+// GetItemCursor lists the ids when it is opened, items deleted while the cursor is open are skipped
+func (d *FileDatabase) GetItemCursor(ctx context.Context) (ItemCursor, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	ids := make([]uuid.UUID, 0, len(d.index))
+	for id := range d.index {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(a, b int) bool { return d.index[ids[a]].seq < d.index[ids[b]].seq })
+
+	return &fileCursor{d: d, ids: ids}, nil
+}
+
+type fileCursor struct {
+	d    *FileDatabase
+	ids  []uuid.UUID
+	item lib.Item
+	err  error
+}
+
+func (c *fileCursor) Next(ctx context.Context) bool {
+	for c.err == nil && len(c.ids) > 0 {
+		if c.err = ctx.Err(); c.err != nil {
+			return false
+		}
+
+		id := c.ids[0]
+		c.ids = c.ids[1:]
+
+		i, err := c.d.GetItemById(id)
+		if _, gone := err.(*NotFound); gone {
+			continue
+		}
+		c.item, c.err = i, err
+		return c.err == nil
+	}
+	return false
+}
+
+func (c *fileCursor) Item() lib.Item {
+	return c.item
+}
+
+func (c *fileCursor) Err() error {
+	return c.err
+}
+
+func (c *fileCursor) Close(ctx context.Context) error {
+	c.ids = nil
+	return nil
+}
+
+func (d *FileDatabase) DeleteItemById(id uuid.UUID) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, found := d.index[id]; !found {
+		return &NotFound{Id: id}
+	}
+
+	return mapFileError(d.appendRecord(logRecord{Op: LOG_DELETE, Item: lib.Item{Id: id}}))
+}
+
+func (d *FileDatabase) UpdateItem(i lib.Item, ifMatch string) (lib.Item, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	e, found := d.index[i.Id]
+	if !found {
+		return i, &NotFound{Id: i.Id}
+	}
+
+	existingItem, err := d.read(e)
+	if err != nil {
+		return i, mapFileError(err)
+	}
+
+	if existingItem.UpdatedOn.String() != ifMatch {
+		return i, &Outdated{}
+	}
+
+	i.CreatedOn = existingItem.CreatedOn
+	determinations(&i)
+
+	return i, mapFileError(d.appendRecord(logRecord{Op: LOG_PUT, Item: i}))
+}
+
+// compactIfStale compacts once stale records make up at least half of the log
+func (d *FileDatabase) compactIfStale() {
+	d.mu.RLock()
+	stale := d.records - len(d.index)
+	d.mu.RUnlock()
+
+	if stale == 0 || stale < len(d.index) {
+		return
+	}
+
+	if err := d.Compact(); err != nil {
+		log.Printf("ERROR: failed to compact %s: %s", d.c.Path, err)
+	}
+}
+
+// Compact rewrites the log with only the latest version of every item. The new log is synced before
+// it replaces the old one, so a crash leaves either of them intact.
+func (d *FileDatabase) Compact() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	tmp := d.c.Path + ".compact"
+	f, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	err = func() error {
+		for _, e := range d.ordered() {
+			i, err := d.read(e)
+			if err != nil {
+				return err
+			}
+			line, err := encodeLogLine(logRecord{Op: LOG_PUT, Item: i})
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(line); err != nil {
+				return err
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		return f.Sync()
+	}()
+	if err == nil {
+		err = os.Rename(tmp, d.c.Path)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	// the old log is unlinked by the rename, writes must go to the new one whatever happens next
+	d.f.Close()
+	d.f = f
+	d.dirty = false
+	if err := d.replay(); err != nil {
+		return err
+	}
+	return d.syncDir(filepath.Dir(d.c.Path))
+}
+
+// Close stops syncing and compacting and syncs the log a last time
+func (d *FileDatabase) Close() error {
+	close(d.done)
+	d.stopped.Wait()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.f.Sync(); err != nil {
+		d.f.Close()
+		return err
+	}
+	return d.f.Close()
+}
+
+// syncDir makes a rename in dir durable
+func syncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
+
+func mapFileError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Unclassified{Err: err}
+}
@@ -0,0 +1,207 @@
+package database
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vivekmv23/go-web-frameworks/config"
+	"github.com/vivekmv23/go-web-frameworks/lib"
+)
+
+func newTestFileConfig(t *testing.T) config.FileConfig {
+	c := config.Default().Store.File
+	c.Path = filepath.Join(t.TempDir(), "items.log")
+	c.Sync = config.FSYNC_ALWAYS
+	c.CompactInterval = 0
+	return c
+}
+
+func TestFileDatabaseSurvivesReopen(t *testing.T) {
+	c := newTestFileConfig(t)
+
+	d, err := openFileDatabase(c)
+	require.NoError(t, err)
+
+	first := lib.Item{Name: "first", Value: 1}
+	second := lib.Item{Name: "second", Value: 2}
+	require.NoError(t, d.SaveItem(&first))
+	require.NoError(t, d.SaveItem(&second))
+
+	first.Value = 10
+	first, err = d.UpdateItem(first, first.UpdatedOn.String())
+	require.NoError(t, err)
+
+	deleted := lib.Item{Name: "deleted"}
+	require.NoError(t, d.SaveItem(&deleted))
+	require.NoError(t, d.DeleteItemById(deleted.Id))
+	require.NoError(t, d.Close())
+
+	d, err = openFileDatabase(c)
+	require.NoError(t, err)
+	defer d.Close()
+
+	items, err := d.GetAllItems()
+	require.NoError(t, err)
+	assert.Equal(t, []lib.Item{first, second}, items)
+
+	// the Etag handed out before the restart is still valid
+	_, err = d.UpdateItem(first, first.UpdatedOn.String())
+	assert.NoError(t, err)
+	_, err = d.GetItemById(deleted.Id)
+	assert.IsType(t, &NotFound{}, err)
+}
+
+func TestFileDatabaseCutsOffTornTail(t *testing.T) {
+	c := newTestFileConfig(t)
+
+	d, err := openFileDatabase(c)
+	require.NoError(t, err)
+	kept := lib.Item{Name: "kept"}
+	require.NoError(t, d.SaveItem(&kept))
+	require.NoError(t, d.Close())
+
+	// a crash in the middle of appending the next record
+	f, err := os.OpenFile(c.Path, os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = f.WriteString(`0badc0de {"op":"put","item":{"id":"`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	d, err = openFileDatabase(c)
+	require.NoError(t, err)
+	defer d.Close()
+
+	items, err := d.GetAllItems()
+	require.NoError(t, err)
+	assert.Equal(t, []lib.Item{kept}, items)
+
+	// appends after the cut are readable after the next reopen
+	added := lib.Item{Name: "added"}
+	require.NoError(t, d.SaveItem(&added))
+	require.NoError(t, d.replay())
+	_, err = d.GetItemById(added.Id)
+	assert.NoError(t, err)
+}
+
+func TestFileDatabaseRefusesCorruptRecord(t *testing.T) {
+	c := newTestFileConfig(t)
+
+	d, err := openFileDatabase(c)
+	require.NoError(t, err)
+	for _, name := range []string{"first", "second"} {
+		require.NoError(t, d.SaveItem(&lib.Item{Name: name}))
+	}
+	require.NoError(t, d.Close())
+
+	content, err := os.ReadFile(c.Path)
+	require.NoError(t, err)
+	// a flipped bit in the first record
+	content[20] ^= 0x01
+	require.NoError(t, os.WriteFile(c.Path, content, 0o644))
+
+	_, err = openFileDatabase(c)
+	assert.ErrorContains(t, err, "corrupt record at offset 0")
+
+	after, err := os.ReadFile(c.Path)
+	require.NoError(t, err)
+	assert.Equal(t, content, after, "the records after the corrupt one are kept")
+}
+
+func TestFileDatabaseCompact(t *testing.T) {
+	c := newTestFileConfig(t)
+
+	d, err := openFileDatabase(c)
+	require.NoError(t, err)
+	defer d.Close()
+
+	items := make([]lib.Item, 3)
+	for idx := range items {
+		require.NoError(t, d.SaveItem(&items[idx]))
+	}
+	for n := range 20 {
+		items[1].Value = n
+		items[1], err = d.UpdateItem(items[1], items[1].UpdatedOn.String())
+		require.NoError(t, err)
+	}
+	require.NoError(t, d.DeleteItemById(items[2].Id))
+
+	before, err := os.Stat(c.Path)
+	require.NoError(t, err)
+
+	require.NoError(t, d.Compact())
+
+	after, err := os.Stat(c.Path)
+	require.NoError(t, err)
+	assert.Less(t, after.Size(), before.Size())
+	assert.Equal(t, 2, d.records)
+
+	all, err := d.GetAllItems()
+	require.NoError(t, err)
+	assert.Equal(t, items[:2], all)
+
+	// writes keep going to the compacted log
+	require.NoError(t, d.DeleteItemById(items[0].Id))
+	require.NoError(t, d.replay())
+	all, err = d.GetAllItems()
+	require.NoError(t, err)
+	assert.Equal(t, items[1:2], all)
+}
+
+func TestFileDatabaseCompactKeepsNewLogWhenDirSyncFails(t *testing.T) {
+	c := newTestFileConfig(t)
+
+	d, err := openFileDatabase(c)
+	require.NoError(t, err)
+	d.syncDir = func(dir string) error { return errors.New("no sync") }
+
+	kept := lib.Item{Name: "kept"}
+	require.NoError(t, d.SaveItem(&kept))
+	assert.EqualError(t, d.Compact(), "no sync")
+
+	added := lib.Item{Name: "added"}
+	require.NoError(t, d.SaveItem(&added))
+	require.NoError(t, d.Close())
+
+	d, err = openFileDatabase(c)
+	require.NoError(t, err)
+	defer d.Close()
+
+	items, err := d.GetAllItems()
+	require.NoError(t, err)
+	assert.Equal(t, []lib.Item{kept, added}, items, "writes after the compaction went to the renamed log")
+}
+
+func TestFileDatabaseCutsOffUnsyncedRecord(t *testing.T) {
+	c := newTestFileConfig(t)
+
+	d, err := openFileDatabase(c)
+	require.NoError(t, err)
+
+	first := lib.Item{Name: "first"}
+	require.NoError(t, d.SaveItem(&first))
+
+	d.syncLog = func(f *os.File) error { return errors.New("no sync") }
+	failed := lib.Item{Name: "failed"}
+	assert.ErrorContains(t, d.SaveItem(&failed), "no sync")
+
+	d.syncLog = (*os.File).Sync
+	second := lib.Item{Name: "second"}
+	require.NoError(t, d.SaveItem(&second))
+
+	got, err := d.GetItemById(second.Id)
+	require.NoError(t, err)
+	assert.Equal(t, second, got, "later records are indexed where they were written")
+	require.NoError(t, d.Close())
+
+	d, err = openFileDatabase(c)
+	require.NoError(t, err)
+	defer d.Close()
+
+	items, err := d.GetAllItems()
+	require.NoError(t, err)
+	assert.Equal(t, []lib.Item{first, second}, items, "the failed write is not replayed")
+}
@@ -0,0 +1,57 @@
+package database
+
+import (
+	"context"
+
+	"github.com/vivekmv23/go-web-frameworks/lib"
+)
+
+// ItemCursor walks over all items one at a time so that callers never hold the whole collection,
+// it must be closed once the caller is done with it
+type ItemCursor interface {
+	// Next advances to the next item, it returns false when the items are exhausted or on error
+	Next(ctx context.Context) bool
+	// Item is the item Next advanced to
+	Item() lib.Item
+	// Err is the error that stopped Next, if any
+	Err() error
+	Close(ctx context.Context) error
+}
+
+// sliceCursor serves items that are already in memory
+type sliceCursor struct {
+	items []lib.Item
+	idx   int
+	err   error
+}
+
+func NewSliceCursor(items []lib.Item) ItemCursor {
+	return &sliceCursor{items: items, idx: -1}
+}
+
+func (c *sliceCursor) Next(ctx context.Context) bool {
+	if c.err != nil {
+		return false
+	}
+	if c.err = ctx.Err(); c.err != nil {
+		return false
+	}
+	if c.idx+1 >= len(c.items) {
+		return false
+	}
+	c.idx++
+	return true
+}
+
+func (c *sliceCursor) Item() lib.Item {
+	return c.items[c.idx]
+}
+
+func (c *sliceCursor) Err() error {
+	return c.err
+}
+
+func (c *sliceCursor) Close(ctx context.Context) error {
+	c.items = nil
+	return nil
+}
@@ -0,0 +1,205 @@
+package database
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/vivekmv23/go-web-frameworks/lib"
+)
+
+// Should satisfy ItemDatabase interface, keeps items in process for local runs
+type MemoryDatabase struct {
+	mu    sync.RWMutex
+	items map[uuid.UUID]lib.Item
+	order []uuid.UUID
+	// outbox holds the unpublished records when writes go through the outbox, nil otherwise
+	outbox []OutboxRecord
+}
+
+func NewMemoryDatabase() ItemDatabase {
+	return &MemoryDatabase{items: map[uuid.UUID]lib.Item{}}
+}
+
+// NewMemoryDatabaseWithOutbox records every write in an outbox under the same lock as the write
+func NewMemoryDatabaseWithOutbox() ItemDatabase {
+	return &MemoryDatabase{items: map[uuid.UUID]lib.Item{}, outbox: []OutboxRecord{}}
+}
+
+func (m *MemoryDatabase) SaveItem(i *lib.Item) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	determinations(i)
+
+	if _, exists := m.items[i.Id]; exists {
+		return &Conflict{}
+	}
+
+	m.items[i.Id] = *i
+	m.order = append(m.order, i.Id)
+	m.appendOutbox(OUTBOX_ITEM_CREATED, *i)
+
+	return nil
+}
+
+func (m *MemoryDatabase) GetItemById(id uuid.UUID) (lib.Item, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	i, found := m.items[id]
+	if !found {
+		return i, &NotFound{Id: id}
+	}
+
+	return i, nil
+}
+
+func (m *MemoryDatabase) GetAllItems() ([]lib.Item, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	items := make([]lib.Item, 0, len(m.order))
+	for _, id := range m.order {
+		items = append(items, m.items[id])
+	}
+
+	return items, nil
+}
+
+// GetItemCursor copies only the ids, items deleted while the cursor is open are skipped
+func (m *MemoryDatabase) GetItemCursor(ctx context.Context) (ItemCursor, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	order := make([]uuid.UUID, len(m.order))
+	copy(order, m.order)
+
+	return &memoryCursor{m: m, order: order}, nil
+}
+
+type memoryCursor struct {
+	m     *MemoryDatabase
+	order []uuid.UUID
+	item  lib.Item
+	err   error
+}
+
+func (c *memoryCursor) Next(ctx context.Context) bool {
+	for c.err == nil && len(c.order) > 0 {
+		if c.err = ctx.Err(); c.err != nil {
+			return false
+		}
+
+		id := c.order[0]
+		c.order = c.order[1:]
+
+		c.m.mu.RLock()
+		i, found := c.m.items[id]
+		c.m.mu.RUnlock()
+
+		if found {
+			c.item = i
+			return true
+		}
+	}
+	return false
+}
+
+func (c *memoryCursor) Item() lib.Item {
+	return c.item
+}
+
+func (c *memoryCursor) Err() error {
+	return c.err
+}
+
+func (c *memoryCursor) Close(ctx context.Context) error {
+	c.order = nil
+	return nil
+}
+
+func (m *MemoryDatabase) DeleteItemById(id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, found := m.items[id]; !found {
+		return &NotFound{Id: id}
+	}
+
+	delete(m.items, id)
+	m.appendOutbox(OUTBOX_ITEM_DELETED, lib.Item{Id: id})
+	for idx, oid := range m.order {
+		if oid == id {
+			m.order = append(m.order[:idx], m.order[idx+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
+
+func (m *MemoryDatabase) UpdateItem(i lib.Item, ifMatch string) (lib.Item, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existingItem, found := m.items[i.Id]
+	if !found {
+		return i, &NotFound{Id: i.Id}
+	}
+
+	if existingItem.UpdatedOn.String() != ifMatch {
+		return i, &Outdated{}
+	}
+
+	i.CreatedOn = existingItem.CreatedOn
+	determinations(&i)
+	m.items[i.Id] = i
+	m.appendOutbox(OUTBOX_ITEM_UPDATED, i)
+
+	return i, nil
+}
+
+func (m *MemoryDatabase) appendOutbox(changeType string, i lib.Item) {
+	if m.outbox != nil {
+		m.outbox = append(m.outbox, newOutboxRecord(changeType, i))
+	}
+}
+
+func (m *MemoryDatabase) PendingOutbox(ctx context.Context, limit int) ([]OutboxRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.outbox == nil {
+		return nil, errOutboxDisabled
+	}
+
+	records := make([]OutboxRecord, min(limit, len(m.outbox)))
+	copy(records, m.outbox)
+	return records, nil
+}
+
+// MarkPublished drops the records, nothing outlives the process anyway
+func (m *MemoryDatabase) MarkPublished(ctx context.Context, ids []uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.outbox == nil {
+		return errOutboxDisabled
+	}
+
+	published := map[uuid.UUID]bool{}
+	for _, id := range ids {
+		published[id] = true
+	}
+
+	pending := m.outbox[:0]
+	for _, r := range m.outbox {
+		if !published[r.Id] {
+			pending = append(pending, r)
+		}
+	}
+	m.outbox = pending
+
+	return nil
+}
@@ -0,0 +1,20 @@
+package migrations
+
+// Items are the migrations of the items collection, a model change adds one with the next version:
+//
+//	{
+//		Version:     1,
+//		Description: "add tags",
+//		Up: func(ctx context.Context, items *mongo.Collection) error {
+//			_, err := items.UpdateMany(ctx, bson.D{{Key: "tag", Value: bson.D{{Key: "$exists", Value: false}}}},
+//				bson.D{{Key: "$set", Value: bson.D{{Key: "tag", Value: bson.A{}}}}})
+//			return err
+//		},
+//		Down: func(ctx context.Context, items *mongo.Collection) error {
+//			_, err := items.UpdateMany(ctx, bson.D{}, bson.D{{Key: "$unset", Value: bson.D{{Key: "tag", Value: ""}}}})
+//			return err
+//		},
+//	}
+//
+// Released migrations are never edited or renumbered, a fix is a new migration.
+var Items = []Migration{}
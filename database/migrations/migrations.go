@@ -0,0 +1,357 @@
+// Package migrations changes the stored items when lib.Item changes. Migrations are Go functions with
+// a version, they run in version order and every applied version is recorded in the migrations
+// collection next to the items, so a migration runs once per database:
+//
+//	m, err := migrations.New(items, migrations.Items)
+//	steps, err := m.Up(ctx, migrations.LATEST, false)
+//
+// A lock document keeps two instances from migrating at the same time. A lock left behind by a
+// crashed instance expires after LOCK_TTL.
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	APPLIED_COLLECTION = "migrations"
+	LOCK_COLLECTION    = "migrations_lock"
+
+	// LOCK_TTL is how long a lock holds without being renewed, it is renewed every third of it while
+	// migrating
+	LOCK_TTL = 10 * time.Minute
+
+	// LATEST migrates up to the last known version
+	LATEST = -1
+
+	UP   = "up"
+	DOWN = "down"
+
+	lockId = "migrate"
+)
+
+// ErrLocked is returned when another instance is migrating
+var ErrLocked = errors.New("another instance is migrating")
+
+// Migration changes the items collection from Version-1 to Version with Up and back with Down.
+// Down may be nil when a migration cannot be undone. Both must be safe to run again after a failure
+// halfway, since the version is only recorded once they return.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(ctx context.Context, items *mongo.Collection) error
+	Down        func(ctx context.Context, items *mongo.Collection) error
+}
+
+// Step is a migration that ran, or would run in a dry run
+type Step struct {
+	Version     int
+	Description string
+	Direction   string
+}
+
+func (s Step) String() string {
+	return fmt.Sprintf("%s %d: %s", s.Direction, s.Version, s.Description)
+}
+
+// Status is a known or recorded migration, AppliedOn is zero while it is pending
+type Status struct {
+	Version     int
+	Description string
+	AppliedOn   time.Time
+	// Unknown migrations are recorded as applied but not part of this build
+	Unknown bool
+}
+
+type applied struct {
+	Version     int       `bson:"_id"`
+	Description string    `bson:"description"`
+	AppliedOn   time.Time `bson:"appliedOn"`
+}
+
+type lock struct {
+	Id        string    `bson:"_id"`
+	Owner     string    `bson:"owner"`
+	ExpiresOn time.Time `bson:"expiresOn"`
+}
+
+type Migrator struct {
+	items      *mongo.Collection
+	applied    *mongo.Collection
+	locks      *mongo.Collection
+	migrations []Migration
+	owner      string
+	ttl        time.Duration
+}
+
+// New checks that versions are positive and unique, the migrations may be given in any order
+func New(items *mongo.Collection, migrations []Migration) (*Migrator, error) {
+	sorted := append([]Migration{}, migrations...)
+	sort.Slice(sorted, func(a, b int) bool { return sorted[a].Version < sorted[b].Version })
+
+	for idx, m := range sorted {
+		if m.Version <= 0 {
+			return nil, fmt.Errorf("migration %q needs a positive version", m.Description)
+		}
+		if m.Up == nil {
+			return nil, fmt.Errorf("migration %d has no up", m.Version)
+		}
+		if idx > 0 && sorted[idx-1].Version == m.Version {
+			return nil, fmt.Errorf("migration version %d is used twice", m.Version)
+		}
+	}
+
+	hostname, _ := os.Hostname()
+	db := items.Database()
+	return &Migrator{
+		items:      items,
+		applied:    db.Collection(APPLIED_COLLECTION),
+		locks:      db.Collection(LOCK_COLLECTION),
+		migrations: sorted,
+		owner:      fmt.Sprintf("%s/%d/%s", hostname, os.Getpid(), uuid.NewString()),
+		ttl:        LOCK_TTL,
+	}, nil
+}
+
+// Status lists every known migration and every recorded one in version order
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	recorded, err := m.recorded(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var status []Status
+	for _, mig := range m.migrations {
+		s := Status{Version: mig.Version, Description: mig.Description}
+		if a, isApplied := recorded[mig.Version]; isApplied {
+			s.AppliedOn = a.AppliedOn
+			delete(recorded, mig.Version)
+		}
+		status = append(status, s)
+	}
+	for _, a := range recorded {
+		status = append(status, Status{Version: a.Version, Description: a.Description, AppliedOn: a.AppliedOn, Unknown: true})
+	}
+
+	sort.Slice(status, func(a, b int) bool { return status[a].Version < status[b].Version })
+	return status, nil
+}
+
+// Up applies the pending migrations up to version target, or all of them with LATEST. With dryRun
+// it only returns the steps it would take.
+func (m *Migrator) Up(ctx context.Context, target int, dryRun bool) ([]Step, error) {
+	return m.migrate(ctx, dryRun, func(recorded map[int]applied) ([]Step, error) {
+		var steps []Step
+		for _, mig := range m.migrations {
+			if target != LATEST && mig.Version > target {
+				break
+			}
+			if _, isApplied := recorded[mig.Version]; !isApplied {
+				steps = append(steps, Step{Version: mig.Version, Description: mig.Description, Direction: UP})
+			}
+		}
+		return steps, nil
+	})
+}
+
+// Down rolls back the applied migrations above version target, newest first, so Down(ctx, 0, false)
+// undoes all of them. With dryRun it only returns the steps it would take.
+func (m *Migrator) Down(ctx context.Context, target int, dryRun bool) ([]Step, error) {
+	if target < 0 {
+		return nil, fmt.Errorf("target version %d must not be negative", target)
+	}
+
+	return m.migrate(ctx, dryRun, func(recorded map[int]applied) ([]Step, error) {
+		var versions []int
+		for v := range recorded {
+			if v > target {
+				versions = append(versions, v)
+			}
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+
+		var steps []Step
+		for _, v := range versions {
+			mig, known := m.migration(v)
+			if !known {
+				return nil, fmt.Errorf("migration %d is applied but unknown to this build", v)
+			}
+			if mig.Down == nil {
+				return nil, fmt.Errorf("migration %d cannot be rolled back", v)
+			}
+			steps = append(steps, Step{Version: v, Description: mig.Description, Direction: DOWN})
+		}
+		return steps, nil
+	})
+}
+
+// migrate plans the steps under the lock, so the plan cannot be outdated by another instance, and
+// runs them one by one, recording each before the next
+func (m *Migrator) migrate(ctx context.Context, dryRun bool, plan func(map[int]applied) ([]Step, error)) ([]Step, error) {
+	if dryRun {
+		recorded, err := m.recorded(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return plan(recorded)
+	}
+
+	if err := m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.unlock()
+
+	recorded, err := m.recorded(ctx)
+	if err != nil {
+		return nil, err
+	}
+	steps, err := plan(recorded)
+	if err != nil {
+		return nil, err
+	}
+
+	for idx, s := range steps {
+		if idx > 0 {
+			if err := m.renew(ctx); err != nil {
+				return steps[:idx], err
+			}
+		}
+		if err := m.runLocked(ctx, s); err != nil {
+			return steps[:idx], fmt.Errorf("migration %s failed: %w", s, err)
+		}
+	}
+	return steps, nil
+}
+
+// runLocked keeps renewing the lock while s runs, a migration may take longer than LOCK_TTL. Once a
+// renewal fails the migration is cancelled, another instance may have taken over the lock.
+func (m *Migrator) runLocked(ctx context.Context, s Step) error {
+	stepCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	done := make(chan struct{})
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		ticker := time.NewTicker(m.ttl / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := m.renew(stepCtx); err != nil {
+					cancel(err)
+					return
+				}
+			}
+		}
+	}()
+
+	err := m.run(stepCtx, s)
+	close(done)
+	<-renewed
+
+	if err != nil && ctx.Err() == nil && context.Cause(stepCtx) != nil {
+		return context.Cause(stepCtx)
+	}
+	return err
+}
+
+func (m *Migrator) run(ctx context.Context, s Step) error {
+	mig, _ := m.migration(s.Version)
+
+	if s.Direction == DOWN {
+		if err := mig.Down(ctx, m.items); err != nil {
+			return err
+		}
+		_, err := m.applied.DeleteOne(ctx, bson.D{{Key: "_id", Value: s.Version}})
+		return err
+	}
+
+	if err := mig.Up(ctx, m.items); err != nil {
+		return err
+	}
+	_, err := m.applied.InsertOne(ctx, applied{Version: s.Version, Description: s.Description, AppliedOn: time.Now()})
+	return err
+}
+
+func (m *Migrator) migration(version int) (Migration, bool) {
+	for _, mig := range m.migrations {
+		if mig.Version == version {
+			return mig, true
+		}
+	}
+	return Migration{}, false
+}
+
+func (m *Migrator) recorded(ctx context.Context) (map[int]applied, error) {
+	cur, err := m.applied.Find(ctx, bson.D{})
+	if err != nil {
+		return nil, err
+	}
+
+	var all []applied
+	if err := cur.All(ctx, &all); err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]applied{}
+	for _, a := range all {
+		byVersion[a.Version] = a
+	}
+	return byVersion, nil
+}
+
+// lock inserts the lock document, or takes it over once it expired
+func (m *Migrator) lock(ctx context.Context) error {
+	now := time.Now()
+	_, err := m.locks.InsertOne(ctx, lock{Id: lockId, Owner: m.owner, ExpiresOn: now.Add(m.ttl)})
+	if !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+
+	res, err := m.locks.UpdateOne(ctx,
+		bson.D{{Key: "_id", Value: lockId}, {Key: "expiresOn", Value: bson.D{{Key: "$lt", Value: now}}}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "owner", Value: m.owner}, {Key: "expiresOn", Value: now.Add(m.ttl)}}}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrLocked
+	}
+	return nil
+}
+
+// renew extends the lock, failing when it expired and was taken over in the meantime
+func (m *Migrator) renew(ctx context.Context) error {
+	res, err := m.locks.UpdateOne(ctx,
+		bson.D{{Key: "_id", Value: lockId}, {Key: "owner", Value: m.owner}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "expiresOn", Value: time.Now().Add(m.ttl)}}}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("lost the migration lock: %w", ErrLocked)
+	}
+	return nil
+}
+
+// unlock runs even when ctx ended, a lock left behind would hold back other instances until it expires
+func (m *Migrator) unlock() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	m.locks.DeleteOne(ctx, bson.D{{Key: "_id", Value: lockId}, {Key: "owner", Value: m.owner}})
+}
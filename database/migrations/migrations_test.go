@@ -0,0 +1,251 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vivekmv23/go-web-frameworks/database/mongofake"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func newTestItems(t *testing.T) *mongo.Collection {
+	s, err := mongofake.Start()
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(s.URL()))
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Disconnect(context.Background()) })
+
+	items := client.Database("itemDB_test").Collection("items")
+	_, err = items.InsertMany(context.Background(), []any{
+		bson.D{{Key: "id", Value: uuid.NewString()}, {Key: "nam", Value: "a"}},
+		bson.D{{Key: "id", Value: uuid.NewString()}, {Key: "nam", Value: "b"}},
+	})
+	require.NoError(t, err)
+	return items
+}
+
+// setField adds field to every item on the way up and removes it on the way down
+func setField(version int, field string) Migration {
+	return Migration{
+		Version:     version,
+		Description: "add " + field,
+		Up: func(ctx context.Context, items *mongo.Collection) error {
+			_, err := items.UpdateMany(ctx, bson.D{}, bson.D{{Key: "$set", Value: bson.D{{Key: field, Value: version}}}})
+			return err
+		},
+		Down: func(ctx context.Context, items *mongo.Collection) error {
+			_, err := items.UpdateMany(ctx, bson.D{}, bson.D{{Key: "$unset", Value: bson.D{{Key: field, Value: ""}}}})
+			return err
+		},
+	}
+}
+
+// count finds instead of CountDocuments, which needs aggregate
+func count(t *testing.T, c *mongo.Collection, filter bson.D) int {
+	cur, err := c.Find(context.Background(), filter)
+	require.NoError(t, err)
+
+	var docs []bson.D
+	require.NoError(t, cur.All(context.Background(), &docs))
+	return len(docs)
+}
+
+func withField(t *testing.T, items *mongo.Collection, field string) int {
+	return count(t, items, bson.D{{Key: field, Value: bson.D{{Key: "$exists", Value: true}}}})
+}
+
+func TestUpAndDown(t *testing.T) {
+	ctx := context.Background()
+	items := newTestItems(t)
+	m, err := New(items, []Migration{setField(2, "tag"), setField(1, "ver")})
+	require.NoError(t, err)
+
+	steps, err := m.Up(ctx, 1, false)
+	require.NoError(t, err)
+	assert.Equal(t, []Step{{Version: 1, Description: "add ver", Direction: UP}}, steps)
+	assert.Equal(t, 2, withField(t, items, "ver"))
+	assert.Zero(t, withField(t, items, "tag"))
+
+	steps, err = m.Up(ctx, LATEST, false)
+	require.NoError(t, err)
+	assert.Equal(t, []Step{{Version: 2, Description: "add tag", Direction: UP}}, steps, "applied migrations are skipped")
+
+	status, err := m.Status(ctx)
+	require.NoError(t, err)
+	require.Len(t, status, 2)
+	assert.False(t, status[0].AppliedOn.IsZero())
+	assert.False(t, status[1].AppliedOn.IsZero())
+
+	steps, err = m.Down(ctx, 0, false)
+	require.NoError(t, err)
+	assert.Equal(t, []int{2, 1}, []int{steps[0].Version, steps[1].Version}, "newest first")
+	assert.Zero(t, withField(t, items, "ver"))
+	assert.Zero(t, withField(t, items, "tag"))
+
+	steps, err = m.Up(ctx, LATEST, false)
+	require.NoError(t, err)
+	assert.Len(t, steps, 2, "rolled back migrations are pending again")
+}
+
+func TestDryRunChangesNothing(t *testing.T) {
+	ctx := context.Background()
+	items := newTestItems(t)
+	m, err := New(items, []Migration{setField(1, "ver")})
+	require.NoError(t, err)
+
+	steps, err := m.Up(ctx, LATEST, true)
+	require.NoError(t, err)
+	assert.Len(t, steps, 1)
+	assert.Zero(t, withField(t, items, "ver"))
+
+	status, err := m.Status(ctx)
+	require.NoError(t, err)
+	assert.True(t, status[0].AppliedOn.IsZero())
+}
+
+func TestFailedMigrationIsNotRecorded(t *testing.T) {
+	ctx := context.Background()
+	items := newTestItems(t)
+	failing := Migration{Version: 2, Description: "fails", Up: func(context.Context, *mongo.Collection) error {
+		return errors.New("boom")
+	}}
+	m, err := New(items, []Migration{setField(1, "ver"), failing, setField(3, "tag")})
+	require.NoError(t, err)
+
+	steps, err := m.Up(ctx, LATEST, false)
+	assert.ErrorContains(t, err, "boom")
+	assert.Len(t, steps, 1, "only the migration before the failure ran")
+	assert.Zero(t, withField(t, items, "tag"))
+
+	steps, err = m.Up(ctx, LATEST, true)
+	require.NoError(t, err)
+	assert.Equal(t, 2, steps[0].Version)
+}
+
+func TestIrreversibleMigration(t *testing.T) {
+	ctx := context.Background()
+	oneWay := setField(1, "ver")
+	oneWay.Down = nil
+	m, err := New(newTestItems(t), []Migration{oneWay})
+	require.NoError(t, err)
+
+	_, err = m.Up(ctx, LATEST, false)
+	require.NoError(t, err)
+	_, err = m.Down(ctx, 0, false)
+	assert.ErrorContains(t, err, "cannot be rolled back")
+}
+
+func TestInvalidMigrations(t *testing.T) {
+	items := newTestItems(t)
+
+	_, err := New(items, []Migration{setField(1, "ver"), setField(1, "tag")})
+	assert.ErrorContains(t, err, "used twice")
+	_, err = New(items, []Migration{setField(0, "ver")})
+	assert.ErrorContains(t, err, "positive version")
+}
+
+func TestLock(t *testing.T) {
+	ctx := context.Background()
+	items := newTestItems(t)
+	locks := items.Database().Collection(LOCK_COLLECTION)
+	m, err := New(items, []Migration{setField(1, "ver")})
+	require.NoError(t, err)
+
+	_, err = locks.InsertOne(ctx, lock{Id: lockId, Owner: "other", ExpiresOn: time.Now().Add(time.Minute)})
+	require.NoError(t, err)
+
+	_, err = m.Up(ctx, LATEST, false)
+	assert.ErrorIs(t, err, ErrLocked)
+	assert.Zero(t, withField(t, items, "ver"))
+
+	_, err = locks.UpdateOne(ctx, bson.D{{Key: "_id", Value: lockId}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "expiresOn", Value: time.Now().Add(-time.Minute)}}}})
+	require.NoError(t, err)
+
+	_, err = m.Up(ctx, LATEST, false)
+	require.NoError(t, err, "an expired lock is taken over")
+	assert.Zero(t, count(t, locks, bson.D{}), "the lock is released")
+}
+
+// waitForCancel runs until its ctx ends, or fails after a while
+func waitForCancel(version int, started chan<- struct{}) Migration {
+	return Migration{
+		Version:     version,
+		Description: "wait",
+		Up: func(ctx context.Context, items *mongo.Collection) error {
+			close(started)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(5 * time.Second):
+				return errors.New("not cancelled")
+			}
+		},
+	}
+}
+
+func TestLockIsRenewedWhileMigrating(t *testing.T) {
+	ctx := context.Background()
+	items := newTestItems(t)
+	slow := setField(1, "ver")
+	up := slow.Up
+	slow.Up = func(ctx context.Context, items *mongo.Collection) error {
+		time.Sleep(300 * time.Millisecond)
+		return up(ctx, items)
+	}
+	m, err := New(items, []Migration{slow})
+	require.NoError(t, err)
+	m.ttl = 100 * time.Millisecond
+
+	other, err := New(items, []Migration{slow})
+	require.NoError(t, err)
+	other.ttl = m.ttl
+
+	result := make(chan error)
+	go func() {
+		_, err := m.Up(ctx, LATEST, false)
+		result <- err
+	}()
+
+	time.Sleep(200 * time.Millisecond)
+	_, err = other.Up(ctx, LATEST, false)
+	assert.ErrorIs(t, err, ErrLocked, "the lock is held past its ttl")
+
+	require.NoError(t, <-result)
+	assert.Equal(t, 2, withField(t, items, "ver"))
+}
+
+func TestLostLockCancelsMigration(t *testing.T) {
+	ctx := context.Background()
+	items := newTestItems(t)
+	locks := items.Database().Collection(LOCK_COLLECTION)
+	started := make(chan struct{})
+	m, err := New(items, []Migration{waitForCancel(1, started)})
+	require.NoError(t, err)
+	m.ttl = 60 * time.Millisecond
+
+	result := make(chan error)
+	go func() {
+		_, err := m.Up(ctx, LATEST, false)
+		result <- err
+	}()
+
+	<-started
+	_, err = locks.UpdateOne(ctx, bson.D{{Key: "_id", Value: lockId}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "owner", Value: "other"}}}})
+	require.NoError(t, err)
+
+	err = <-result
+	assert.ErrorIs(t, err, ErrLocked)
+	assert.ErrorContains(t, err, "lost the migration lock")
+	assert.Equal(t, 1, count(t, locks, bson.D{}), "the lock of the other owner is kept")
+}
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"time"
 
 	"github.com/google/uuid"
@@ -57,6 +58,13 @@ func (m *MockedDataBase) GetAllItems() ([]lib.Item, error) {
 	return items, m.err
 }
 
+func (m *MockedDataBase) GetItemCursor(ctx context.Context) (ItemCursor, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return NewSliceCursor([]lib.Item{i1, i2, i3}), nil
+}
+
 func (m *MockedDataBase) DeleteItemById(id uuid.UUID) error {
 	return m.err
 }
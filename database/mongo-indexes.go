@@ -0,0 +1,240 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// IndexDefinition is an index the application relies on, it is found by Name
+type IndexDefinition struct {
+	Name string
+	// Keys are bson keys of lib.Item with 1, -1 or "text"
+	Keys   bson.D
+	Unique bool
+}
+
+var (
+	// ItemIndexes make ids unique and back list filters, sorting and text search
+	ItemIndexes = []IndexDefinition{
+		{Name: "id_unique", Keys: bson.D{{Key: "id", Value: 1}}, Unique: true},
+		{Name: "active_created", Keys: bson.D{{Key: "act", Value: 1}, {Key: "con", Value: 1}}},
+		{Name: "updated", Keys: bson.D{{Key: "uon", Value: -1}}},
+		{Name: "name_description_text", Keys: bson.D{{Key: "nam", Value: "text"}, {Key: "dsc", Value: "text"}}},
+	}
+
+	// OutboxIndexes back the lookup of unpublished records by the relay
+	OutboxIndexes = []IndexDefinition{
+		{Name: "id_unique", Keys: bson.D{{Key: "id", Value: 1}}, Unique: true},
+		{Name: "pending", Keys: bson.D{{Key: "publishedOn", Value: 1}, {Key: "_id", Value: 1}}},
+	}
+)
+
+// IndexReport is the state of the indexes of a collection compared with their definitions
+type IndexReport struct {
+	Collection string
+	Created    []string
+	Unchanged  []string
+	// Missing is only filled when checking, ensuring creates them
+	Missing []string
+	// Drifted are defined indexes that exist with another spec, they are never changed automatically
+	Drifted []string
+	// Unmanaged indexes exist without a definition, they are left alone
+	Unmanaged []string
+}
+
+// InSync is true when every defined index exists as defined
+func (r IndexReport) InSync() bool {
+	return len(r.Missing) == 0 && len(r.Drifted) == 0
+}
+
+func (r IndexReport) String() string {
+	var parts []string
+	for _, p := range []struct {
+		label string
+		names []string
+	}{{"created", r.Created}, {"unchanged", r.Unchanged}, {"missing", r.Missing}, {"drifted", r.Drifted}, {"unmanaged", r.Unmanaged}} {
+		if len(p.names) > 0 {
+			parts = append(parts, fmt.Sprintf("%s: %s", p.label, strings.Join(p.names, ", ")))
+		}
+	}
+	return fmt.Sprintf("indexes of %s: %s", r.Collection, strings.Join(parts, "; "))
+}
+
+// EnsureIndexes creates the missing indexes of the items collection, and of the outbox when there is one.
+// It is idempotent, indexes that drifted from their definition are reported but not touched.
+func (d *Database) EnsureIndexes(ctx context.Context) ([]IndexReport, error) {
+	return d.syncIndexes(ctx, true)
+}
+
+// CheckIndexes reports how the indexes differ from their definitions without changing anything
+func (d *Database) CheckIndexes(ctx context.Context) ([]IndexReport, error) {
+	return d.syncIndexes(ctx, false)
+}
+
+func (d *Database) syncIndexes(ctx context.Context, create bool) ([]IndexReport, error) {
+	mc := d.getMongoCollection()
+
+	collections := []*mongo.Collection{mc}
+	definitions := [][]IndexDefinition{ItemIndexes}
+	if d.outbox_collection != "" {
+		collections = append(collections, mc.Database().Collection(d.outbox_collection))
+		definitions = append(definitions, OutboxIndexes)
+	}
+
+	var reports []IndexReport
+	for idx, c := range collections {
+		r, err := syncCollectionIndexes(ctx, c, definitions[idx], create)
+		reports = append(reports, r)
+		if err != nil {
+			return reports, err
+		}
+	}
+
+	return reports, nil
+}
+
+type existingIndex struct {
+	Name    string `bson:"name"`
+	Key     bson.D `bson:"key"`
+	Unique  bool   `bson:"unique"`
+	Weights bson.D `bson:"weights"`
+}
+
+func syncCollectionIndexes(ctx context.Context, c *mongo.Collection, definitions []IndexDefinition, create bool) (IndexReport, error) {
+	r := IndexReport{Collection: c.Name()}
+
+	existing, err := listIndexes(ctx, c)
+	if err != nil {
+		return r, err
+	}
+
+	defined := map[string]bool{"_id_": true}
+	for _, def := range definitions {
+		defined[def.Name] = true
+
+		found, exists := existing[def.Name]
+		switch {
+		case exists && sameSpec(def, found):
+			r.Unchanged = append(r.Unchanged, def.Name)
+		case exists:
+			r.Drifted = append(r.Drifted, def.Name)
+		case renamed(def, existing) != "":
+			// the server refuses a second index on the same keys
+			r.Drifted = append(r.Drifted, fmt.Sprintf("%s (exists as %s)", def.Name, renamed(def, existing)))
+		case !create:
+			r.Missing = append(r.Missing, def.Name)
+		default:
+			model := mongo.IndexModel{Keys: def.Keys, Options: options.Index().SetName(def.Name).SetUnique(def.Unique)}
+			if _, err := c.Indexes().CreateOne(ctx, model); err != nil {
+				return r, fmt.Errorf("failed to create index %s on %s: %w", def.Name, c.Name(), err)
+			}
+			r.Created = append(r.Created, def.Name)
+		}
+	}
+
+	for name := range existing {
+		if !defined[name] {
+			r.Unmanaged = append(r.Unmanaged, name)
+		}
+	}
+	sort.Strings(r.Unmanaged)
+
+	return r, nil
+}
+
+// renamed is the name of an index that matches def under another name
+func renamed(def IndexDefinition, existing map[string]existingIndex) string {
+	for name, found := range existing {
+		if name != def.Name && keyString(def.Keys) == keyString(textKeys(found)) {
+			return name
+		}
+	}
+	return ""
+}
+
+func listIndexes(ctx context.Context, c *mongo.Collection) (map[string]existingIndex, error) {
+	cur, err := c.Indexes().List(ctx)
+	if err != nil {
+		// a collection that does not exist yet has no indexes
+		var ce mongo.CommandError
+		if errors.As(err, &ce) && ce.Code == 26 {
+			return map[string]existingIndex{}, nil
+		}
+		return nil, err
+	}
+
+	var indexes []existingIndex
+	if err := cur.All(ctx, &indexes); err != nil {
+		return nil, err
+	}
+
+	byName := map[string]existingIndex{}
+	for _, i := range indexes {
+		byName[i.Name] = i
+	}
+	return byName, nil
+}
+
+// sameSpec compares a definition with an index as listed by the server, which lists a text index
+// as _fts and _ftsx keys with the text fields in its weights
+func sameSpec(def IndexDefinition, found existingIndex) bool {
+	if def.Unique != found.Unique {
+		return false
+	}
+	return keyString(def.Keys) == keyString(textKeys(found))
+}
+
+func textKeys(found existingIndex) bson.D {
+	var keys bson.D
+	for _, k := range found.Key {
+		switch k.Key {
+		case "_fts":
+			for _, w := range found.Weights {
+				keys = append(keys, bson.E{Key: w.Key, Value: "text"})
+			}
+		case "_ftsx":
+		default:
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// keyString normalizes keys so that 1 compares equal whatever its bson number type, text fields are
+// compared as a set since the server lists them sorted
+func keyString(keys bson.D) string {
+	var plain, text []string
+	for _, k := range keys {
+		switch v := k.Value.(type) {
+		case string:
+			text = append(text, k.Key)
+		case int, int32, int64, float64:
+			plain = append(plain, fmt.Sprintf("%s:%v", k.Key, toFloat(v)))
+		default:
+			plain = append(plain, fmt.Sprintf("%s:%v", k.Key, v))
+		}
+	}
+	sort.Strings(text)
+	return strings.Join(plain, ",") + "|" + strings.Join(text, ",")
+}
+
+func toFloat(v any) float64 {
+	switch n := v.(type) {
+	case int:
+		return float64(n)
+	case int32:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case float64:
+		return n
+	}
+	return 0
+}
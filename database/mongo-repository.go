@@ -4,11 +4,13 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/vivekmv23/go-web-frameworks/lib"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -22,42 +24,93 @@ type ItemDatabase interface {
 	SaveItem(i *lib.Item) error
 	GetItemById(id uuid.UUID) (lib.Item, error)
 	GetAllItems() ([]lib.Item, error)
+	GetItemCursor(ctx context.Context) (ItemCursor, error)
 	DeleteItemById(id uuid.UUID) error
 	UpdateItem(i lib.Item, ifMatch string) (lib.Item, error)
 }
 
+// Unwrap returns the store under d, decorators expose the store they wrap with an Unwrap method
+func Unwrap(d ItemDatabase) ItemDatabase {
+	for {
+		w, isDecorator := d.(interface{ Unwrap() ItemDatabase })
+		if !isDecorator {
+			return d
+		}
+		d = w.Unwrap()
+	}
+}
+
 type Database struct {
-	connection_url string
+	connection_url  string
+	db_name         string
+	collection_name string
+	// outbox_collection is empty unless writes record an OutboxRecord in the same transaction
+	outbox_collection string
+
+	// client is connected on first use and shared by every call, with its pool of connections
+	connect sync.Once
+	client  *mongo.Client
 }
 
 func NewDatabase() ItemDatabase {
+	return NewDatabaseWithUrl("mongodb://localhost:27017")
+}
+
+func NewDatabaseWithUrl(connection_url string) ItemDatabase {
+	return NewDatabaseWithNames(connection_url, ITEM_DB, ITEM_COLLECTION)
+}
+
+func NewDatabaseWithNames(connection_url, db_name, collection_name string) ItemDatabase {
 	return &Database{
-		connection_url: "mongodb://localhost:27017",
+		connection_url:  connection_url,
+		db_name:         db_name,
+		collection_name: collection_name,
 	}
 }
 
-func NewDatabaseWithUrl(connection_url string) ItemDatabase {
+// NewDatabaseWithOutbox records every write in outbox_collection within the same transaction, which needs a replica set
+func NewDatabaseWithOutbox(connection_url, db_name, collection_name, outbox_collection string) ItemDatabase {
 	return &Database{
-		connection_url: connection_url,
+		connection_url:    connection_url,
+		db_name:           db_name,
+		collection_name:   collection_name,
+		outbox_collection: outbox_collection,
 	}
 }
 
 func (d *Database) getMongoCollection() *mongo.Collection {
+	d.connect.Do(func() {
+		// Production ready application should ideally form the URI with credentials from ENV variables
+		client, err := mongo.Connect(context.TODO(), options.Client().ApplyURI(d.connection_url))
+		if err != nil {
+			log.Printf("ERROR: failed to get mongo client: %s", err)
+		}
+		d.client = client
+	})
+
+	return d.client.Database(d.db_name).Collection(d.collection_name)
+}
 
-	// Production ready application should ideally form the URI with credentials from ENV variables
-	client, err := mongo.Connect(context.TODO(), options.Client(), options.Client().ApplyURI(d.connection_url))
-
-	if err != nil {
-		log.Printf("ERROR: failed to get mongo client: %s", err)
+// Close disconnects the shared client, the store can not be used afterwards
+func (d *Database) Close() error {
+	// a store that never connected has nothing to close, and must not connect any more
+	d.connect.Do(func() {})
+	if d.client == nil {
+		return nil
 	}
-
-	return client.Database(ITEM_DB).Collection(ITEM_COLLECTION)
+	return d.client.Disconnect(context.Background())
 }
 
 func (d *Database) SaveItem(i *lib.Item) error {
 	mc := d.getMongoCollection()
 	determinations(i)
-	_, err := mc.InsertOne(context.TODO(), i)
+
+	err := d.inTransaction(mc, func(ctx context.Context) error {
+		if _, err := mc.InsertOne(ctx, i); err != nil {
+			return err
+		}
+		return d.appendOutbox(ctx, mc, OUTBOX_ITEM_CREATED, *i)
+	})
 
 	return mapDbError(err)
 
@@ -93,14 +146,66 @@ func (d *Database) GetAllItems() ([]lib.Item, error) {
 
 }
 
-func (d *Database) DeleteItemById(id uuid.UUID) error {
+func (d *Database) GetItemCursor(ctx context.Context) (ItemCursor, error) {
 	mc := d.getMongoCollection()
 
-	res, err := mc.DeleteOne(context.TODO(), bson.D{{Key: "id", Value: id}})
-	if res.DeletedCount == 0 {
-		err = mongo.ErrNoDocuments
+	cur, err := mc.Find(ctx, bson.D{{}})
+	if err != nil {
+		return nil, mapDbError(err)
 	}
 
+	return &mongoCursor{cur: cur}, nil
+}
+
+// mongoCursor decodes one document at a time, the driver fetches them from the server in batches
+type mongoCursor struct {
+	cur  *mongo.Cursor
+	item lib.Item
+	err  error
+}
+
+func (c *mongoCursor) Next(ctx context.Context) bool {
+	if c.err != nil || !c.cur.Next(ctx) {
+		return false
+	}
+
+	c.item = lib.Item{}
+	if err := c.cur.Decode(&c.item); err != nil {
+		c.err = mapDbError(err)
+		return false
+	}
+	return true
+}
+
+func (c *mongoCursor) Item() lib.Item {
+	return c.item
+}
+
+func (c *mongoCursor) Err() error {
+	if c.err != nil {
+		return c.err
+	}
+	return mapDbError(c.cur.Err())
+}
+
+func (c *mongoCursor) Close(ctx context.Context) error {
+	return mapDbError(c.cur.Close(ctx))
+}
+
+func (d *Database) DeleteItemById(id uuid.UUID) error {
+	mc := d.getMongoCollection()
+
+	err := d.inTransaction(mc, func(ctx context.Context) error {
+		res, err := mc.DeleteOne(ctx, bson.D{{Key: "id", Value: id}})
+		if err != nil {
+			return err
+		}
+		if res.DeletedCount == 0 {
+			return mongo.ErrNoDocuments
+		}
+		return d.appendOutbox(ctx, mc, OUTBOX_ITEM_DELETED, lib.Item{Id: id})
+	})
+
 	return mapDbError(err, id)
 }
 
@@ -131,16 +236,135 @@ func (d *Database) UpdateItem(i lib.Item, ifMatch string) (lib.Item, error) {
 	filter := bson.D{{Key: "_id", Value: i.DbId}}
 	update := bson.D{{Key: "$set", Value: iDoc}}
 
-	res, err := mc.UpdateOne(context.TODO(), filter, update)
+	err = d.inTransaction(mc, func(ctx context.Context) error {
+		res, err := mc.UpdateOne(ctx, filter, update)
+		if err != nil {
+			return err
+		}
+		if res.ModifiedCount != 1 {
+			return fmt.Errorf("failed to update, updated count != 1")
+		}
+		return d.appendOutbox(ctx, mc, OUTBOX_ITEM_UPDATED, i)
+	})
+
+	return i, mapDbError(err)
+}
+
+// inTransaction runs fn in a transaction when writes go through the outbox, and on its own otherwise
+func (d *Database) inTransaction(mc *mongo.Collection, fn func(ctx context.Context) error) error {
+	if d.outbox_collection == "" {
+		return fn(context.TODO())
+	}
+
+	session, err := mc.Database().Client().StartSession()
 	if err != nil {
-		return i, mapDbError(err)
+		return err
+	}
+	defer session.EndSession(context.TODO())
+
+	_, err = session.WithTransaction(context.TODO(), func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
+
+func (d *Database) appendOutbox(ctx context.Context, mc *mongo.Collection, changeType string, i lib.Item) error {
+	if d.outbox_collection == "" {
+		return nil
 	}
 
-	if res.ModifiedCount == 1 {
-		return i, nil
+	_, err := mc.Database().Collection(d.outbox_collection).InsertOne(ctx, newOutboxRecord(changeType, i))
+	return err
+}
+
+func (d *Database) PendingOutbox(ctx context.Context, limit int) ([]OutboxRecord, error) {
+	if d.outbox_collection == "" {
+		return nil, errOutboxDisabled
+	}
+
+	oc := d.getMongoCollection().Database().Collection(d.outbox_collection)
+
+	filter := bson.D{{Key: "publishedOn", Value: bson.D{{Key: "$exists", Value: false}}}}
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(int64(limit))
+
+	cur, err := oc.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, mapDbError(err)
 	}
 
-	return i, fmt.Errorf("failed to update, updated count != 1")
+	records := []OutboxRecord{}
+	err = cur.All(ctx, &records)
+	return records, mapDbError(err)
+}
+
+// MarkPublished keeps the records so that the outbox doubles as a log of the changes
+func (d *Database) MarkPublished(ctx context.Context, ids []uuid.UUID) error {
+	if d.outbox_collection == "" {
+		return errOutboxDisabled
+	}
+
+	oc := d.getMongoCollection().Database().Collection(d.outbox_collection)
+
+	filter := bson.D{{Key: "id", Value: bson.D{{Key: "$in", Value: ids}}}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "publishedOn", Value: time.Now()}}}}
+
+	_, err := oc.UpdateMany(ctx, filter, update)
+	return mapDbError(err)
+}
+
+// Change is a write reported by a change stream
+type Change struct {
+	// Operation is the Mongo operation type such as insert, update, replace or delete
+	Operation string
+	Item      lib.Item
+}
+
+type changeEvent struct {
+	OperationType            string    `bson:"operationType"`
+	FullDocument             *lib.Item `bson:"fullDocument"`
+	FullDocumentBeforeChange *lib.Item `bson:"fullDocumentBeforeChange"`
+	DocumentKey              struct {
+		DbId primitive.ObjectID `bson:"_id"`
+	} `bson:"documentKey"`
+}
+
+// WatchChanges calls fn for every write to the collection until ctx ends or the change stream fails,
+// which needs a replica set. Deleted items carry only their DbId unless the collection records pre-images.
+func (d *Database) WatchChanges(ctx context.Context, fn func(Change)) error {
+	mc := d.getMongoCollection()
+
+	opts := options.ChangeStream().
+		SetFullDocument(options.UpdateLookup).
+		SetFullDocumentBeforeChange(options.WhenAvailable)
+
+	cs, err := mc.Watch(ctx, mongo.Pipeline{}, opts)
+	if err != nil {
+		return mapDbError(err)
+	}
+	defer cs.Close(context.Background())
+
+	for cs.Next(ctx) {
+		var ce changeEvent
+		if err := cs.Decode(&ce); err != nil {
+			return mapDbError(err)
+		}
+
+		c := Change{Operation: ce.OperationType}
+		switch {
+		case ce.FullDocument != nil:
+			c.Item = *ce.FullDocument
+		case ce.FullDocumentBeforeChange != nil:
+			c.Item = *ce.FullDocumentBeforeChange
+		default:
+			c.Item = lib.Item{DbId: ce.DocumentKey.DbId}
+		}
+		fn(c)
+	}
+
+	if ctx.Err() != nil {
+		return nil
+	}
+	return mapDbError(cs.Err())
 }
 
 func mapDbError(err error, arg ...any) error {
@@ -166,7 +390,8 @@ func determinations(i *lib.Item) {
 		i.Id = uuid.New()
 	}
 
-	now := time.Now()
+	// strip the monotonic clock reading so that Etag strings survive a round trip
+	now := time.Now().Round(0)
 	if i.CreatedOn.IsZero() {
 		i.CreatedOn = now
 	}
@@ -0,0 +1,119 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vivekmv23/go-web-frameworks/database/mongofake"
+	"github.com/vivekmv23/go-web-frameworks/lib"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// the contract of ItemDatabase is covered by TestMongoConformance, these cover what needs a replica set
+
+func startMongoFake(t *testing.T) string {
+	s, err := mongofake.Start()
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	return s.URL()
+}
+
+func TestMongoSharesOneClient(t *testing.T) {
+	s, err := mongofake.Start()
+	require.NoError(t, err)
+	defer s.Close()
+	d := NewDatabaseWithOutbox(s.URL(), "itemDB_test", "items", "outbox").(*Database)
+	ctx := context.Background()
+
+	for range 20 {
+		_, err := d.GetAllItems()
+		require.NoError(t, err)
+		_, err = d.PendingOutbox(ctx, 10)
+		require.NoError(t, err)
+
+		c, err := d.GetItemCursor(ctx)
+		require.NoError(t, err)
+		require.NoError(t, c.Close(ctx))
+		// fails without a replica set, after going through the shared client
+		d.WatchChanges(ctx, func(Change) {})
+	}
+	assert.LessOrEqual(t, s.Connections(), 3, "a monitor, an rtt monitor and a pooled connection")
+
+	require.NoError(t, d.Close())
+	assert.Eventually(t, func() bool { return s.Connections() == 0 }, time.Second, 10*time.Millisecond)
+}
+
+func TestMongoOutboxNeedsReplicaSet(t *testing.T) {
+	d := NewDatabaseWithOutbox(startMongoFake(t), "itemDB_test", "items", "outbox").(*Database)
+	t.Cleanup(func() { d.Close() })
+
+	i := lib.Item{Name: "in a transaction"}
+	err := d.SaveItem(&i)
+
+	require.IsType(t, &Unclassified{}, err)
+	assert.ErrorContains(t, err, "replica set")
+	items, err := d.GetAllItems()
+	require.NoError(t, err)
+	assert.Empty(t, items, "nothing is written outside of the transaction")
+}
+
+func TestMongoWatchChangesNeedsReplicaSet(t *testing.T) {
+	d := NewDatabaseWithNames(startMongoFake(t), "itemDB_test", "items").(*Database)
+	t.Cleanup(func() { d.Close() })
+
+	err := d.WatchChanges(context.Background(), func(Change) {})
+
+	require.IsType(t, &Unclassified{}, err)
+	assert.ErrorContains(t, err, "replica sets")
+}
+
+func TestMongoEnsureIndexes(t *testing.T) {
+	ctx := context.Background()
+	d := NewDatabaseWithNames(startMongoFake(t), "itemDB_test", "items").(*Database)
+	t.Cleanup(func() { d.Close() })
+
+	reports, err := d.CheckIndexes(ctx)
+	require.NoError(t, err)
+	require.Len(t, reports, 1)
+	assert.Len(t, reports[0].Missing, len(ItemIndexes))
+	assert.False(t, reports[0].InSync())
+
+	reports, err = d.EnsureIndexes(ctx)
+	require.NoError(t, err)
+	assert.Len(t, reports[0].Created, len(ItemIndexes))
+
+	reports, err = d.EnsureIndexes(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, reports[0].Created, "a second run changes nothing")
+	assert.Len(t, reports[0].Unchanged, len(ItemIndexes))
+	assert.True(t, reports[0].InSync())
+}
+
+func TestMongoIndexDrift(t *testing.T) {
+	ctx := context.Background()
+	d := NewDatabaseWithNames(startMongoFake(t), "itemDB_test", "items").(*Database)
+	t.Cleanup(func() { d.Close() })
+	indexes := d.getMongoCollection().Indexes()
+
+	_, err := indexes.CreateMany(ctx, []mongo.IndexModel{
+		// not unique as it is defined
+		{Keys: bson.D{{Key: "id", Value: 1}}, Options: options.Index().SetName("id_unique")},
+		{Keys: bson.D{{Key: "uon", Value: -1}}, Options: options.Index().SetName("uon_-1")},
+		{Keys: bson.D{{Key: "nam", Value: 1}}, Options: options.Index().SetName("by_name")},
+	})
+	require.NoError(t, err)
+
+	reports, err := d.EnsureIndexes(ctx)
+	require.NoError(t, err)
+
+	r := reports[0]
+	assert.Equal(t, []string{"active_created", "name_description_text"}, r.Created)
+	assert.Equal(t, []string{"id_unique", "updated (exists as uon_-1)"}, r.Drifted)
+	assert.Equal(t, []string{"by_name", "uon_-1"}, r.Unmanaged)
+	assert.False(t, r.InSync())
+}
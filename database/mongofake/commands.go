@@ -0,0 +1,912 @@
+package mongofake
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// error codes of a real server that the driver and this repository look at
+const (
+	CODE_BAD_VALUE                = 2
+	CODE_ILLEGAL_OPERATION        = 20
+	CODE_NAMESPACE_NOT_FOUND      = 26
+	CODE_INDEX_NOT_FOUND          = 27
+	CODE_CURSOR_NOT_FOUND         = 43
+	CODE_COMMAND_NOT_FOUND        = 59
+	CODE_IMMUTABLE_FIELD          = 66
+	CODE_INDEX_KEY_SPECS_CONFLICT = 86
+	CODE_DUPLICATE_KEY            = 11000
+	CODE_CHANGE_STREAM_STANDALONE = 40573
+)
+
+type commandError struct {
+	Code    int
+	Message string
+}
+
+func (e *commandError) Error() string {
+	return e.Message
+}
+
+func errorReply(code int, format string, args ...any) bson.D {
+	return bson.D{
+		{Key: "ok", Value: 0.0},
+		{Key: "errmsg", Value: fmt.Sprintf(format, args...)},
+		{Key: "code", Value: int32(code)},
+	}
+}
+
+func okReply(fields ...bson.E) bson.D {
+	return append(bson.D(fields), bson.E{Key: "ok", Value: 1.0})
+}
+
+type index struct {
+	Name   string
+	Key    bson.D
+	Unique bool
+}
+
+type collection struct {
+	docs    []bson.Raw
+	indexes []index
+}
+
+func newCollection() *collection {
+	return &collection{indexes: []index{{Name: "_id_", Key: bson.D{{Key: "_id", Value: int32(1)}}, Unique: true}}}
+}
+
+// store holds the collections of every database by namespace, db.collection
+type store struct {
+	mu          sync.Mutex
+	collections map[string]*collection
+}
+
+func newStore() *store {
+	return &store{collections: map[string]*collection{}}
+}
+
+func lookup(cmd bson.D, key string) (any, bool) {
+	for _, e := range cmd {
+		if e.Key == key {
+			return e.Value, true
+		}
+	}
+	return nil, false
+}
+
+func lookupString(cmd bson.D, key string) string {
+	v, _ := lookup(cmd, key)
+	s, _ := v.(string)
+	return s
+}
+
+func asInt(v any) int64 {
+	switch n := v.(type) {
+	case int32:
+		return int64(n)
+	case int64:
+		return n
+	case float64:
+		return int64(n)
+	case bool:
+		if n {
+			return 1
+		}
+	}
+	return 0
+}
+
+func asBool(v any) bool {
+	return asInt(v) != 0
+}
+
+func toRaw(v any) (bson.Raw, error) {
+	if v == nil {
+		return bson.Marshal(bson.D{})
+	}
+	return bson.Marshal(v)
+}
+
+func (s *Server) run(cmd bson.D) bson.D {
+	if len(cmd) == 0 {
+		return errorReply(CODE_BAD_VALUE, "empty command")
+	}
+
+	name := cmd[0].Key
+	db := lookupString(cmd, "$db")
+	ns := db + "." + fmt.Sprint(cmd[0].Value)
+
+	if _, inTransaction := lookup(cmd, "startTransaction"); inTransaction {
+		return errorReply(CODE_ILLEGAL_OPERATION, "Transaction numbers are only allowed on a replica set member or mongos")
+	}
+	if _, inTransaction := lookup(cmd, "autocommit"); inTransaction {
+		return errorReply(CODE_ILLEGAL_OPERATION, "Transaction numbers are only allowed on a replica set member or mongos")
+	}
+
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	var (
+		reply bson.D
+		err   error
+	)
+	switch name {
+	case "hello", "isMaster", "ismaster":
+		reply = hello()
+	case "ping", "endSessions", "killCursors":
+		reply = okReply()
+	case "buildInfo", "buildinfo":
+		reply = okReply(bson.E{Key: "version", Value: "6.0.0"}, bson.E{Key: "versionArray", Value: bson.A{int32(6), int32(0), int32(0), int32(0)}})
+	case "insert":
+		reply, err = s.store.insert(ns, cmd)
+	case "find":
+		reply, err = s.store.find(ns, cmd)
+	case "update":
+		reply, err = s.store.update(ns, cmd)
+	case "delete":
+		reply, err = s.store.delete(ns, cmd)
+	case "createIndexes":
+		reply, err = s.store.createIndexes(ns, cmd)
+	case "listIndexes":
+		reply, err = s.store.listIndexes(ns)
+	case "dropIndexes":
+		reply, err = s.store.dropIndexes(ns, cmd)
+	case "drop":
+		delete(s.store.collections, ns)
+		reply = okReply()
+	case "aggregate":
+		err = aggregate(cmd)
+	case "getMore":
+		err = &commandError{Code: CODE_CURSOR_NOT_FOUND, Message: "cursor not found, every batch is the first and last"}
+	default:
+		err = &commandError{Code: CODE_COMMAND_NOT_FOUND, Message: fmt.Sprintf("no such command: '%s'", name)}
+	}
+
+	if err != nil {
+		if ce, isCommandError := err.(*commandError); isCommandError {
+			return errorReply(ce.Code, "%s", ce.Message)
+		}
+		return errorReply(CODE_BAD_VALUE, "%s", err)
+	}
+	return reply
+}
+
+func hello() bson.D {
+	return okReply(
+		bson.E{Key: "helloOk", Value: true},
+		bson.E{Key: "isWritablePrimary", Value: true},
+		bson.E{Key: "ismaster", Value: true},
+		bson.E{Key: "maxBsonObjectSize", Value: int32(16 * 1024 * 1024)},
+		bson.E{Key: "maxMessageSizeBytes", Value: int32(maxMessageSize)},
+		bson.E{Key: "maxWriteBatchSize", Value: int32(100_000)},
+		bson.E{Key: "localTime", Value: time.Now()},
+		bson.E{Key: "logicalSessionTimeoutMinutes", Value: int32(30)},
+		bson.E{Key: "connectionId", Value: int32(1)},
+		bson.E{Key: "minWireVersion", Value: int32(0)},
+		bson.E{Key: "maxWireVersion", Value: int32(17)},
+		bson.E{Key: "readOnly", Value: false},
+	)
+}
+
+func aggregate(cmd bson.D) error {
+	if pipeline, isArray := lookupArray(cmd, "pipeline"); isArray && len(pipeline) > 0 {
+		if stage, isDoc := pipeline[0].(bson.D); isDoc && len(stage) > 0 && stage[0].Key == "$changeStream" {
+			return &commandError{Code: CODE_CHANGE_STREAM_STANDALONE, Message: "The $changeStream stage is only supported on replica sets"}
+		}
+	}
+	return &commandError{Code: CODE_COMMAND_NOT_FOUND, Message: "aggregate is not supported by mongofake"}
+}
+
+func lookupArray(cmd bson.D, key string) (bson.A, bool) {
+	v, _ := lookup(cmd, key)
+	a, isArray := v.(bson.A)
+	return a, isArray
+}
+
+func lookupDoc(cmd bson.D, key string) (bson.Raw, error) {
+	v, _ := lookup(cmd, key)
+	return toRaw(v)
+}
+
+func (st *store) insert(ns string, cmd bson.D) (bson.D, error) {
+	docs, _ := lookupArray(cmd, "documents")
+	c := st.collection(ns)
+
+	var writeErrors bson.A
+	n := int32(0)
+	for idx, v := range docs {
+		doc, err := toRaw(v)
+		if err != nil {
+			return nil, err
+		}
+		if doc, err = withId(doc); err != nil {
+			return nil, err
+		}
+		if err := c.checkUnique(doc, -1); err != nil {
+			writeErrors = append(writeErrors, writeError(idx, err))
+			break
+		}
+		c.docs = append(c.docs, doc)
+		n++
+	}
+
+	return withWriteErrors(okReply(bson.E{Key: "n", Value: n}), writeErrors), nil
+}
+
+func writeError(idx int, err *commandError) bson.D {
+	return bson.D{{Key: "index", Value: int32(idx)}, {Key: "code", Value: int32(err.Code)}, {Key: "errmsg", Value: err.Message}}
+}
+
+func withWriteErrors(reply bson.D, writeErrors bson.A) bson.D {
+	if len(writeErrors) == 0 {
+		return reply
+	}
+	return append(bson.D{{Key: "writeErrors", Value: writeErrors}}, reply...)
+}
+
+// withId adds an ObjectID _id in front of a document that has none, like the server does
+func withId(doc bson.Raw) (bson.Raw, error) {
+	if _, err := doc.LookupErr("_id"); err == nil {
+		return doc, nil
+	}
+
+	var d bson.D
+	if err := bson.Unmarshal(doc, &d); err != nil {
+		return nil, err
+	}
+	return bson.Marshal(append(bson.D{{Key: "_id", Value: primitive.NewObjectID()}}, d...))
+}
+
+// collection returns the collection at ns, creating it like the first write to it does on a server
+func (st *store) collection(ns string) *collection {
+	c, exists := st.collections[ns]
+	if !exists {
+		c = newCollection()
+		st.collections[ns] = c
+	}
+	return c
+}
+
+func (st *store) find(ns string, cmd bson.D) (bson.D, error) {
+	filter, err := lookupDoc(cmd, "filter")
+	if err != nil {
+		return nil, err
+	}
+
+	var matched []bson.Raw
+	if c, exists := st.collections[ns]; exists {
+		for _, doc := range c.docs {
+			m, err := matches(doc, filter)
+			if err != nil {
+				return nil, err
+			}
+			if m {
+				matched = append(matched, doc)
+			}
+		}
+	}
+
+	if spec, hasSort := lookup(cmd, "sort"); hasSort {
+		if err := sortDocs(matched, spec); err != nil {
+			return nil, err
+		}
+	}
+
+	if v, hasSkip := lookup(cmd, "skip"); hasSkip {
+		matched = matched[min(int(asInt(v)), len(matched)):]
+	}
+	if v, hasLimit := lookup(cmd, "limit"); hasLimit {
+		if limit := int(asInt(v)); limit > 0 && limit < len(matched) {
+			matched = matched[:limit]
+		}
+	}
+
+	batch := bson.A{}
+	for _, doc := range matched {
+		batch = append(batch, doc)
+	}
+
+	return cursorReply(ns, batch), nil
+}
+
+func cursorReply(ns string, batch bson.A) bson.D {
+	return okReply(bson.E{Key: "cursor", Value: bson.D{
+		{Key: "firstBatch", Value: batch},
+		{Key: "id", Value: int64(0)},
+		{Key: "ns", Value: ns},
+	}})
+}
+
+func (st *store) update(ns string, cmd bson.D) (bson.D, error) {
+	updates, _ := lookupArray(cmd, "updates")
+	c := st.collection(ns)
+
+	var (
+		writeErrors  bson.A
+		upserted     bson.A
+		n, nModified int32
+	)
+
+updates:
+	for idx, v := range updates {
+		var u bson.D
+		raw, err := toRaw(v)
+		if err != nil {
+			return nil, err
+		}
+		if err := bson.Unmarshal(raw, &u); err != nil {
+			return nil, err
+		}
+
+		q, err := lookupDoc(u, "q")
+		if err != nil {
+			return nil, err
+		}
+		change, _ := lookup(u, "u")
+		multi, _ := lookup(u, "multi")
+		upsert, _ := lookup(u, "upsert")
+
+		found := false
+		for pos, doc := range c.docs {
+			m, err := matches(doc, q)
+			if err != nil {
+				return nil, err
+			}
+			if !m {
+				continue
+			}
+			found = true
+
+			updated, err := apply(doc, change)
+			if err != nil {
+				return nil, err
+			}
+			if cerr := c.checkUnique(updated, pos); cerr != nil {
+				writeErrors = append(writeErrors, writeError(idx, cerr))
+				break updates
+			}
+
+			n++
+			if !bytes.Equal(doc, updated) {
+				c.docs[pos] = updated
+				nModified++
+			}
+			if !asBool(multi) {
+				break
+			}
+		}
+
+		if !found && asBool(upsert) {
+			doc, err := upsertDoc(q, change)
+			if err != nil {
+				return nil, err
+			}
+			if cerr := c.checkUnique(doc, -1); cerr != nil {
+				writeErrors = append(writeErrors, writeError(idx, cerr))
+				break
+			}
+			c.docs = append(c.docs, doc)
+			n++
+			upserted = append(upserted, bson.D{{Key: "index", Value: int32(idx)}, {Key: "_id", Value: doc.Lookup("_id")}})
+		}
+	}
+
+	reply := okReply(bson.E{Key: "n", Value: n}, bson.E{Key: "nModified", Value: nModified})
+	if len(upserted) > 0 {
+		reply = append(bson.D{{Key: "upserted", Value: upserted}}, reply...)
+	}
+	return withWriteErrors(reply, writeErrors), nil
+}
+
+// apply runs a $set and $unset update or replaces the document, keeping its _id either way
+func apply(doc bson.Raw, change any) (bson.Raw, error) {
+	u, isDoc := change.(bson.D)
+	if !isDoc {
+		return nil, fmt.Errorf("update must be a document, pipelines are not supported")
+	}
+
+	var d bson.D
+	if err := bson.Unmarshal(doc, &d); err != nil {
+		return nil, err
+	}
+	id, _ := lookup(d, "_id")
+
+	if len(u) == 0 || !strings.HasPrefix(u[0].Key, "$") {
+		if newId, hasId := lookup(u, "_id"); hasId && fmt.Sprint(newId) != fmt.Sprint(id) {
+			return nil, &commandError{Code: CODE_IMMUTABLE_FIELD, Message: "the _id field cannot be changed"}
+		}
+		replacement := bson.D{{Key: "_id", Value: id}}
+		for _, e := range u {
+			if e.Key != "_id" {
+				replacement = append(replacement, e)
+			}
+		}
+		return bson.Marshal(replacement)
+	}
+
+	for _, op := range u {
+		if op.Key != "$set" && op.Key != "$unset" {
+			return nil, fmt.Errorf("update operator %s is not supported", op.Key)
+		}
+		fields, isDoc := op.Value.(bson.D)
+		if !isDoc {
+			return nil, fmt.Errorf("%s needs a document", op.Key)
+		}
+		for _, f := range fields {
+			if strings.Contains(f.Key, ".") {
+				return nil, fmt.Errorf("%s of nested field %s is not supported", op.Key, f.Key)
+			}
+			if f.Key == "_id" && (op.Key == "$unset" || fmt.Sprint(f.Value) != fmt.Sprint(id)) {
+				return nil, &commandError{Code: CODE_IMMUTABLE_FIELD, Message: "the _id field cannot be changed"}
+			}
+			if op.Key == "$unset" {
+				d = unset(d, f.Key)
+			} else {
+				d = set(d, f)
+			}
+		}
+	}
+
+	return bson.Marshal(d)
+}
+
+func set(d bson.D, f bson.E) bson.D {
+	for idx := range d {
+		if d[idx].Key == f.Key {
+			d[idx].Value = f.Value
+			return d
+		}
+	}
+	return append(d, f)
+}
+
+func unset(d bson.D, key string) bson.D {
+	for idx := range d {
+		if d[idx].Key == key {
+			return append(d[:idx], d[idx+1:]...)
+		}
+	}
+	return d
+}
+
+// upsertDoc builds the document an upsert inserts from the equality conditions of q and the update
+func upsertDoc(q bson.Raw, change any) (bson.Raw, error) {
+	var seed bson.D
+	var conditions bson.D
+	if err := bson.Unmarshal(q, &conditions); err != nil {
+		return nil, err
+	}
+	for _, e := range conditions {
+		if _, isOperator := e.Value.(bson.D); !isOperator && !strings.HasPrefix(e.Key, "$") {
+			seed = append(seed, e)
+		}
+	}
+
+	doc, err := bson.Marshal(seed)
+	if err != nil {
+		return nil, err
+	}
+	if doc, err = withId(doc); err != nil {
+		return nil, err
+	}
+	return apply(doc, change)
+}
+
+func (st *store) delete(ns string, cmd bson.D) (bson.D, error) {
+	deletes, _ := lookupArray(cmd, "deletes")
+	c, exists := st.collections[ns]
+
+	n := int32(0)
+	for _, v := range deletes {
+		if !exists {
+			break
+		}
+
+		var d bson.D
+		raw, err := toRaw(v)
+		if err != nil {
+			return nil, err
+		}
+		if err := bson.Unmarshal(raw, &d); err != nil {
+			return nil, err
+		}
+
+		q, err := lookupDoc(d, "q")
+		if err != nil {
+			return nil, err
+		}
+		limit, _ := lookup(d, "limit")
+
+		kept, deleted := c.docs[:0], 0
+		for _, doc := range c.docs {
+			m, err := matches(doc, q)
+			if err != nil {
+				return nil, err
+			}
+			if m && (asInt(limit) == 0 || deleted == 0) {
+				deleted++
+				continue
+			}
+			kept = append(kept, doc)
+		}
+		c.docs = kept
+		n += int32(deleted)
+	}
+
+	return okReply(bson.E{Key: "n", Value: n}), nil
+}
+
+func (st *store) createIndexes(ns string, cmd bson.D) (bson.D, error) {
+	specs, _ := lookupArray(cmd, "indexes")
+
+	_, existed := st.collections[ns]
+	c := st.collection(ns)
+	before := len(c.indexes)
+
+	for _, v := range specs {
+		var spec bson.D
+		raw, err := toRaw(v)
+		if err != nil {
+			return nil, err
+		}
+		if err := bson.Unmarshal(raw, &spec); err != nil {
+			return nil, err
+		}
+
+		key, _ := lookup(spec, "key")
+		keyDoc, isDoc := key.(bson.D)
+		if !isDoc || len(keyDoc) == 0 {
+			return nil, fmt.Errorf("index key must be a non-empty document")
+		}
+		unique, _ := lookup(spec, "unique")
+		idx := index{Name: lookupString(spec, "name"), Key: keyDoc, Unique: asBool(unique)}
+
+		if existing, found := c.index(idx.Name); found {
+			if !sameIndex(existing, idx) {
+				return nil, &commandError{Code: CODE_INDEX_KEY_SPECS_CONFLICT, Message: fmt.Sprintf("an existing index has the same name as the requested index: %s", idx.Name)}
+			}
+			continue
+		}
+
+		if idx.Unique {
+			seen := map[string]bool{}
+			for _, doc := range c.docs {
+				k := indexKey(doc, idx.Key)
+				if seen[k] {
+					return nil, &commandError{Code: CODE_DUPLICATE_KEY, Message: fmt.Sprintf("E11000 duplicate key error collection: %s index: %s", ns, idx.Name)}
+				}
+				seen[k] = true
+			}
+		}
+
+		c.indexes = append(c.indexes, idx)
+	}
+
+	return okReply(
+		bson.E{Key: "createdCollectionAutomatically", Value: !existed},
+		bson.E{Key: "numIndexesBefore", Value: int32(before)},
+		bson.E{Key: "numIndexesAfter", Value: int32(len(c.indexes))},
+	), nil
+}
+
+func sameIndex(a index, b index) bool {
+	ka, _ := bson.Marshal(a.Key)
+	kb, _ := bson.Marshal(b.Key)
+	return a.Unique == b.Unique && bytes.Equal(ka, kb)
+}
+
+func (c *collection) index(name string) (index, bool) {
+	for _, idx := range c.indexes {
+		if idx.Name == name {
+			return idx, true
+		}
+	}
+	return index{}, false
+}
+
+func (st *store) listIndexes(ns string) (bson.D, error) {
+	c, exists := st.collections[ns]
+	if !exists {
+		return nil, &commandError{Code: CODE_NAMESPACE_NOT_FOUND, Message: fmt.Sprintf("ns does not exist: %s", ns)}
+	}
+
+	batch := bson.A{}
+	for _, idx := range c.indexes {
+		spec := bson.D{{Key: "v", Value: int32(2)}, {Key: "key", Value: idx.Key}, {Key: "name", Value: idx.Name}}
+		if idx.Unique && idx.Name != "_id_" {
+			spec = append(spec, bson.E{Key: "unique", Value: true})
+		}
+		batch = append(batch, spec)
+	}
+
+	return cursorReply(ns, batch), nil
+}
+
+func (st *store) dropIndexes(ns string, cmd bson.D) (bson.D, error) {
+	c, exists := st.collections[ns]
+	if !exists {
+		return nil, &commandError{Code: CODE_NAMESPACE_NOT_FOUND, Message: fmt.Sprintf("ns not found: %s", ns)}
+	}
+
+	name := lookupString(cmd, "index")
+	kept := c.indexes[:0]
+	dropped := false
+	for _, idx := range c.indexes {
+		if idx.Name != "_id_" && (name == "*" || idx.Name == name) {
+			dropped = true
+			continue
+		}
+		kept = append(kept, idx)
+	}
+	c.indexes = kept
+
+	if !dropped && name != "*" {
+		return nil, &commandError{Code: CODE_INDEX_NOT_FOUND, Message: fmt.Sprintf("index not found with name [%s]", name)}
+	}
+	return okReply(), nil
+}
+
+// checkUnique reports the unique index doc would violate, ignoring the document at position skip
+func (c *collection) checkUnique(doc bson.Raw, skip int) *commandError {
+	for _, idx := range c.indexes {
+		if !idx.Unique {
+			continue
+		}
+		k := indexKey(doc, idx.Key)
+		for pos, other := range c.docs {
+			if pos != skip && indexKey(other, idx.Key) == k {
+				return &commandError{Code: CODE_DUPLICATE_KEY, Message: fmt.Sprintf("E11000 duplicate key error index: %s dup key: %s", idx.Name, k)}
+			}
+		}
+	}
+	return nil
+}
+
+// indexKey is the values of the key fields of doc, a missing field counts as null like on a server
+func indexKey(doc bson.Raw, key bson.D) string {
+	var b strings.Builder
+	for _, f := range key {
+		v, err := doc.LookupErr(strings.Split(f.Key, ".")...)
+		if err != nil {
+			b.WriteString("null;")
+			continue
+		}
+		fmt.Fprintf(&b, "%s;", v)
+	}
+	return b.String()
+}
+
+// matches evaluates filter against doc
+func matches(doc bson.Raw, filter bson.Raw) (bool, error) {
+	elements, err := filter.Elements()
+	if err != nil {
+		return false, err
+	}
+
+	for _, e := range elements {
+		key := e.Key()
+		if strings.HasPrefix(key, "$") {
+			return false, fmt.Errorf("query operator %s is not supported", key)
+		}
+
+		v, lerr := doc.LookupErr(strings.Split(key, ".")...)
+		found := lerr == nil
+		want := e.Value()
+
+		ok, err := matchValue(v, found, want)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func matchValue(v bson.RawValue, found bool, want bson.RawValue) (bool, error) {
+	ops, isDoc := want.DocumentOK()
+	if !isDoc {
+		return equal(v, found, want), nil
+	}
+
+	elements, err := ops.Elements()
+	if err != nil {
+		return false, err
+	}
+	if len(elements) == 0 || !strings.HasPrefix(elements[0].Key(), "$") {
+		return equal(v, found, want), nil
+	}
+
+	for _, op := range elements {
+		arg := op.Value()
+
+		var ok bool
+		switch op.Key() {
+		case "$eq":
+			ok = equal(v, found, arg)
+		case "$ne":
+			ok = !equal(v, found, arg)
+		case "$exists":
+			ok = found == truthy(arg)
+		case "$in", "$nin":
+			values, isArray := arg.ArrayOK()
+			if !isArray {
+				return false, fmt.Errorf("%s needs an array", op.Key())
+			}
+			candidates, err := values.Values()
+			if err != nil {
+				return false, err
+			}
+			for _, c := range candidates {
+				if equal(v, found, c) {
+					ok = true
+					break
+				}
+			}
+			if op.Key() == "$nin" {
+				ok = !ok
+			}
+		case "$gt", "$gte", "$lt", "$lte":
+			cmp, comparable := compare(v, arg)
+			if !found || !comparable {
+				return false, nil
+			}
+			ok = map[string]bool{"$gt": cmp > 0, "$gte": cmp >= 0, "$lt": cmp < 0, "$lte": cmp <= 0}[op.Key()]
+		default:
+			return false, fmt.Errorf("query operator %s is not supported", op.Key())
+		}
+
+		if !ok {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func truthy(v bson.RawValue) bool {
+	switch v.Type {
+	case bson.TypeBoolean:
+		return v.Boolean()
+	case bson.TypeInt32, bson.TypeInt64, bson.TypeDouble:
+		f, _ := number(v)
+		return f != 0
+	}
+	return v.Type != bson.TypeNull
+}
+
+// equal matches null against missing fields too, like a server does
+func equal(v bson.RawValue, found bool, want bson.RawValue) bool {
+	if want.Type == bson.TypeNull {
+		return !found || v.Type == bson.TypeNull
+	}
+	if !found {
+		return false
+	}
+	cmp, comparable := compare(v, want)
+	return comparable && cmp == 0
+}
+
+func number(v bson.RawValue) (float64, bool) {
+	switch v.Type {
+	case bson.TypeInt32:
+		return float64(v.Int32()), true
+	case bson.TypeInt64:
+		return float64(v.Int64()), true
+	case bson.TypeDouble:
+		return v.Double(), true
+	}
+	return 0, false
+}
+
+// typeOrder is the order of the BSON types when sorting values of different types
+func typeOrder(t bsontype.Type) int {
+	switch t {
+	case bson.TypeNull, bson.TypeUndefined:
+		return 1
+	case bson.TypeInt32, bson.TypeInt64, bson.TypeDouble, bson.TypeDecimal128:
+		return 2
+	case bson.TypeString, bson.TypeSymbol:
+		return 3
+	case bson.TypeEmbeddedDocument:
+		return 4
+	case bson.TypeArray:
+		return 5
+	case bson.TypeBinary:
+		return 6
+	case bson.TypeObjectID:
+		return 7
+	case bson.TypeBoolean:
+		return 8
+	case bson.TypeDateTime:
+		return 9
+	case bson.TypeTimestamp:
+		return 10
+	}
+	return 11
+}
+
+// compare orders a and b, comparable is false for values of different types
+func compare(a bson.RawValue, b bson.RawValue) (cmp int, comparable bool) {
+	if ta, tb := typeOrder(a.Type), typeOrder(b.Type); ta != tb {
+		return ta - tb, false
+	}
+
+	if fa, isNumber := number(a); isNumber {
+		fb, _ := number(b)
+		switch {
+		case fa < fb:
+			return -1, true
+		case fa > fb:
+			return 1, true
+		}
+		return 0, true
+	}
+
+	switch a.Type {
+	case bson.TypeString:
+		return strings.Compare(a.StringValue(), b.StringValue()), true
+	case bson.TypeDateTime:
+		da, db := a.DateTime(), b.DateTime()
+		switch {
+		case da < db:
+			return -1, true
+		case da > db:
+			return 1, true
+		}
+		return 0, true
+	case bson.TypeBoolean:
+		ba, bb := a.Boolean(), b.Boolean()
+		switch {
+		case ba == bb:
+			return 0, true
+		case bb:
+			return -1, true
+		}
+		return 1, true
+	}
+
+	// binary, object ids and documents compare by their encoding, which keeps their subtype and length first
+	return bytes.Compare(a.Value, b.Value), true
+}
+
+func sortDocs(docs []bson.Raw, spec any) error {
+	raw, err := toRaw(spec)
+	if err != nil {
+		return err
+	}
+	keys, err := raw.Elements()
+	if err != nil {
+		return err
+	}
+
+	sort.SliceStable(docs, func(i, j int) bool {
+		for _, k := range keys {
+			direction, _ := number(k.Value())
+			path := strings.Split(k.Key(), ".")
+
+			a, aerr := docs[i].LookupErr(path...)
+			b, berr := docs[j].LookupErr(path...)
+			if aerr != nil {
+				a = bson.RawValue{Type: bson.TypeNull}
+			}
+			if berr != nil {
+				b = bson.RawValue{Type: bson.TypeNull}
+			}
+
+			if cmp, _ := compare(a, b); cmp != 0 {
+				return (cmp < 0) == (direction > 0)
+			}
+		}
+		return false
+	})
+
+	return nil
+}
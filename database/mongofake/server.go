@@ -0,0 +1,321 @@
+// Package mongofake is an in-process stand-in for a standalone Mongo server, so that tests can run
+// database.Database through the real driver without Docker or network:
+//
+//	s, err := mongofake.Start()
+//	defer s.Close()
+//	d := database.NewDatabaseWithUrl(s.URL())
+//
+// It speaks the OP_MSG wire protocol over loopback, plus the OP_QUERY handshake, and implements just
+// the commands this repository sends: insert, find, update, delete, createIndexes, listIndexes,
+// dropIndexes and drop. Filters support equality, $exists, $in, $ne and the range operators on top
+// level fields, updates support $set and $unset. Unique indexes are enforced with the duplicate key
+// error code of a real server. It is not a replica set, so transactions and change streams fail like
+// on a standalone server.
+package mongofake
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	OP_REPLY = 1
+	OP_QUERY = 2004
+	OP_MSG   = 2013
+
+	// msgMoreToCome marks an OP_MSG that gets no reply
+	msgMoreToCome = 1 << 1
+	// msgChecksumPresent marks an OP_MSG that ends with a crc32c
+	msgChecksumPresent = 1 << 0
+
+	maxMessageSize = 48_000_000
+)
+
+// Server accepts driver connections on a loopback port until Close
+type Server struct {
+	l     net.Listener
+	store *store
+	conns sync.WaitGroup
+
+	mu     sync.Mutex
+	open   map[net.Conn]bool
+	closed bool
+}
+
+// Start listens on a free loopback port
+func Start() (*Server, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{l: l, store: newStore(), open: map[net.Conn]bool{}}
+	go s.accept()
+
+	return s, nil
+}
+
+// URL connects straight to the fake, without it the driver would look for other replica set members
+func (s *Server) URL() string {
+	return fmt.Sprintf("mongodb://%s/?directConnection=true", s.l.Addr())
+}
+
+// Connections is the number of driver connections open right now
+func (s *Server) Connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.open)
+}
+
+// Close stops listening and drops every connection
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for c := range s.open {
+		c.Close()
+	}
+	s.mu.Unlock()
+
+	err := s.l.Close()
+	s.conns.Wait()
+	return err
+}
+
+func (s *Server) accept() {
+	for {
+		c, err := s.l.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			c.Close()
+			return
+		}
+		s.open[c] = true
+		s.conns.Add(1)
+		s.mu.Unlock()
+
+		go s.serve(c)
+	}
+}
+
+type header struct {
+	Length     int32
+	RequestId  int32
+	ResponseTo int32
+	OpCode     int32
+}
+
+func (s *Server) serve(c net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.open, c)
+		s.mu.Unlock()
+		c.Close()
+		s.conns.Done()
+	}()
+
+	r := bufio.NewReader(c)
+	for {
+		h, body, err := readMessage(r)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				log.Printf("mongofake: dropping connection: %s", err)
+			}
+			return
+		}
+
+		var reply []byte
+		switch h.OpCode {
+		case OP_MSG:
+			reply, err = s.handleMsg(h, body)
+		case OP_QUERY:
+			reply, err = s.handleQuery(h, body)
+		default:
+			err = fmt.Errorf("unsupported op code %d", h.OpCode)
+		}
+		if err != nil {
+			log.Printf("mongofake: dropping connection: %s", err)
+			return
+		}
+
+		if reply != nil {
+			if _, err := c.Write(reply); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func readMessage(r io.Reader) (header, []byte, error) {
+	var h header
+	if err := binary.Read(r, binary.LittleEndian, &h); err != nil {
+		return h, nil, err
+	}
+	if h.Length < 16 || h.Length > maxMessageSize {
+		return h, nil, fmt.Errorf("message length %d out of range", h.Length)
+	}
+
+	body := make([]byte, h.Length-16)
+	_, err := io.ReadFull(r, body)
+	return h, body, err
+}
+
+func appendHeader(dst []byte, length int, requestId int32, responseTo int32, opCode int32) []byte {
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(16+length))
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(requestId))
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(responseTo))
+	return binary.LittleEndian.AppendUint32(dst, uint32(opCode))
+}
+
+// handleMsg runs the command of an OP_MSG: a body section and optional document sequences, which
+// the driver uses for the documents, updates and deletes arrays of writes
+func (s *Server) handleMsg(h header, body []byte) ([]byte, error) {
+	if len(body) < 5 {
+		return nil, errors.New("OP_MSG too short")
+	}
+
+	flags := binary.LittleEndian.Uint32(body)
+	sections := body[4:]
+	if flags&msgChecksumPresent != 0 {
+		sections = sections[:len(sections)-4]
+	}
+
+	var cmd bson.D
+	for len(sections) > 0 {
+		kind := sections[0]
+		sections = sections[1:]
+
+		switch kind {
+		case 0:
+			doc, rest, err := readDocument(sections)
+			if err != nil {
+				return nil, err
+			}
+			if err := bson.Unmarshal(doc, &cmd); err != nil {
+				return nil, err
+			}
+			sections = rest
+		case 1:
+			if len(sections) < 4 {
+				return nil, errors.New("document sequence too short")
+			}
+			size := int(binary.LittleEndian.Uint32(sections))
+			if size < 5 || size > len(sections) {
+				return nil, errors.New("document sequence length out of range")
+			}
+			seq := sections[4:size]
+			sections = sections[size:]
+
+			name, seq, err := readCString(seq)
+			if err != nil {
+				return nil, err
+			}
+
+			docs := bson.A{}
+			for len(seq) > 0 {
+				doc, rest, err := readDocument(seq)
+				if err != nil {
+					return nil, err
+				}
+				docs = append(docs, bson.Raw(doc))
+				seq = rest
+			}
+			cmd = append(cmd, bson.E{Key: name, Value: docs})
+		default:
+			return nil, fmt.Errorf("unknown OP_MSG section kind %d", kind)
+		}
+	}
+
+	result := s.run(cmd)
+	if flags&msgMoreToCome != 0 {
+		return nil, nil
+	}
+
+	doc, err := bson.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+
+	reply := appendHeader(nil, 4+1+len(doc), 0, h.RequestId, OP_MSG)
+	reply = binary.LittleEndian.AppendUint32(reply, 0)
+	reply = append(reply, 0)
+	return append(reply, doc...), nil
+}
+
+// handleQuery answers the legacy hello the driver opens every connection with
+func (s *Server) handleQuery(h header, body []byte) ([]byte, error) {
+	if len(body) < 4 {
+		return nil, errors.New("OP_QUERY too short")
+	}
+
+	collection, rest, err := readCString(body[4:])
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) < 8 {
+		return nil, errors.New("OP_QUERY too short")
+	}
+
+	query, _, err := readDocument(rest[8:])
+	if err != nil {
+		return nil, err
+	}
+
+	var cmd bson.D
+	if err := bson.Unmarshal(query, &cmd); err != nil {
+		return nil, err
+	}
+	if len(cmd) > 0 && cmd[0].Key == "$query" {
+		if wrapped, isDoc := cmd[0].Value.(bson.D); isDoc {
+			cmd = wrapped
+		}
+	}
+
+	db, _, _ := strings.Cut(collection, ".")
+	cmd = append(cmd, bson.E{Key: "$db", Value: db})
+
+	doc, err := bson.Marshal(s.run(cmd))
+	if err != nil {
+		return nil, err
+	}
+
+	reply := appendHeader(nil, 20+len(doc), 0, h.RequestId, OP_REPLY)
+	reply = binary.LittleEndian.AppendUint32(reply, 0) // responseFlags
+	reply = binary.LittleEndian.AppendUint64(reply, 0) // cursorID
+	reply = binary.LittleEndian.AppendUint32(reply, 0) // startingFrom
+	reply = binary.LittleEndian.AppendUint32(reply, 1) // numberReturned
+	return append(reply, doc...), nil
+}
+
+func readDocument(b []byte) (doc []byte, rest []byte, err error) {
+	if len(b) < 5 {
+		return nil, nil, errors.New("document too short")
+	}
+	size := int(binary.LittleEndian.Uint32(b))
+	if size < 5 || size > len(b) {
+		return nil, nil, errors.New("document length out of range")
+	}
+	return b[:size], b[size:], nil
+}
+
+func readCString(b []byte) (string, []byte, error) {
+	for idx, c := range b {
+		if c == 0 {
+			return string(b[:idx]), b[idx+1:], nil
+		}
+	}
+	return "", nil, errors.New("unterminated cstring")
+}
@@ -0,0 +1,104 @@
+package mongofake
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func connect(t *testing.T) *mongo.Collection {
+	s, err := Start()
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(s.URL()))
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Disconnect(context.Background()) })
+
+	return client.Database("test").Collection("docs")
+}
+
+func find(t *testing.T, mc *mongo.Collection, filter bson.D, opts ...*options.FindOptions) []string {
+	cur, err := mc.Find(context.Background(), filter, opts...)
+	require.NoError(t, err)
+
+	var docs []struct{ Name string }
+	require.NoError(t, cur.All(context.Background(), &docs))
+
+	found := []string{}
+	for _, d := range docs {
+		found = append(found, d.Name)
+	}
+	return found
+}
+
+func TestQueries(t *testing.T) {
+	ctx := context.Background()
+	mc := connect(t)
+
+	_, err := mc.InsertMany(ctx, []any{
+		bson.D{{Key: "name", Value: "a"}, {Key: "n", Value: 3}},
+		bson.D{{Key: "name", Value: "b"}, {Key: "n", Value: int64(1)}, {Key: "tag", Value: "x"}},
+		bson.D{{Key: "name", Value: "c"}, {Key: "n", Value: 2.0}},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"a", "b", "c"}, find(t, mc, bson.D{}))
+	assert.Equal(t, []string{"b"}, find(t, mc, bson.D{{Key: "n", Value: 1}}))
+	assert.Equal(t, []string{"a", "c"}, find(t, mc, bson.D{{Key: "tag", Value: bson.D{{Key: "$exists", Value: false}}}}))
+	assert.Equal(t, []string{"a", "c"}, find(t, mc, bson.D{{Key: "name", Value: bson.D{{Key: "$in", Value: bson.A{"a", "c", "z"}}}}}))
+	assert.Equal(t, []string{"a", "c"}, find(t, mc, bson.D{{Key: "n", Value: bson.D{{Key: "$gte", Value: 2}}}}))
+	assert.Equal(t, []string{"a", "c"}, find(t, mc, bson.D{}, options.Find().SetSort(bson.D{{Key: "n", Value: -1}}).SetLimit(2)))
+	assert.Equal(t, []string{"b"}, find(t, mc, bson.D{}, options.Find().SetSort(bson.D{{Key: "n", Value: 1}}).SetSkip(0).SetLimit(1)))
+
+	res, err := mc.UpdateOne(ctx, bson.D{{Key: "name", Value: "d"}}, bson.D{{Key: "$set", Value: bson.D{{Key: "n", Value: 4}}}}, options.Update().SetUpsert(true))
+	require.NoError(t, err)
+	assert.NotNil(t, res.UpsertedID)
+
+	del, err := mc.DeleteMany(ctx, bson.D{{Key: "n", Value: bson.D{{Key: "$lt", Value: 3}}}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), del.DeletedCount)
+	assert.Equal(t, []string{"a", "d"}, find(t, mc, bson.D{}))
+}
+
+func TestIndexes(t *testing.T) {
+	ctx := context.Background()
+	mc := connect(t)
+
+	_, err := mc.InsertMany(ctx, []any{bson.D{{Key: "k", Value: 1}}, bson.D{{Key: "k", Value: 1}}})
+	require.NoError(t, err)
+
+	unique := mongo.IndexModel{Keys: bson.D{{Key: "k", Value: 1}}, Options: options.Index().SetUnique(true)}
+	_, err = mc.Indexes().CreateOne(ctx, unique)
+	assert.True(t, mongo.IsDuplicateKeyError(err), "existing duplicates fail the index")
+
+	_, err = mc.DeleteOne(ctx, bson.D{{Key: "k", Value: 1}})
+	require.NoError(t, err)
+	_, err = mc.Indexes().CreateOne(ctx, unique)
+	require.NoError(t, err)
+	_, err = mc.Indexes().CreateOne(ctx, unique)
+	require.NoError(t, err, "creating the same index again is a no-op")
+
+	_, err = mc.InsertOne(ctx, bson.D{{Key: "k", Value: 1}})
+	assert.True(t, mongo.IsDuplicateKeyError(err))
+	_, err = mc.UpdateOne(ctx, bson.D{{Key: "k", Value: 1}}, bson.D{{Key: "$set", Value: bson.D{{Key: "k", Value: 2}}}})
+	assert.NoError(t, err)
+
+	var specs []bson.M
+	cur, err := mc.Indexes().List(ctx)
+	require.NoError(t, err)
+	require.NoError(t, cur.All(ctx, &specs))
+	require.Len(t, specs, 2)
+	assert.Equal(t, "k_1", specs[1]["name"])
+	assert.Equal(t, true, specs[1]["unique"])
+
+	_, err = mc.Indexes().DropOne(ctx, "k_1")
+	require.NoError(t, err)
+	_, err = mc.InsertOne(ctx, bson.D{{Key: "k", Value: 2}})
+	assert.NoError(t, err)
+}
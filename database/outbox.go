@@ -0,0 +1,44 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vivekmv23/go-web-frameworks/lib"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	OUTBOX_COLLECTION = "outbox"
+
+	OUTBOX_ITEM_CREATED = "item.created"
+	OUTBOX_ITEM_UPDATED = "item.updated"
+	OUTBOX_ITEM_DELETED = "item.deleted"
+)
+
+// OutboxRecord is an item change written atomically with the change itself, so that it is published
+// even when the process dies right after the write
+type OutboxRecord struct {
+	DbId primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	// Id stays the same however often the record is relayed, consumers deduplicate on it
+	Id          uuid.UUID `bson:"id" json:"id"`
+	Type        string    `bson:"type" json:"type"`
+	Item        lib.Item  `bson:"item" json:"item"`
+	OccurredOn  time.Time `bson:"occurredOn" json:"occurredOn"`
+	PublishedOn time.Time `bson:"publishedOn,omitempty" json:"-"`
+}
+
+// Outbox is implemented by stores that record their changes in an outbox
+type Outbox interface {
+	// PendingOutbox returns unpublished records in the order they were written
+	PendingOutbox(ctx context.Context, limit int) ([]OutboxRecord, error)
+	MarkPublished(ctx context.Context, ids []uuid.UUID) error
+}
+
+var errOutboxDisabled = errors.New("the store was created without an outbox")
+
+func newOutboxRecord(changeType string, i lib.Item) OutboxRecord {
+	return OutboxRecord{Id: uuid.New(), Type: changeType, Item: i, OccurredOn: time.Now().Round(0)}
+}
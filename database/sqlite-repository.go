@@ -0,0 +1,382 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vivekmv23/go-web-frameworks/lib"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// sqliteMigrations are applied in order, a migration is never edited once released, changes go in a new one
+var sqliteMigrations = []string{
+	`CREATE TABLE items (
+		seq         INTEGER PRIMARY KEY AUTOINCREMENT,
+		id          TEXT    NOT NULL UNIQUE,
+		name        TEXT    NOT NULL,
+		value       INTEGER NOT NULL,
+		description TEXT    NOT NULL,
+		active      INTEGER NOT NULL,
+		created_on  INTEGER NOT NULL,
+		updated_on  INTEGER NOT NULL
+	)`,
+	`CREATE TABLE outbox (
+		seq          INTEGER PRIMARY KEY AUTOINCREMENT,
+		id           TEXT    NOT NULL UNIQUE,
+		type         TEXT    NOT NULL,
+		item         TEXT    NOT NULL,
+		occurred_on  INTEGER NOT NULL,
+		published_on INTEGER
+	)`,
+	`CREATE INDEX outbox_pending ON outbox (seq) WHERE published_on IS NULL`,
+}
+
+// etagLayout is the layout of time.Time.String, the format of the If-Match values
+const etagLayout = "2006-01-02 15:04:05.999999999 -0700 MST"
+
+const itemColumns = "id, name, value, description, active, created_on, updated_on"
+
+// Should satisfy ItemDatabase interface, keeps items in a SQLite file. Timestamps are stored as unix
+// nanoseconds so that the Etag of an item is the same before and after a round trip.
+type SqliteDatabase struct {
+	db *sql.DB
+	// withOutbox records every write in the outbox table within the same transaction
+	withOutbox bool
+}
+
+// NewSqliteDatabase opens or creates the database at path and migrates it to the latest schema,
+// path :memory: keeps the items in process on a single connection
+func NewSqliteDatabase(path string) (ItemDatabase, error) {
+	return openSqlite(path, false)
+}
+
+func NewSqliteDatabaseWithOutbox(path string) (ItemDatabase, error) {
+	return openSqlite(path, true)
+}
+
+func openSqlite(path string, withOutbox bool) (*SqliteDatabase, error) {
+	// transactions take the write lock when they begin, concurrent writes then wait on busy_timeout instead
+	// of failing to upgrade a read lock
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate", path))
+	if err != nil {
+		return nil, err
+	}
+
+	if path == ":memory:" {
+		// every connection would open a database of its own
+		db.SetMaxOpenConns(1)
+	}
+
+	if err := migrateSqlite(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate %s: %w", path, err)
+	}
+
+	return &SqliteDatabase{db: db, withOutbox: withOutbox}, nil
+}
+
+func migrateSqlite(db *sql.DB) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY, applied_on INTEGER NOT NULL)`); err != nil {
+		return err
+	}
+
+	var version int
+	if err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version); err != nil {
+		return err
+	}
+
+	for v := version + 1; v <= len(sqliteMigrations); v++ {
+		err := inSqliteTx(db, func(tx *sql.Tx) error {
+			if _, err := tx.Exec(sqliteMigrations[v-1]); err != nil {
+				return fmt.Errorf("migration %d: %w", v, err)
+			}
+			_, err := tx.Exec(`INSERT INTO schema_migrations (version, applied_on) VALUES (?, ?)`, v, time.Now().UnixNano())
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func inSqliteTx(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *SqliteDatabase) Close() error {
+	return s.db.Close()
+}
+
+func (s *SqliteDatabase) SaveItem(i *lib.Item) error {
+	determinations(i)
+
+	err := inSqliteTx(s.db, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT INTO items (`+itemColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			i.Id.String(), i.Name, i.Value, i.Description, i.Active, i.CreatedOn.UnixNano(), i.UpdatedOn.UnixNano())
+		if err != nil {
+			return err
+		}
+		return s.appendOutbox(tx, OUTBOX_ITEM_CREATED, *i)
+	})
+
+	return mapSqliteError(err)
+}
+
+func (s *SqliteDatabase) GetItemById(id uuid.UUID) (lib.Item, error) {
+	row := s.db.QueryRow(`SELECT `+itemColumns+` FROM items WHERE id = ?`, id.String())
+
+	i, err := scanItem(row)
+	return i, mapSqliteError(err, id)
+}
+
+func (s *SqliteDatabase) GetAllItems() ([]lib.Item, error) {
+	items := make([]lib.Item, 0)
+
+	cur, err := s.GetItemCursor(context.TODO())
+	if err != nil {
+		return items, err
+	}
+	defer cur.Close(context.TODO())
+
+	for cur.Next(context.TODO()) {
+		items = append(items, cur.Item())
+	}
+
+	return items, cur.Err()
+}
+
+func (s *SqliteDatabase) GetItemCursor(ctx context.Context) (ItemCursor, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+itemColumns+` FROM items ORDER BY seq`)
+	if err != nil {
+		return nil, mapSqliteError(err)
+	}
+
+	return &sqliteCursor{rows: rows}, nil
+}
+
+// sqliteCursor holds a connection until it is closed, on :memory: nothing else runs meanwhile
+type sqliteCursor struct {
+	rows *sql.Rows
+	item lib.Item
+	err  error
+}
+
+func (c *sqliteCursor) Next(ctx context.Context) bool {
+	if c.err != nil {
+		return false
+	}
+	if c.err = ctx.Err(); c.err != nil {
+		return false
+	}
+	if !c.rows.Next() {
+		return false
+	}
+
+	c.item, c.err = scanItem(c.rows)
+	c.err = mapSqliteError(c.err)
+	return c.err == nil
+}
+
+func (c *sqliteCursor) Item() lib.Item {
+	return c.item
+}
+
+func (c *sqliteCursor) Err() error {
+	if c.err != nil {
+		return c.err
+	}
+	return mapSqliteError(c.rows.Err())
+}
+
+func (c *sqliteCursor) Close(ctx context.Context) error {
+	return mapSqliteError(c.rows.Close())
+}
+
+func (s *SqliteDatabase) DeleteItemById(id uuid.UUID) error {
+	err := inSqliteTx(s.db, func(tx *sql.Tx) error {
+		res, err := tx.Exec(`DELETE FROM items WHERE id = ?`, id.String())
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return sql.ErrNoRows
+		}
+		return s.appendOutbox(tx, OUTBOX_ITEM_DELETED, lib.Item{Id: id})
+	})
+
+	return mapSqliteError(err, id)
+}
+
+// UpdateItem applies the If-Match precondition in the UPDATE itself, so that two updates with the same
+// Etag can not both succeed
+func (s *SqliteDatabase) UpdateItem(i lib.Item, ifMatch string) (lib.Item, error) {
+	var updated bool
+
+	err := inSqliteTx(s.db, func(tx *sql.Tx) error {
+		var createdOn int64
+		if err := tx.QueryRow(`SELECT created_on FROM items WHERE id = ?`, i.Id.String()).Scan(&createdOn); err != nil {
+			return err
+		}
+
+		matched, err := time.Parse(etagLayout, ifMatch)
+		if err != nil {
+			// not an Etag this store handed out
+			return nil
+		}
+
+		i.CreatedOn = time.Unix(0, createdOn)
+		determinations(&i)
+
+		res, err := tx.Exec(`UPDATE items SET name = ?, value = ?, description = ?, active = ?, updated_on = ? WHERE id = ? AND updated_on = ?`,
+			i.Name, i.Value, i.Description, i.Active, i.UpdatedOn.UnixNano(), i.Id.String(), matched.UnixNano())
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			// the Etag did not match, nothing to record
+			return err
+		}
+
+		updated = true
+		return s.appendOutbox(tx, OUTBOX_ITEM_UPDATED, i)
+	})
+
+	if err != nil {
+		return i, mapSqliteError(err, i.Id)
+	}
+	if !updated {
+		return i, &Outdated{}
+	}
+
+	return i, nil
+}
+
+func (s *SqliteDatabase) appendOutbox(tx *sql.Tx, changeType string, i lib.Item) error {
+	if !s.withOutbox {
+		return nil
+	}
+
+	r := newOutboxRecord(changeType, i)
+	item, err := json.Marshal(r.Item)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO outbox (id, type, item, occurred_on) VALUES (?, ?, ?, ?)`,
+		r.Id.String(), r.Type, string(item), r.OccurredOn.UnixNano())
+	return err
+}
+
+func (s *SqliteDatabase) PendingOutbox(ctx context.Context, limit int) ([]OutboxRecord, error) {
+	if !s.withOutbox {
+		return nil, errOutboxDisabled
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT id, type, item, occurred_on FROM outbox WHERE published_on IS NULL ORDER BY seq LIMIT ?`, limit)
+	if err != nil {
+		return nil, mapSqliteError(err)
+	}
+	defer rows.Close()
+
+	records := []OutboxRecord{}
+	for rows.Next() {
+		var (
+			r          OutboxRecord
+			id, item   string
+			occurredOn int64
+		)
+		if err := rows.Scan(&id, &r.Type, &item, &occurredOn); err != nil {
+			return nil, mapSqliteError(err)
+		}
+		if r.Id, err = uuid.Parse(id); err != nil {
+			return nil, mapSqliteError(err)
+		}
+		if err := json.Unmarshal([]byte(item), &r.Item); err != nil {
+			return nil, mapSqliteError(err)
+		}
+		r.OccurredOn = time.Unix(0, occurredOn)
+		records = append(records, r)
+	}
+
+	return records, mapSqliteError(rows.Err())
+}
+
+// MarkPublished keeps the records so that the outbox doubles as a log of the changes
+func (s *SqliteDatabase) MarkPublished(ctx context.Context, ids []uuid.UUID) error {
+	if !s.withOutbox {
+		return errOutboxDisabled
+	}
+
+	err := inSqliteTx(s.db, func(tx *sql.Tx) error {
+		now := time.Now().UnixNano()
+		for _, id := range ids {
+			if _, err := tx.ExecContext(ctx, `UPDATE outbox SET published_on = ? WHERE id = ?`, now, id.String()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return mapSqliteError(err)
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanItem(row rowScanner) (lib.Item, error) {
+	var (
+		i                    lib.Item
+		id                   string
+		createdOn, updatedOn int64
+	)
+
+	if err := row.Scan(&id, &i.Name, &i.Value, &i.Description, &i.Active, &createdOn, &updatedOn); err != nil {
+		return i, err
+	}
+
+	var err error
+	i.Id, err = uuid.Parse(id)
+	i.CreatedOn = time.Unix(0, createdOn)
+	i.UpdatedOn = time.Unix(0, updatedOn)
+
+	return i, err
+}
+
+func mapSqliteError(err error, arg ...any) error {
+
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return &NotFound{Id: arg[0]}
+	}
+
+	var se *sqlite.Error
+	if errors.As(err, &se) && (se.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE || se.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY) {
+		return &Conflict{}
+	}
+
+	return &Unclassified{Err: err}
+}
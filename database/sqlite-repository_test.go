@@ -0,0 +1,100 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vivekmv23/go-web-frameworks/lib"
+)
+
+func newTestSqlite(t *testing.T) *SqliteDatabase {
+	d, err := openSqlite(filepath.Join(t.TempDir(), "items.db"), true)
+	require.NoError(t, err)
+	t.Cleanup(func() { d.Close() })
+	return d
+}
+
+// the contract of ItemDatabase is covered by TestSqliteConformance
+func TestSqliteOutbox(t *testing.T) {
+	d := newTestSqlite(t)
+
+	i := lib.Item{Name: "sqlite", Value: 7}
+	require.NoError(t, d.SaveItem(&i))
+	duplicate := lib.Item{Id: i.Id}
+	require.Error(t, d.SaveItem(&duplicate))
+
+	i.Value = 8
+	updated, err := d.UpdateItem(i, i.UpdatedOn.String())
+	require.NoError(t, err)
+	_, err = d.UpdateItem(i, i.UpdatedOn.String())
+	require.Error(t, err)
+	require.NoError(t, d.DeleteItemById(i.Id))
+
+	records, err := d.PendingOutbox(context.Background(), 10)
+	require.NoError(t, err)
+	require.Len(t, records, 3, "failed writes record nothing")
+	assert.Equal(t, []string{OUTBOX_ITEM_CREATED, OUTBOX_ITEM_UPDATED, OUTBOX_ITEM_DELETED}, []string{records[0].Type, records[1].Type, records[2].Type})
+	assert.Equal(t, updated.Value, records[1].Item.Value)
+
+	require.NoError(t, d.MarkPublished(context.Background(), []uuid.UUID{records[0].Id}))
+	records, err = d.PendingOutbox(context.Background(), 10)
+	require.NoError(t, err)
+	assert.Len(t, records, 2)
+}
+
+func TestSqliteConcurrentUpdatesWithSameEtag(t *testing.T) {
+	d := newTestSqlite(t)
+
+	i := lib.Item{Name: "contended"}
+	require.NoError(t, d.SaveItem(&i))
+	etag := i.UpdatedOn.String()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for n := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := d.UpdateItem(lib.Item{Id: i.Id, Name: "contended", Value: n}, etag)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	succeeded := 0
+	for err := range errs {
+		if err == nil {
+			succeeded++
+		} else {
+			assert.IsType(t, &Outdated{}, err)
+		}
+	}
+	assert.Equal(t, 1, succeeded)
+}
+
+func TestSqliteMigrationsRunOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "items.db")
+
+	d, err := openSqlite(path, false)
+	require.NoError(t, err)
+	i := lib.Item{Name: "survives a reopen"}
+	require.NoError(t, d.SaveItem(&i))
+	d.Close()
+
+	d, err = openSqlite(path, false)
+	require.NoError(t, err)
+	defer d.Close()
+
+	var applied int
+	require.NoError(t, d.db.QueryRow(`SELECT COUNT(*) FROM schema_migrations`).Scan(&applied))
+	assert.Equal(t, len(sqliteMigrations), applied)
+
+	_, err = d.GetItemById(i.Id)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,152 @@
+// Package events carries item changes from the store to live subscribers such as the SSE change feed.
+// Writes are published to a Bus, which keeps the latest events so that subscribers can resume after a reconnect.
+package events
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vivekmv23/go-web-frameworks/lib"
+)
+
+const (
+	ITEM_CREATED = "created"
+	ITEM_UPDATED = "updated"
+	ITEM_DELETED = "deleted"
+	// RESET tells subscribers that changes were missed and the items must be read again
+	RESET = "reset"
+
+	// subscriptions that fall this many events behind are dropped, they resume from the log on reconnect
+	subscriptionBuffer = 64
+)
+
+type Event struct {
+	Id   string    `json:"id"`
+	Type string    `json:"type"`
+	Item lib.Item  `json:"item"`
+	At   time.Time `json:"at"`
+
+	seq uint64
+}
+
+// Bus fans published events out to subscribers and keeps the last size events for resumption
+type Bus struct {
+	mu sync.Mutex
+	// epoch tells event ids of earlier processes apart, their sequence numbers start over
+	epoch string
+	seq   uint64
+	log   []Event
+	next  int
+	subs  map[*Subscription]struct{}
+}
+
+func NewBus(size int) *Bus {
+	if size < 1 {
+		size = 1
+	}
+	return &Bus{
+		epoch: strconv.FormatInt(time.Now().UnixNano(), 36),
+		log:   make([]Event, 0, size),
+		subs:  map[*Subscription]struct{}{},
+	}
+}
+
+func (b *Bus) Publish(eventType string, i lib.Item) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	e := Event{
+		Id:   fmt.Sprintf("%s-%d", b.epoch, b.seq),
+		Type: eventType,
+		Item: i,
+		At:   time.Now(),
+		seq:  b.seq,
+	}
+
+	if len(b.log) < cap(b.log) {
+		b.log = append(b.log, e)
+	} else {
+		b.log[b.next] = e
+		b.next = (b.next + 1) % len(b.log)
+	}
+
+	for s := range b.subs {
+		select {
+		case s.c <- e:
+		default:
+			b.drop(s)
+		}
+	}
+
+	return e
+}
+
+// Subscription receives the events published after it was opened on C, which is closed when
+// the subscriber falls too far behind
+type Subscription struct {
+	// Backlog holds the logged events after the one the subscriber resumes from
+	Backlog []Event
+	// Missed is set when the subscriber resumes from an event that is no longer logged
+	Missed bool
+	C      <-chan Event
+
+	c chan Event
+	b *Bus
+}
+
+// Subscribe starts a subscription, lastEventId is the id of the last event the subscriber saw or empty
+func (b *Bus) Subscribe(lastEventId string) *Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := make(chan Event, subscriptionBuffer)
+	s := &Subscription{C: c, c: c, b: b}
+
+	if lastEventId != "" {
+		s.Backlog, s.Missed = b.after(lastEventId)
+	}
+
+	b.subs[s] = struct{}{}
+	return s
+}
+
+// Close stops the subscription, it is safe to call more than once
+func (s *Subscription) Close() {
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+
+	if _, open := s.b.subs[s]; open {
+		s.b.drop(s)
+	}
+}
+
+func (b *Bus) drop(s *Subscription) {
+	delete(b.subs, s)
+	close(s.c)
+}
+
+// after returns the logged events following lastEventId, missed when the log no longer reaches back to it
+func (b *Bus) after(lastEventId string) ([]Event, bool) {
+	epoch, seqText, _ := strings.Cut(lastEventId, "-")
+	seq, err := strconv.ParseUint(seqText, 10, 64)
+	if err != nil || epoch != b.epoch || seq > b.seq {
+		return nil, true
+	}
+
+	var events []Event
+	for idx := range b.log {
+		e := b.log[(b.next+idx)%len(b.log)]
+		if e.seq > seq {
+			events = append(events, e)
+		}
+	}
+
+	if oldest := b.seq - uint64(len(events)); oldest > seq {
+		return nil, true
+	}
+	return events, false
+}
@@ -0,0 +1,68 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/vivekmv23/go-web-frameworks/lib"
+)
+
+func TestBus_PublishReachesSubscribers(t *testing.T) {
+	b := NewBus(10)
+	s := b.Subscribe("")
+	defer s.Close()
+
+	i := lib.Item{Id: uuid.New()}
+	published := b.Publish(ITEM_CREATED, i)
+
+	received := <-s.C
+	assert.Equal(t, published.Id, received.Id)
+	assert.Equal(t, ITEM_CREATED, received.Type)
+	assert.Equal(t, i.Id, received.Item.Id)
+	assert.Empty(t, s.Backlog)
+	assert.False(t, s.Missed)
+}
+
+func TestBus_ResumeFromLog(t *testing.T) {
+	b := NewBus(3)
+
+	var ids []string
+	for range 5 {
+		ids = append(ids, b.Publish(ITEM_UPDATED, lib.Item{}).Id)
+	}
+
+	s := b.Subscribe(ids[2])
+	assert.False(t, s.Missed)
+	if assert.Len(t, s.Backlog, 2) {
+		assert.Equal(t, ids[3], s.Backlog[0].Id)
+		assert.Equal(t, ids[4], s.Backlog[1].Id)
+	}
+
+	s = b.Subscribe(ids[4])
+	assert.False(t, s.Missed)
+	assert.Empty(t, s.Backlog)
+
+	// ids[1] is the oldest one that still has all its successors logged
+	assert.False(t, b.Subscribe(ids[1]).Missed)
+	assert.True(t, b.Subscribe(ids[0]).Missed, "ids[1] was evicted")
+	assert.True(t, b.Subscribe("not-an-id").Missed)
+	assert.True(t, NewBus(3).Subscribe(ids[4]).Missed, "ids of another bus are unknown")
+}
+
+func TestBus_DropsSlowSubscribers(t *testing.T) {
+	b := NewBus(1)
+	s := b.Subscribe("")
+
+	for range subscriptionBuffer + 1 {
+		b.Publish(ITEM_CREATED, lib.Item{})
+	}
+
+	received := 0
+	for range s.C {
+		received++
+	}
+	assert.Equal(t, subscriptionBuffer, received)
+
+	s.Close()
+}
@@ -0,0 +1,44 @@
+package events
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/vivekmv23/go-web-frameworks/database"
+	"github.com/vivekmv23/go-web-frameworks/lib"
+)
+
+var mongoOperations = map[string]string{
+	"insert":  ITEM_CREATED,
+	"update":  ITEM_UPDATED,
+	"replace": ITEM_UPDATED,
+	"delete":  ITEM_DELETED,
+}
+
+// WatchMongo publishes the writes of the collection behind d to b until ctx ends, including writes of
+// other processes. A failed change stream is reopened after a pause with a RESET, since changes in
+// between are lost.
+func WatchMongo(ctx context.Context, d *database.Database, b *Bus) {
+	for {
+		err := d.WatchChanges(ctx, func(c database.Change) {
+			if eventType, known := mongoOperations[c.Operation]; known {
+				b.Publish(eventType, c.Item)
+			}
+		})
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		log.Printf("ERROR: mongo change stream stopped, reopening: %v", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+
+		b.Publish(RESET, lib.Item{})
+	}
+}
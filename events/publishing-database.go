@@ -0,0 +1,61 @@
+package events
+
+import (
+	"github.com/google/uuid"
+	"github.com/vivekmv23/go-web-frameworks/database"
+	"github.com/vivekmv23/go-web-frameworks/lib"
+)
+
+// Observable is implemented by stores whose changes reach a Bus
+type Observable interface {
+	Events() *Bus
+}
+
+// Should satisfy ItemDatabase interface, decorates another store with a Bus
+type Database struct {
+	database.ItemDatabase
+	bus     *Bus
+	publish bool
+}
+
+// NewPublishingDatabase publishes every successful write of d to b
+func NewPublishingDatabase(d database.ItemDatabase, b *Bus) database.ItemDatabase {
+	return &Database{ItemDatabase: d, bus: b, publish: true}
+}
+
+// NewObservedDatabase exposes b for d without publishing, the events come from another source such as WatchMongo
+func NewObservedDatabase(d database.ItemDatabase, b *Bus) database.ItemDatabase {
+	return &Database{ItemDatabase: d, bus: b}
+}
+
+func (d *Database) Events() *Bus {
+	return d.bus
+}
+
+func (d *Database) Unwrap() database.ItemDatabase {
+	return d.ItemDatabase
+}
+
+func (d *Database) SaveItem(i *lib.Item) error {
+	err := d.ItemDatabase.SaveItem(i)
+	if err == nil && d.publish {
+		d.bus.Publish(ITEM_CREATED, *i)
+	}
+	return err
+}
+
+func (d *Database) UpdateItem(i lib.Item, ifMatch string) (lib.Item, error) {
+	updated, err := d.ItemDatabase.UpdateItem(i, ifMatch)
+	if err == nil && d.publish {
+		d.bus.Publish(ITEM_UPDATED, updated)
+	}
+	return updated, err
+}
+
+func (d *Database) DeleteItemById(id uuid.UUID) error {
+	err := d.ItemDatabase.DeleteItemById(id)
+	if err == nil && d.publish {
+		d.bus.Publish(ITEM_DELETED, lib.Item{Id: id})
+	}
+	return err
+}
@@ -0,0 +1,151 @@
+// Package fixtures keeps HTTP exchanges as JSON lines, one exchange per line. They are recorded from
+// live traffic by web.RecordMiddleware and replayed against any framework implementation with Replay,
+// which reports where the responses differ from the recorded ones.
+package fixtures
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// MAX_BODY is the longest body kept of a request or response, longer ones are cut and marked truncated
+const MAX_BODY = 1 << 20
+
+type Exchange struct {
+	Time     time.Time `json:"time"`
+	Request  Request   `json:"request"`
+	Response Response  `json:"response"`
+}
+
+type Request struct {
+	Method string      `json:"method"`
+	Target string      `json:"target"`
+	Header http.Header `json:"header,omitempty"`
+	Body   *Body       `json:"body,omitempty"`
+}
+
+type Response struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   *Body       `json:"body,omitempty"`
+}
+
+// Body is kept as text, or base64 encoded when it is not valid UTF-8. An empty body is nil and left
+// out of the recording.
+type Body struct {
+	Text      string `json:"text,omitempty"`
+	Base64    string `json:"base64,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+// NewBody keeps at most MAX_BODY bytes of b, it is nil when b is empty
+func NewBody(b []byte) *Body {
+	if len(b) == 0 {
+		return nil
+	}
+
+	body := &Body{}
+	if len(b) > MAX_BODY {
+		b, body.Truncated = b[:MAX_BODY], true
+	}
+
+	if utf8.Valid(b) {
+		body.Text = string(b)
+	} else {
+		body.Base64 = base64.StdEncoding.EncodeToString(b)
+	}
+	return body
+}
+
+func (b *Body) Bytes() []byte {
+	if b == nil {
+		return nil
+	}
+	if b.Base64 != "" {
+		decoded, _ := base64.StdEncoding.DecodeString(b.Base64)
+		return decoded
+	}
+	return []byte(b.Text)
+}
+
+// Recorder appends exchanges to a JSON lines file, it is safe for concurrent use
+type Recorder struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{w: w}
+}
+
+// Create appends the recorded exchanges to the file at path
+func Create(path string) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return NewRecorder(f), nil
+}
+
+func (r *Recorder) Record(e Exchange) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, err = r.w.Write(append(line, '\n'))
+	return err
+}
+
+// Close closes the file the recorder writes to, if it is one
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if c, ok := r.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Read decodes the exchanges of a JSON lines stream, blank lines are skipped
+func Read(r io.Reader) ([]Exchange, error) {
+	var exchanges []Exchange
+
+	s := bufio.NewScanner(r)
+	// a line holds up to two bodies, base64 makes them longer
+	s.Buffer(nil, 4*MAX_BODY)
+	for line := 1; s.Scan(); line++ {
+		if len(s.Bytes()) == 0 {
+			continue
+		}
+
+		var e Exchange
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("invalid exchange on line %d: %w", line, err)
+		}
+		exchanges = append(exchanges, e)
+	}
+	return exchanges, s.Err()
+}
+
+func Load(path string) ([]Exchange, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Read(f)
+}
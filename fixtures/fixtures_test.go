@@ -0,0 +1,58 @@
+package fixtures
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordAndRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "exchanges.jsonl")
+	rec, err := Create(path)
+	require.NoError(t, err)
+
+	binary := []byte{0xff, 0x00, 0x81}
+	e := Exchange{
+		Time:     time.Date(2024, 9, 1, 10, 0, 0, 0, time.UTC),
+		Request:  Request{Method: http.MethodPost, Target: "/items", Header: http.Header{"Content-Type": {"application/json"}}, Body: NewBody([]byte(`{"name": "a"}`))},
+		Response: Response{Status: http.StatusCreated, Body: NewBody(binary)},
+	}
+	require.NoError(t, rec.Record(e))
+	require.NoError(t, rec.Record(Exchange{Request: Request{Method: http.MethodGet, Target: "/items"}, Response: Response{Status: http.StatusOK}}))
+	require.NoError(t, rec.Close())
+
+	exchanges, err := Load(path)
+	require.NoError(t, err)
+	require.Len(t, exchanges, 2)
+	assert.Equal(t, e, exchanges[0])
+	assert.Equal(t, binary, exchanges[0].Response.Body.Bytes())
+	assert.NotEmpty(t, exchanges[0].Response.Body.Base64, "bodies that are not text are base64 encoded")
+}
+
+func TestEmptyBodiesAreLeftOut(t *testing.T) {
+	line, err := json.Marshal(Exchange{Request: Request{Method: http.MethodGet, Target: "/items"}, Response: Response{Status: http.StatusNoContent, Body: NewBody(nil)}})
+	require.NoError(t, err)
+
+	assert.NotContains(t, string(line), `"body"`)
+}
+
+func TestLongBodiesAreTruncated(t *testing.T) {
+	b := NewBody(bytes.Repeat([]byte("a"), MAX_BODY+1))
+
+	assert.True(t, b.Truncated)
+	assert.Len(t, b.Bytes(), MAX_BODY)
+	assert.False(t, NewBody(bytes.Repeat([]byte("a"), MAX_BODY)).Truncated)
+}
+
+func TestReadInvalidLine(t *testing.T) {
+	_, err := Read(strings.NewReader("{\"request\": {}}\n\n{\"request\": \n"))
+
+	assert.ErrorContains(t, err, "line 3")
+}
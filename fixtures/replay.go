@@ -0,0 +1,284 @@
+package fixtures
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// IgnoredHeaders are not compared at all
+	IgnoredHeaders = []string{"Date", "Content-Length"}
+	// VolatileHeaders change from run to run, the replayed response only needs to have them as well
+	VolatileHeaders = []string{"Ratelimit-Reset", "Retry-After"}
+)
+
+// Difference is a part of a replayed response that does not match the recorded response
+type Difference struct {
+	// Exchange is the index of the exchange in the replayed list
+	Exchange int
+	Method   string
+	Target   string
+	// Field is status, a header or a path into the body like body[0].name
+	Field    string
+	Recorded string
+	Replayed string
+}
+
+func (d Difference) String() string {
+	return fmt.Sprintf("#%d %s %s: %s was %s, replayed %s", d.Exchange+1, d.Method, d.Target, d.Field, shorten(d.Recorded), shorten(d.Replayed))
+}
+
+func shorten(s string) string {
+	if s == "" {
+		return "empty"
+	}
+	if len(s) > 120 {
+		return fmt.Sprintf("%q...", s[:120])
+	}
+	return fmt.Sprintf("%q", s)
+}
+
+// Replay sends the recorded requests to h in order and compares the responses with the recorded ones.
+// Values a server generates, like ids, etags and timestamps, are not expected to repeat: they may
+// differ, but consistently, and later requests carry the replayed value in place of the recorded one.
+func Replay(h http.Handler, exchanges []Exchange) []Difference {
+	r := &replayer{substitutions: map[string]string{}}
+
+	for idx, e := range exchanges {
+		r.current = Difference{Exchange: idx, Method: e.Request.Method, Target: e.Request.Target}
+
+		if e.Request.Body != nil && e.Request.Body.Truncated {
+			r.differ("request body", "truncated when recorded", "not sent")
+			continue
+		}
+
+		req := httptest.NewRequest(e.Request.Method, r.substitute(e.Request.Target), bytes.NewReader(r.substituteBytes(e.Request.Body.Bytes())))
+		for k, values := range e.Request.Header {
+			for _, v := range values {
+				req.Header.Add(k, r.substitute(v))
+			}
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		r.compare(e.Response, w.Result().StatusCode, w.Header(), w.Body.Bytes())
+	}
+
+	return r.diffs
+}
+
+type replayer struct {
+	// substitutions map recorded values to their replayed values
+	substitutions map[string]string
+	current       Difference
+	diffs         []Difference
+}
+
+func (r *replayer) differ(field string, recorded string, replayed string) {
+	d := r.current
+	d.Field, d.Recorded, d.Replayed = field, recorded, replayed
+	r.diffs = append(r.diffs, d)
+}
+
+// learn takes replayed as the value of recorded from now on, unless recorded already has another one
+func (r *replayer) learn(recorded string, replayed string) bool {
+	if known, isKnown := r.substitutions[recorded]; isKnown {
+		return known == replayed
+	}
+	r.substitutions[recorded] = replayed
+	return true
+}
+
+func (r *replayer) replacer() *strings.Replacer {
+	var recorded []string
+	for k := range r.substitutions {
+		recorded = append(recorded, k)
+	}
+	// the longest values are replaced first, so that no value is replaced by a part of it
+	sort.Slice(recorded, func(i, j int) bool {
+		if len(recorded[i]) != len(recorded[j]) {
+			return len(recorded[i]) > len(recorded[j])
+		}
+		return recorded[i] < recorded[j]
+	})
+
+	var pairs []string
+	for _, k := range recorded {
+		pairs = append(pairs, k, r.substitutions[k])
+	}
+	return strings.NewReplacer(pairs...)
+}
+
+func (r *replayer) substitute(s string) string {
+	if len(r.substitutions) == 0 {
+		return s
+	}
+	return r.replacer().Replace(s)
+}
+
+func (r *replayer) substituteBytes(b []byte) []byte {
+	return []byte(r.substitute(string(b)))
+}
+
+func (r *replayer) compare(recorded Response, status int, header http.Header, body []byte) {
+	if recorded.Status != status {
+		r.differ("status", fmt.Sprint(recorded.Status), fmt.Sprint(status))
+	}
+
+	r.compareHeaders(recorded.Header, header)
+
+	// a truncated body can not be compared, the status and headers still are
+	if recorded.Body == nil || !recorded.Body.Truncated {
+		r.compareBody(recorded.Body.Bytes(), body)
+	}
+}
+
+func (r *replayer) compareHeaders(recorded http.Header, replayed http.Header) {
+	var keys []string
+	for k := range recorded {
+		keys = append(keys, http.CanonicalHeaderKey(k))
+	}
+	for k := range replayed {
+		keys = append(keys, http.CanonicalHeaderKey(k))
+	}
+	slices.Sort(keys)
+
+	for _, k := range slices.Compact(keys) {
+		rec, got := recorded.Values(k), replayed.Values(k)
+
+		switch {
+		case slices.Contains(IgnoredHeaders, k):
+		case slices.Contains(VolatileHeaders, k):
+			if (len(rec) == 0) != (len(got) == 0) {
+				r.differ("header "+k, strings.Join(rec, ", "), strings.Join(got, ", "))
+			}
+		case k == "Etag" && len(rec) == 1 && len(got) == 1:
+			if !r.learn(rec[0], got[0]) {
+				r.differ("header "+k, r.substitute(rec[0]), got[0])
+			}
+		default:
+			if want := r.substitute(strings.Join(rec, ", ")); want != strings.Join(got, ", ") {
+				r.differ("header "+k, want, strings.Join(got, ", "))
+			}
+		}
+	}
+}
+
+func (r *replayer) compareBody(recorded []byte, replayed []byte) {
+	var rec, got any
+	if decodeJSON(recorded, &rec) == nil && decodeJSON(replayed, &got) == nil {
+		r.compareJSON("body", rec, got)
+		return
+	}
+
+	if want := r.substituteBytes(recorded); !bytes.Equal(want, replayed) {
+		r.differ("body", string(want), string(replayed))
+	}
+}
+
+func decodeJSON(b []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	// several values, like newline delimited JSON, are compared as text
+	if dec.More() {
+		return fmt.Errorf("more than one JSON value")
+	}
+	return nil
+}
+
+func (r *replayer) compareJSON(path string, recorded any, replayed any) {
+	switch rec := recorded.(type) {
+	case map[string]any:
+		got, isObject := replayed.(map[string]any)
+		if !isObject {
+			r.differ(path, jsonString(recorded), jsonString(replayed))
+			return
+		}
+
+		var keys []string
+		for k := range rec {
+			keys = append(keys, k)
+		}
+		for k := range got {
+			if _, inRecorded := rec[k]; !inRecorded {
+				keys = append(keys, k)
+			}
+		}
+		slices.Sort(keys)
+
+		for _, k := range keys {
+			recValue, inRecorded := rec[k]
+			gotValue, inReplayed := got[k]
+			switch {
+			case !inReplayed:
+				r.differ(path+"."+k, jsonString(recValue), "")
+			case !inRecorded:
+				r.differ(path+"."+k, "", jsonString(gotValue))
+			default:
+				r.compareJSON(path+"."+k, recValue, gotValue)
+			}
+		}
+	case []any:
+		got, isArray := replayed.([]any)
+		if !isArray {
+			r.differ(path, jsonString(recorded), jsonString(replayed))
+			return
+		}
+		if len(rec) != len(got) {
+			r.differ(path+" length", fmt.Sprint(len(rec)), fmt.Sprint(len(got)))
+		}
+		for idx := range min(len(rec), len(got)) {
+			r.compareJSON(fmt.Sprintf("%s[%d]", path, idx), rec[idx], got[idx])
+		}
+	case string:
+		got, isString := replayed.(string)
+		if !isString {
+			r.differ(path, r.substitute(rec), jsonString(replayed))
+		} else if !r.matches(rec, got) {
+			r.differ(path, r.substitute(rec), got)
+		}
+	default:
+		if jsonString(recorded) != jsonString(replayed) {
+			r.differ(path, jsonString(recorded), jsonString(replayed))
+		}
+	}
+}
+
+// matches compares strings of the body, ids and timestamps may differ if they do so consistently
+func (r *replayer) matches(recorded string, replayed string) bool {
+	if r.substitute(recorded) == replayed {
+		return true
+	}
+	if (isUUID(recorded) && isUUID(replayed)) || (isTimestamp(recorded) && isTimestamp(replayed)) {
+		return r.learn(recorded, replayed)
+	}
+	return false
+}
+
+func isUUID(s string) bool {
+	_, err := uuid.Parse(s)
+	return len(s) == 36 && err == nil
+}
+
+func isTimestamp(s string) bool {
+	_, err := time.Parse(time.RFC3339Nano, s)
+	return err == nil
+}
+
+func jsonString(v any) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
@@ -0,0 +1,80 @@
+package fixtures
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// idServer hands out a new id and version on every POST and echoes them on GET /{id} when the
+// If-Match header carries the version
+func idServer() http.Handler {
+	versions := map[string]string{}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.Method == http.MethodPost {
+			id, version := uuid.NewString(), uuid.NewString()
+			versions[id] = version
+			w.Header().Set("Etag", version)
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]any{"id": id, "count": len(versions)})
+			return
+		}
+
+		id := strings.TrimPrefix(r.URL.Path, "/")
+		if version, found := versions[id]; !found || r.Header.Get("If-Match") != version {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, "no item "+id)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"id": id})
+	})
+}
+
+func exchange(method string, target string, header http.Header, status int, respHeader http.Header, body string) Exchange {
+	return Exchange{
+		Request:  Request{Method: method, Target: target, Header: header},
+		Response: Response{Status: status, Header: respHeader, Body: NewBody([]byte(body))},
+	}
+}
+
+func TestReplayFollowsGeneratedValues(t *testing.T) {
+	id, version := uuid.NewString(), uuid.NewString()
+	jsonHeader := http.Header{"Content-Type": {"application/json"}}
+
+	diffs := Replay(idServer(), []Exchange{
+		exchange(http.MethodPost, "/", nil, http.StatusCreated, http.Header{"Content-Type": {"application/json"}, "Etag": {version}}, `{"id": "`+id+`", "count": 1}`),
+		exchange(http.MethodGet, "/"+id, http.Header{"If-Match": {version}}, http.StatusOK, jsonHeader, `{"id": "`+id+`"}`),
+		exchange(http.MethodGet, "/"+id, nil, http.StatusNotFound, jsonHeader, "no item "+id),
+	})
+
+	assert.Empty(t, diffs)
+}
+
+func TestReplayReportsDifferences(t *testing.T) {
+	id := uuid.NewString()
+	jsonHeader := http.Header{"Content-Type": {"application/json"}}
+
+	diffs := Replay(idServer(), []Exchange{
+		exchange(http.MethodPost, "/", nil, http.StatusOK, http.Header{"Content-Type": {"text/plain"}, "Etag": {"v1"}}, `{"id": "`+id+`", "count": 2, "name": "a"}`),
+		// the recorded id was replayed as another one already
+		exchange(http.MethodPost, "/", nil, http.StatusCreated, http.Header{"Content-Type": {"application/json"}, "Etag": {"v2"}}, `{"id": "`+id+`", "count": 2}`),
+		exchange(http.MethodGet, "/unknown", nil, http.StatusNotFound, jsonHeader, "no item at all"),
+	})
+
+	var fields []string
+	for _, d := range diffs {
+		fields = append(fields, d.Field)
+	}
+	require.Equal(t, []string{"status", "header Content-Type", "body.count", "body.name", "body.id", "body"}, fields)
+	assert.Equal(t, 1, diffs[4].Exchange)
+	assert.Equal(t, `#3 GET /unknown: body was "no item at all", replayed "no item unknown"`, diffs[5].String())
+}
@@ -8,14 +8,14 @@ import (
 )
 
 type Item struct {
-	DbId        primitive.ObjectID `bson:"_id,omitempty" json:"-"`
-	Id          uuid.UUID          `bson:"id,omitempty" json:"id"`
-	Name        string             `bson:"nam,omitempty" json:"name"`
-	Value       int                `bson:"val,omitempty" json:"value"`
-	Description string             `bson:"dsc,omitempty" json:"description"`
-	Active      bool               `bson:"act,omitempty" json:"isActive"`
-	CreatedOn   time.Time          `bson:"con,omitempty" json:"createdOn"`
-	UpdatedOn   time.Time          `bson:"uon,omitempty" json:"updatedOn"`
+	DbId        primitive.ObjectID `bson:"_id,omitempty" json:"-" xml:"-"`
+	Id          uuid.UUID          `bson:"id,omitempty" json:"id" xml:"id"`
+	Name        string             `bson:"nam,omitempty" json:"name" xml:"name"`
+	Value       int                `bson:"val,omitempty" json:"value" xml:"value"`
+	Description string             `bson:"dsc,omitempty" json:"description" xml:"description"`
+	Active      bool               `bson:"act,omitempty" json:"isActive" xml:"isActive"`
+	CreatedOn   time.Time          `bson:"con,omitempty" json:"createdOn" xml:"createdOn"`
+	UpdatedOn   time.Time          `bson:"uon,omitempty" json:"updatedOn" xml:"updatedOn"`
 }
 
 type Error struct {
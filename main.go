@@ -1,22 +1,297 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/vivekmv23/go-web-frameworks/cache"
+	"github.com/vivekmv23/go-web-frameworks/config"
 	"github.com/vivekmv23/go-web-frameworks/database"
+	"github.com/vivekmv23/go-web-frameworks/database/faults"
+	"github.com/vivekmv23/go-web-frameworks/events"
+	"github.com/vivekmv23/go-web-frameworks/fixtures"
+	"github.com/vivekmv23/go-web-frameworks/outbox"
+	"github.com/vivekmv23/go-web-frameworks/resilience"
+	"github.com/vivekmv23/go-web-frameworks/web"
+	"github.com/vivekmv23/go-web-frameworks/webhooks"
 	wfgorillamux "github.com/vivekmv23/go-web-frameworks/wf-gorilla-mux"
+	wfservemux "github.com/vivekmv23/go-web-frameworks/wf-servemux"
 	wfstandardlib "github.com/vivekmv23/go-web-frameworks/wf-standard-lib"
 )
 
+type command struct {
+	name  string
+	usage string
+	run   func(name string, args []string) error
+}
+
+var commands = []command{
+	{"serve", "serve the items API, e.g. serve --framework=servemux --store=memory", serveCommand},
+	{"seed", "insert generated items into the store", seedCommand},
+	{"export", "write every item in the store as a JSON array", exportCommand},
+	{"import", "save items from a JSON array into the store", importCommand},
+	{"bench", "benchmark every framework and write a JSON report", benchCommand},
+	{"indexes", "create missing mongo indexes and report drift, -check only reports", indexesCommand},
+	{"migrate", "apply pending item migrations, e.g. migrate -down -to=3 -dry-run or migrate -status", migrateCommand},
+	{"replay", "replay recorded requests against a framework and report differing responses", replayCommand},
+}
+
 func main() {
-	StartGorillaMuxServer()
+	args := os.Args[1:]
+
+	// no subcommand keeps the old behaviour of just serving
+	name := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == name {
+			if err := cmd.run(cmd.name, args); err != nil {
+				log.Fatalf("%s failed: %s", cmd.name, err)
+			}
+			return
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+	printUsage()
+	os.Exit(2)
+}
+
+func printUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [flags]\n\nCommands:\n", os.Args[0])
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", cmd.name, cmd.usage)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun '%s <command> -h' for the flags of a command.\n", os.Args[0])
+}
+
+func NewItemDatabase(c config.Config) (database.ItemDatabase, error) {
+	m := c.Store.Mongo
+
+	switch {
+	case c.Store.Backend == config.STORE_MEMORY && c.Outbox.Enabled:
+		return database.NewMemoryDatabaseWithOutbox(), nil
+	case c.Store.Backend == config.STORE_MEMORY:
+		return database.NewMemoryDatabase(), nil
+	case c.Store.Backend == config.STORE_SQLITE && c.Outbox.Enabled:
+		return database.NewSqliteDatabaseWithOutbox(c.Store.Sqlite.Path)
+	case c.Store.Backend == config.STORE_SQLITE:
+		return database.NewSqliteDatabase(c.Store.Sqlite.Path)
+	case c.Store.Backend == config.STORE_FILE:
+		return database.NewFileDatabase(c.Store.File)
+	case c.Outbox.Enabled:
+		return database.NewDatabaseWithOutbox(m.URL, m.Database, m.Collection, c.Outbox.Collection), nil
+	default:
+		return database.NewDatabaseWithNames(m.URL, m.Database, m.Collection), nil
+	}
+}
+
+// CloseItemDatabase releases the connections and files of the stores that hold them
+func CloseItemDatabase(d database.ItemDatabase) {
+	c, isCloser := database.Unwrap(d).(io.Closer)
+	if !isCloser {
+		return
+	}
+	if err := c.Close(); err != nil {
+		log.Printf("ERROR: failed to close the store: %s", err)
+	}
+}
+
+// EnsureIndexes creates the missing indexes of a mongo store on startup, drifted indexes are only logged
+func EnsureIndexes(ctx context.Context, c config.Config, d database.ItemDatabase) error {
+	md, isMongo := database.Unwrap(d).(*database.Database)
+	if !isMongo || !c.Store.Mongo.EnsureIndexes {
+		return nil
+	}
+
+	reports, err := md.EnsureIndexes(ctx)
+	for _, r := range reports {
+		if r.InSync() {
+			log.Print(r)
+		} else {
+			log.Printf("WARN: %s", r)
+		}
+	}
+	return err
+}
+
+// NewOutboxRelay relays the outbox of d to the configured sinks, it is nil when the outbox is disabled
+func NewOutboxRelay(c config.Config, d database.ItemDatabase) (*outbox.Relay, error) {
+	source, hasOutbox := database.Unwrap(d).(database.Outbox)
+	if !c.Outbox.Enabled || !hasOutbox {
+		return nil, nil
+	}
+
+	var sinks []outbox.Sink
+	for _, name := range c.Outbox.Sinks {
+		switch name {
+		case config.OUTBOX_SINK_LOG:
+			sinks = append(sinks, outbox.LogSink{})
+		case config.OUTBOX_SINK_FILE:
+			s, err := outbox.NewFileSink(c.Outbox.File)
+			if err != nil {
+				return nil, err
+			}
+			sinks = append(sinks, s)
+		case config.OUTBOX_SINK_WEBHOOK:
+			sinks = append(sinks, outbox.NewWebhookSink(c.Outbox.Webhook.URL, c.Outbox.Webhook.Secret, 10*time.Second))
+		}
+	}
+
+	return outbox.NewRelay(source, time.Duration(c.Outbox.Interval), sinks...), nil
+}
+
+// NewFaultyDatabase injects the faults of the configured scenario into d, it must wrap the store itself
+func NewFaultyDatabase(c config.Config, d database.ItemDatabase) (database.ItemDatabase, error) {
+	if c.Store.Faults == "" {
+		return d, nil
+	}
+
+	s, err := faults.Load(c.Store.Faults)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("WARN: injecting the faults of %s into the %s store", c.Store.Faults, c.Store.Backend)
+	return faults.New(d, s), nil
 }
 
-func StartStdLibServer() {
-	standardLibWebServer := wfstandardlib.StandardLibWebServer{}
-	standardLibWebServer.Start(8080)
+// NewResilientDatabase retries transient failures of d and stops calling it while it keeps failing, when enabled
+func NewResilientDatabase(c config.Config, d database.ItemDatabase) database.ItemDatabase {
+	if !c.Resilience.Enabled {
+		return d
+	}
+	return resilience.NewDatabase(d, c.Resilience)
 }
 
-func StartGorillaMuxServer() {
-	d := database.NewDatabase()
-	gorillamux := wfgorillamux.NewGorillaMuxWebServer(d)
-	gorillamux.Start(8080)
+// NewCacheDatabase caches the items of d by id when the cache is enabled
+func NewCacheDatabase(c config.Config, d database.ItemDatabase) database.ItemDatabase {
+	if !c.Cache.Enabled {
+		return d
+	}
+	return cache.NewDatabase(d, c.Cache)
+}
+
+// NewCacheHandler mounts the cache stats in front of h and evicts changed items on their events when
+// configured, d is the outermost decorator
+func NewCacheHandler(ctx context.Context, c config.Config, d database.ItemDatabase, h http.Handler) http.Handler {
+	o, isObservable := d.(events.Observable)
+
+	for {
+		if cd, isCache := d.(*cache.Database); isCache {
+			if isObservable && c.Cache.Events {
+				go cd.InvalidateOn(ctx, o.Events())
+			}
+			return web.MountCache(h, cd)
+		}
+
+		w, isDecorator := d.(interface{ Unwrap() database.ItemDatabase })
+		if !isDecorator {
+			return h
+		}
+		d = w.Unwrap()
+	}
+}
+
+// NewEventsDatabase attaches the change feed to d when events are enabled, it must be the outermost decorator
+func NewEventsDatabase(ctx context.Context, c config.Config, d database.ItemDatabase) database.ItemDatabase {
+	if !c.Events.Enabled {
+		return d
+	}
+
+	bus := events.NewBus(c.Events.Backlog)
+
+	if md, isMongo := database.Unwrap(d).(*database.Database); isMongo && c.Events.Source == config.EVENTS_FROM_MONGO {
+		go events.WatchMongo(ctx, md, bus)
+		return events.NewObservedDatabase(d, bus)
+	}
+
+	return events.NewPublishingDatabase(d, bus)
+}
+
+// NewWebhooksHandler mounts the webhook endpoints in front of h and starts delivering the changes of d
+func NewWebhooksHandler(ctx context.Context, c config.Config, d database.ItemDatabase, h http.Handler) (http.Handler, error) {
+	o, isObservable := d.(events.Observable)
+	if !c.Webhooks.Enabled || !isObservable {
+		return h, nil
+	}
+
+	var store webhooks.Store
+	switch c.Store.Backend {
+	case config.STORE_MEMORY:
+		store = webhooks.NewMemoryStore()
+	default:
+		var err error
+		if store, err = webhooks.NewMongoStore(c.Store.Mongo.URL, c.Store.Mongo.Database); err != nil {
+			return nil, err
+		}
+	}
+
+	dispatcher := webhooks.NewDispatcher(store, c.Webhooks)
+	go dispatcher.Consume(ctx, o.Events())
+	go dispatcher.Run(ctx)
+
+	return web.MountWebhooks(h, dispatcher), nil
+}
+
+func NewWebServer(c config.Config, d database.ItemDatabase) web.WebServer {
+	middlewares := NewItemsMiddlewares(c)
+
+	switch c.Framework {
+	case config.FRAMEWORK_STDLIB:
+		return wfstandardlib.NewStandardLibWebServer(d, middlewares...)
+	case config.FRAMEWORK_SERVEMUX:
+		return wfservemux.NewServeMuxWebServer(d, middlewares...)
+	default:
+		return wfgorillamux.NewGorillaMuxWebServer(d, middlewares...)
+	}
+}
+
+// NewItemsMiddlewares builds the optional middlewares every framework runs after authentication
+func NewItemsMiddlewares(c config.Config) []web.Middleware {
+	var middlewares []web.Middleware
+
+	if c.RateLimit.Enabled {
+		middlewares = append(middlewares, web.NewRateLimitMiddleware(c.RateLimit))
+	}
+
+	return middlewares
+}
+
+// NewRecorder opens the file requests are recorded to, it is nil when recording is off
+func NewRecorder(c config.Config) (*fixtures.Recorder, error) {
+	if c.Server.Record == "" {
+		return nil, nil
+	}
+
+	log.Printf("Recording requests and responses to %s", c.Server.Record)
+	return fixtures.Create(c.Server.Record)
+}
+
+// NewServerMiddlewares builds the optional middlewares wrapped around the complete handler, before routing,
+// rec may be nil
+func NewServerMiddlewares(c config.Config, rec *fixtures.Recorder) []web.Middleware {
+	var middlewares []web.Middleware
+
+	if c.CORS.Enabled {
+		middlewares = append(middlewares, web.CORSMiddleware(c.CORS))
+	}
+
+	if c.Compression.Enabled {
+		middlewares = append(middlewares, web.CompressionMiddleware(c.Compression))
+	}
+
+	// innermost, so that plain bodies are recorded
+	if rec != nil {
+		middlewares = append(middlewares, web.RecordMiddleware(rec))
+	}
+
+	return middlewares
 }
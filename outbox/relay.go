@@ -0,0 +1,82 @@
+// Package outbox relays the outbox records of a store to sinks. A record is marked published only after
+// every sink took it, so sinks see each change at least once and deduplicate on the record id.
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vivekmv23/go-web-frameworks/database"
+)
+
+const relayBatch = 100
+
+// Sink receives outbox records, it may see a record more than once
+type Sink interface {
+	Name() string
+	Publish(ctx context.Context, r database.OutboxRecord) error
+}
+
+type Relay struct {
+	source   database.Outbox
+	sinks    []Sink
+	interval time.Duration
+}
+
+func NewRelay(source database.Outbox, interval time.Duration, sinks ...Sink) *Relay {
+	return &Relay{source: source, sinks: sinks, interval: interval}
+}
+
+// Run relays pending records until ctx ends, a failing sink holds back the records after the failed one
+func (r *Relay) Run(ctx context.Context) {
+	for {
+		n, err := r.RelayPending(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("ERROR: outbox relay: %s", err)
+		}
+
+		if n == relayBatch && err == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(r.interval):
+		}
+	}
+}
+
+// RelayPending publishes one batch of records in order and returns how many were published
+func (r *Relay) RelayPending(ctx context.Context) (int, error) {
+	records, err := r.source.PendingOutbox(ctx, relayBatch)
+	if err != nil {
+		return 0, err
+	}
+
+	var published []uuid.UUID
+	var failed error
+
+records:
+	for _, record := range records {
+		for _, s := range r.sinks {
+			if err := s.Publish(ctx, record); err != nil {
+				failed = fmt.Errorf("sink %s failed on record %s: %w", s.Name(), record.Id, err)
+				break records
+			}
+		}
+		published = append(published, record.Id)
+	}
+
+	if len(published) > 0 {
+		if err := r.source.MarkPublished(ctx, published); err != nil {
+			// the records go out again with the next batch, which at least once allows
+			return 0, err
+		}
+	}
+
+	return len(published), failed
+}
@@ -0,0 +1,129 @@
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vivekmv23/go-web-frameworks/database"
+	"github.com/vivekmv23/go-web-frameworks/lib"
+	"github.com/vivekmv23/go-web-frameworks/webhooks"
+)
+
+type recordingSink struct {
+	records []database.OutboxRecord
+	failOn  int
+}
+
+func (s *recordingSink) Name() string { return "recording" }
+
+func (s *recordingSink) Publish(ctx context.Context, r database.OutboxRecord) error {
+	if s.failOn > 0 && len(s.records)+1 == s.failOn {
+		s.failOn = 0
+		return fmt.Errorf("sink unavailable")
+	}
+	s.records = append(s.records, r)
+	return nil
+}
+
+// writeItem creates, updates and deletes an item, which leaves three records in the outbox
+func writeItem(t *testing.T, d database.ItemDatabase) {
+	i := lib.Item{Name: "name"}
+	require.NoError(t, d.SaveItem(&i))
+	updated, err := d.UpdateItem(i, i.UpdatedOn.String())
+	require.NoError(t, err)
+	require.NoError(t, d.DeleteItemById(updated.Id))
+}
+
+func TestRelay_AtLeastOnceInOrder(t *testing.T) {
+	d := database.NewMemoryDatabaseWithOutbox()
+	writeItem(t, d)
+
+	first := &recordingSink{}
+	second := &recordingSink{failOn: 2}
+	r := NewRelay(d.(database.Outbox), time.Second, first, second)
+
+	n, err := r.RelayPending(context.Background())
+	assert.Error(t, err)
+	assert.Equal(t, 1, n, "records before the failed one are published")
+
+	n, err = r.RelayPending(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	n, err = r.RelayPending(context.Background())
+	assert.NoError(t, err)
+	assert.Zero(t, n)
+
+	require.Len(t, second.records, 3)
+	assert.Equal(t, database.OUTBOX_ITEM_CREATED, second.records[0].Type)
+	assert.Equal(t, database.OUTBOX_ITEM_UPDATED, second.records[1].Type)
+	assert.Equal(t, database.OUTBOX_ITEM_DELETED, second.records[2].Type)
+
+	// the first sink took the update before the second one failed on it and got it again
+	require.Len(t, first.records, 4)
+	assert.Equal(t, first.records[1].Id, first.records[2].Id, "a repeated record keeps its deduplication id")
+}
+
+func TestRelay_WithoutOutbox(t *testing.T) {
+	_, err := NewRelay(database.NewMemoryDatabase().(database.Outbox), time.Second, LogSink{}).RelayPending(context.Background())
+	assert.Error(t, err)
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+	s, err := NewFileSink(path)
+	require.NoError(t, err)
+
+	d := database.NewMemoryDatabaseWithOutbox()
+	writeItem(t, d)
+	_, err = NewRelay(d.(database.Outbox), time.Second, s).RelayPending(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	lines := 0
+	for sc := bufio.NewScanner(f); sc.Scan(); lines++ {
+		var r database.OutboxRecord
+		assert.NoError(t, json.Unmarshal(sc.Bytes(), &r))
+		assert.NotEmpty(t, r.Type)
+	}
+	assert.Equal(t, 3, lines)
+}
+
+func TestWebhookSink(t *testing.T) {
+	var keys []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := webhooks.Verify("secret", r.Header, body, time.Minute); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		keys = append(keys, r.Header.Get(HEADER_IDEMPOTENCY_KEY))
+	}))
+	defer s.Close()
+
+	d := database.NewMemoryDatabaseWithOutbox()
+	writeItem(t, d)
+
+	_, err := NewRelay(d.(database.Outbox), time.Second, NewWebhookSink(s.URL, "wrong", time.Second)).RelayPending(context.Background())
+	assert.Error(t, err)
+
+	n, err := NewRelay(d.(database.Outbox), time.Second, NewWebhookSink(s.URL, "secret", time.Second)).RelayPending(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Len(t, keys, 3)
+}
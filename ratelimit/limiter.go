@@ -0,0 +1,119 @@
+// Package ratelimit implements token bucket quotas per key, kept in process.
+// Limiter is deliberately small so a shared store can replace the in memory one later.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Limiter takes one token for key per call
+type Limiter interface {
+	Allow(key string) Decision
+}
+
+// Decision describes the quota of a key right after a token was requested
+type Decision struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter is how long until the next token is available, zero when allowed
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is full again
+	Reset time.Duration
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// TokenBucketLimiter refills every bucket at rate tokens per second up to burst tokens
+type TokenBucketLimiter struct {
+	rate  float64
+	burst int
+	now   func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	// sweepAt is the bucket count that triggers dropping full buckets
+	sweepAt int
+}
+
+const minSweepAt = 1024
+
+func NewTokenBucketLimiter(rate float64, burst int) *TokenBucketLimiter {
+	return &TokenBucketLimiter{
+		rate:    rate,
+		burst:   burst,
+		now:     time.Now,
+		buckets: map[string]*bucket{},
+		sweepAt: minSweepAt,
+	}
+}
+
+func (l *TokenBucketLimiter) Allow(key string) Decision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+
+	b, found := l.buckets[key]
+	if !found {
+		l.sweep(now)
+		b = &bucket{tokens: float64(l.burst), last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = l.refill(b, now)
+	b.last = now
+
+	d := Decision{Limit: l.burst}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		d.Allowed = true
+	} else {
+		d.RetryAfter = l.timeFor(1 - b.tokens)
+	}
+
+	d.Remaining = int(math.Floor(b.tokens))
+	d.Reset = l.timeFor(float64(l.burst) - b.tokens)
+
+	return d
+}
+
+func (l *TokenBucketLimiter) refill(b *bucket, now time.Time) float64 {
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed <= 0 {
+		return b.tokens
+	}
+	return math.Min(float64(l.burst), b.tokens+elapsed*l.rate)
+}
+
+// timeFor is how long refilling the given number of tokens takes
+func (l *TokenBucketLimiter) timeFor(tokens float64) time.Duration {
+	if tokens <= 0 {
+		return 0
+	}
+	if l.rate <= 0 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(tokens / l.rate * float64(time.Second))
+}
+
+// sweep drops buckets that have refilled completely, they behave exactly like new ones
+func (l *TokenBucketLimiter) sweep(now time.Time) {
+	if len(l.buckets) < l.sweepAt {
+		return
+	}
+
+	for key, b := range l.buckets {
+		if l.refill(b, now) >= float64(l.burst) {
+			delete(l.buckets, key)
+		}
+	}
+
+	l.sweepAt = max(minSweepAt, 2*len(l.buckets))
+}
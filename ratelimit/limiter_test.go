@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time { return c.t }
+
+func newTestLimiter(rate float64, burst int) (*TokenBucketLimiter, *clock) {
+	c := &clock{t: time.Date(2024, 9, 1, 10, 0, 0, 0, time.UTC)}
+	l := NewTokenBucketLimiter(rate, burst)
+	l.now = c.now
+	return l, c
+}
+
+func TestTokenBucketLimiter_Burst(t *testing.T) {
+	l, _ := newTestLimiter(1, 3)
+
+	for n := 2; n >= 0; n-- {
+		d := l.Allow("k")
+		assert.True(t, d.Allowed)
+		assert.Equal(t, 3, d.Limit)
+		assert.Equal(t, n, d.Remaining)
+	}
+
+	d := l.Allow("k")
+	assert.False(t, d.Allowed)
+	assert.Equal(t, 0, d.Remaining)
+	assert.Equal(t, time.Second, d.RetryAfter)
+	assert.Equal(t, 3*time.Second, d.Reset)
+
+	assert.True(t, l.Allow("other").Allowed, "keys have their own buckets")
+}
+
+func TestTokenBucketLimiter_Refill(t *testing.T) {
+	l, c := newTestLimiter(2, 2)
+
+	l.Allow("k")
+	l.Allow("k")
+	assert.False(t, l.Allow("k").Allowed)
+
+	c.t = c.t.Add(500 * time.Millisecond)
+	d := l.Allow("k")
+	assert.True(t, d.Allowed)
+	assert.Equal(t, 0, d.Remaining)
+
+	c.t = c.t.Add(time.Hour)
+	d = l.Allow("k")
+	assert.True(t, d.Allowed)
+	assert.Equal(t, 1, d.Remaining, "refill is capped at burst")
+}
+
+func TestTokenBucketLimiter_Sweep(t *testing.T) {
+	l, c := newTestLimiter(1, 1)
+
+	for n := 0; n < minSweepAt; n++ {
+		l.Allow(fmt.Sprintf("k%d", n))
+	}
+
+	c.t = c.t.Add(time.Minute)
+	l.Allow("new")
+
+	assert.Len(t, l.buckets, 1)
+}
@@ -0,0 +1,74 @@
+package resilience
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	CLOSED    = "closed"
+	OPEN      = "open"
+	HALF_OPEN = "half-open"
+)
+
+// Breaker opens after threshold failures in a row and refuses calls for openTimeout. After that it is
+// half-open and lets a single trial call through, which closes it again or reopens it.
+type Breaker struct {
+	threshold   int
+	openTimeout time.Duration
+	now         func() time.Time
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+}
+
+func NewBreaker(threshold int, openTimeout time.Duration) *Breaker {
+	return &Breaker{threshold: threshold, openTimeout: openTimeout, now: time.Now, state: CLOSED}
+}
+
+// Allow reports whether a call may go ahead, and otherwise how long until the store is tried again.
+// Every allowed call must be followed by Record.
+func (b *Breaker) Allow() (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CLOSED:
+		return true, 0
+	case OPEN:
+		if wait := b.openTimeout - b.now().Sub(b.openedAt); wait > 0 {
+			return false, wait
+		}
+		b.state = HALF_OPEN
+		return true, 0
+	default:
+		// the trial call is still under way
+		return false, 0
+	}
+}
+
+// Record counts the outcome of an allowed call, failed is only set for failures of the store itself
+func (b *Breaker) Record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !failed {
+		b.state = CLOSED
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == HALF_OPEN || b.failures >= b.threshold {
+		b.state = OPEN
+		b.openedAt = b.now()
+	}
+}
+
+func (b *Breaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
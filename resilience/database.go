@@ -0,0 +1,158 @@
+// Package resilience keeps transient store failures away from clients. Calls that fail with a
+// transient error are retried after a jittered backoff, and a store that keeps failing is not called
+// at all for a while: the circuit opens and calls fail right away with database.Unavailable, which
+// the servers answer with 503.
+package resilience
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vivekmv23/go-web-frameworks/config"
+	"github.com/vivekmv23/go-web-frameworks/database"
+	"github.com/vivekmv23/go-web-frameworks/lib"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var ErrCircuitOpen = errors.New("circuit breaker is open after repeated failures")
+
+// IsTransient reports failures that may not happen again: network errors, timeouts and errors mongo
+// labels as retryable. NotFound, Conflict and Outdated are answers of a working store, not failures.
+func IsTransient(err error) bool {
+	var u *database.Unclassified
+	if !errors.As(err, &u) {
+		return false
+	}
+
+	var le mongo.LabeledError
+	if errors.As(u.Err, &le) && (le.HasErrorLabel("RetryableWriteError") || le.HasErrorLabel("TransientTransactionError")) {
+		return true
+	}
+
+	var oe *net.OpError
+	return mongo.IsNetworkError(u.Err) || mongo.IsTimeout(u.Err) || errors.As(u.Err, &oe) || errors.Is(u.Err, context.DeadlineExceeded)
+}
+
+// Should satisfy ItemDatabase interface, decorates another store with retries and a circuit breaker
+type Database struct {
+	database.ItemDatabase
+	c       config.ResilienceConfig
+	breaker *Breaker
+
+	// retryable decides which errors are retried and count as failures of the store
+	retryable func(err error) bool
+	sleep     func(d time.Duration)
+	jitter    func(ceiling time.Duration) time.Duration
+}
+
+func NewDatabase(d database.ItemDatabase, c config.ResilienceConfig) *Database {
+	return &Database{
+		ItemDatabase: d,
+		c:            c,
+		breaker:      NewBreaker(c.FailureThreshold, time.Duration(c.OpenTimeout)),
+		retryable:    IsTransient,
+		sleep:        time.Sleep,
+		jitter: func(ceiling time.Duration) time.Duration {
+			return time.Duration(rand.Int63n(int64(ceiling) + 1))
+		},
+	}
+}
+
+func (d *Database) Unwrap() database.ItemDatabase {
+	return d.ItemDatabase
+}
+
+// Breaker is the circuit breaker in front of the store
+func (d *Database) Breaker() *Breaker {
+	return d.breaker
+}
+
+// call runs fn until it succeeds, fails with an error that is not retryable or runs out of attempts.
+// Writes only get one attempt unless RetryWrites is set.
+func (d *Database) call(write bool, fn func() error) error {
+	attempts := d.c.MaxAttempts
+	if write && !d.c.RetryWrites {
+		attempts = 1
+	}
+
+	for attempt := 1; ; attempt++ {
+		if allowed, retryAfter := d.breaker.Allow(); !allowed {
+			return &database.Unavailable{Err: ErrCircuitOpen, RetryAfter: retryAfter}
+		}
+
+		failed, err := d.try(fn)
+		if !failed || attempt >= attempts {
+			return err
+		}
+		d.sleep(d.backoff(attempt))
+	}
+}
+
+// try runs fn once and records its outcome. A panic counts as a failure and is passed on, the
+// breaker would stay half-open forever if a panicking trial call went unrecorded.
+func (d *Database) try(fn func() error) (failed bool, err error) {
+	failed = true
+	defer func() { d.breaker.Record(failed) }()
+
+	err = fn()
+	failed = err != nil && d.retryable(err)
+	return failed, err
+}
+
+// backoff is a random wait below Backoff doubled for every earlier retry, capped at MaxBackoff
+func (d *Database) backoff(attempt int) time.Duration {
+	ceiling := time.Duration(d.c.MaxBackoff)
+	if shift := attempt - 1; shift < 32 {
+		ceiling = min(ceiling, time.Duration(d.c.Backoff)<<shift)
+	}
+	return d.jitter(ceiling)
+}
+
+func (d *Database) SaveItem(i *lib.Item) error {
+	return d.call(true, func() error {
+		return d.ItemDatabase.SaveItem(i)
+	})
+}
+
+func (d *Database) GetItemById(id uuid.UUID) (i lib.Item, err error) {
+	err = d.call(false, func() error {
+		i, err = d.ItemDatabase.GetItemById(id)
+		return err
+	})
+	return i, err
+}
+
+func (d *Database) GetAllItems() (items []lib.Item, err error) {
+	err = d.call(false, func() error {
+		items, err = d.ItemDatabase.GetAllItems()
+		return err
+	})
+	return items, err
+}
+
+// GetItemCursor retries opening the cursor, a failure while walking it reaches the caller
+func (d *Database) GetItemCursor(ctx context.Context) (c database.ItemCursor, err error) {
+	err = d.call(false, func() error {
+		c, err = d.ItemDatabase.GetItemCursor(ctx)
+		return err
+	})
+	return c, err
+}
+
+func (d *Database) DeleteItemById(id uuid.UUID) error {
+	return d.call(true, func() error {
+		return d.ItemDatabase.DeleteItemById(id)
+	})
+}
+
+func (d *Database) UpdateItem(i lib.Item, ifMatch string) (updated lib.Item, err error) {
+	err = d.call(true, func() error {
+		updated, err = d.ItemDatabase.UpdateItem(i, ifMatch)
+		return err
+	})
+	return updated, err
+}
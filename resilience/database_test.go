@@ -0,0 +1,217 @@
+package resilience
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vivekmv23/go-web-frameworks/config"
+	"github.com/vivekmv23/go-web-frameworks/database"
+	"github.com/vivekmv23/go-web-frameworks/lib"
+)
+
+var errReset = &database.Unclassified{Err: &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}}
+
+// errPanic makes the faulty store panic instead of returning an error
+var errPanic = errors.New("store panicked")
+
+// faultyStore fails its next calls with the queued faults, a nil fault lets the call through to the
+// memory store
+type faultyStore struct {
+	database.ItemDatabase
+
+	mu     sync.Mutex
+	faults []error
+	calls  int
+}
+
+func (s *faultyStore) fail(faults ...error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, faults...)
+}
+
+func (s *faultyStore) next() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls++
+	if len(s.faults) == 0 {
+		return nil
+	}
+	err := s.faults[0]
+	s.faults = s.faults[1:]
+	if err == errPanic {
+		panic(err)
+	}
+	return err
+}
+
+func (s *faultyStore) SaveItem(i *lib.Item) error {
+	if err := s.next(); err != nil {
+		return err
+	}
+	return s.ItemDatabase.SaveItem(i)
+}
+
+func (s *faultyStore) GetItemById(id uuid.UUID) (lib.Item, error) {
+	if err := s.next(); err != nil {
+		return lib.Item{}, err
+	}
+	return s.ItemDatabase.GetItemById(id)
+}
+
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time { return c.t }
+
+func newTestDatabase(c config.ResilienceConfig) (*Database, *faultyStore, *clock, *[]time.Duration) {
+	store := &faultyStore{ItemDatabase: database.NewMemoryDatabase()}
+	clk := &clock{t: time.Date(2024, 9, 1, 10, 0, 0, 0, time.UTC)}
+	var sleeps []time.Duration
+
+	d := NewDatabase(store, c)
+	d.breaker.now = clk.now
+	d.sleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+	// the longest possible wait, so that the doubling shows
+	d.jitter = func(ceiling time.Duration) time.Duration { return ceiling }
+	return d, store, clk, &sleeps
+}
+
+func testConfig() config.ResilienceConfig {
+	c := config.Default().Resilience
+	c.Enabled = true
+	c.MaxAttempts = 4
+	c.Backoff = config.Duration(50 * time.Millisecond)
+	c.MaxBackoff = config.Duration(120 * time.Millisecond)
+	return c
+}
+
+func TestTransientFailuresAreRetried(t *testing.T) {
+	d, store, _, sleeps := newTestDatabase(testConfig())
+	i := lib.Item{Name: "a"}
+	require.NoError(t, d.SaveItem(&i))
+
+	store.fail(errReset, errReset, errReset)
+	found, err := d.GetItemById(i.Id)
+
+	require.NoError(t, err)
+	assert.Equal(t, "a", found.Name)
+	assert.Equal(t, 5, store.calls)
+	assert.Equal(t, []time.Duration{50 * time.Millisecond, 100 * time.Millisecond, 120 * time.Millisecond}, *sleeps)
+}
+
+func TestAttemptsAreBounded(t *testing.T) {
+	d, store, _, _ := newTestDatabase(testConfig())
+
+	store.fail(errReset, errReset, errReset, errReset, errReset)
+	_, err := d.GetItemById(uuid.New())
+
+	assert.Equal(t, errReset, err)
+	assert.Equal(t, 4, store.calls)
+}
+
+func TestOnlyTransientErrorsAreRetried(t *testing.T) {
+	d, store, _, _ := newTestDatabase(testConfig())
+
+	_, err := d.GetItemById(uuid.New())
+	assert.IsType(t, &database.NotFound{}, err)
+
+	store.fail(&database.Unclassified{Err: errors.New("document is too large")})
+	_, err = d.GetItemById(uuid.New())
+	assert.IsType(t, &database.Unclassified{}, err)
+
+	assert.Equal(t, 2, store.calls)
+}
+
+func TestWritesAreRetriedWhenEnabled(t *testing.T) {
+	d, store, _, _ := newTestDatabase(testConfig())
+
+	store.fail(errReset)
+	err := d.SaveItem(&lib.Item{Name: "a"})
+	assert.Equal(t, errReset, err, "a write that failed may have been applied")
+
+	c := testConfig()
+	c.RetryWrites = true
+	d, store, _, _ = newTestDatabase(c)
+
+	store.fail(errReset)
+	assert.NoError(t, d.SaveItem(&lib.Item{Name: "a"}))
+	assert.Equal(t, 2, store.calls)
+}
+
+func TestCircuitOpensAndRecovers(t *testing.T) {
+	c := testConfig()
+	c.MaxAttempts = 1
+	c.FailureThreshold = 3
+	c.OpenTimeout = config.Duration(10 * time.Second)
+	d, store, clk, _ := newTestDatabase(c)
+	id := uuid.New()
+
+	store.fail(errReset, errReset, errReset)
+	for range 3 {
+		d.GetItemById(id)
+	}
+	assert.Equal(t, OPEN, d.Breaker().State())
+
+	clk.t = clk.t.Add(4 * time.Second)
+	_, err := d.GetItemById(id)
+	require.IsType(t, &database.Unavailable{}, err)
+	assert.Equal(t, 6*time.Second, err.(*database.Unavailable).RetryAfter)
+	assert.Equal(t, 3, store.calls, "the store is not called while the circuit is open")
+
+	clk.t = clk.t.Add(6 * time.Second)
+	store.fail(errReset)
+	d.GetItemById(id)
+	assert.Equal(t, OPEN, d.Breaker().State(), "a failed trial opens the circuit again")
+
+	clk.t = clk.t.Add(10 * time.Second)
+	_, err = d.GetItemById(id)
+	assert.IsType(t, &database.NotFound{}, err, "answers of the store close the circuit")
+	assert.Equal(t, CLOSED, d.Breaker().State())
+}
+
+func TestSuccessResetsFailures(t *testing.T) {
+	c := testConfig()
+	c.MaxAttempts = 1
+	c.FailureThreshold = 2
+	d, store, _, _ := newTestDatabase(c)
+
+	store.fail(errReset, nil, errReset)
+	for range 3 {
+		d.GetItemById(uuid.New())
+	}
+
+	assert.Equal(t, CLOSED, d.Breaker().State())
+}
+
+func TestPanickingTrialReopensCircuit(t *testing.T) {
+	c := testConfig()
+	c.MaxAttempts = 1
+	c.FailureThreshold = 1
+	c.OpenTimeout = config.Duration(10 * time.Second)
+	d, store, clk, _ := newTestDatabase(c)
+	id := uuid.New()
+
+	store.fail(errReset)
+	d.GetItemById(id)
+	require.Equal(t, OPEN, d.Breaker().State())
+
+	clk.t = clk.t.Add(10 * time.Second)
+	store.fail(errPanic)
+	assert.PanicsWithValue(t, errPanic, func() { d.GetItemById(id) })
+	assert.Equal(t, OPEN, d.Breaker().State(), "a panicking trial opens the circuit again")
+
+	clk.t = clk.t.Add(10 * time.Second)
+	_, err := d.GetItemById(id)
+	assert.IsType(t, &database.NotFound{}, err)
+	assert.Equal(t, CLOSED, d.Breaker().State())
+}
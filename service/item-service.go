@@ -0,0 +1,89 @@
+// Package service holds the item use cases shared by every framework implementation.
+// Inputs arrive already extracted from the request and failures are typed errors,
+// either from this package or from database, which the web package maps to status codes.
+package service
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/vivekmv23/go-web-frameworks/database"
+	"github.com/vivekmv23/go-web-frameworks/events"
+	"github.com/vivekmv23/go-web-frameworks/lib"
+)
+
+type ItemService struct {
+	d database.ItemDatabase
+}
+
+func NewItemService(d database.ItemDatabase) *ItemService {
+	return &ItemService{d: d}
+}
+
+func (s *ItemService) GetAllItems() ([]lib.Item, error) {
+	return s.d.GetAllItems()
+}
+
+// GetItemCursor streams all items, the caller closes the cursor
+func (s *ItemService) GetItemCursor(ctx context.Context) (database.ItemCursor, error) {
+	return s.d.GetItemCursor(ctx)
+}
+
+func (s *ItemService) CreateItem(i lib.Item) (lib.Item, error) {
+	err := s.d.SaveItem(&i)
+	return i, err
+}
+
+func (s *ItemService) GetItemById(id string) (lib.Item, error) {
+	idToGet, err := ParseId(id)
+	if err != nil {
+		return lib.Item{}, err
+	}
+
+	return s.d.GetItemById(idToGet)
+}
+
+// ValidateUpdate checks the inputs of UpdateItem that are available before the body is read
+func (s *ItemService) ValidateUpdate(id string, ifMatch string) error {
+	if ifMatch == "" {
+		return &PreconditionRequired{}
+	}
+
+	_, err := ParseId(id)
+	return err
+}
+
+func (s *ItemService) UpdateItem(id string, ifMatch string, i lib.Item) (lib.Item, error) {
+	if err := s.ValidateUpdate(id, ifMatch); err != nil {
+		return i, err
+	}
+
+	i.Id, _ = ParseId(id)
+
+	return s.d.UpdateItem(i, ifMatch)
+}
+
+func (s *ItemService) DeleteItemById(id string) error {
+	idToDelete, err := ParseId(id)
+	if err != nil {
+		return err
+	}
+
+	return s.d.DeleteItemById(idToDelete)
+}
+
+// Events returns the bus the store publishes its changes to, nil when the store has none
+func (s *ItemService) Events() *events.Bus {
+	if o, isObservable := s.d.(events.Observable); isObservable {
+		return o.Events()
+	}
+	return nil
+}
+
+func ParseId(id string) (uuid.UUID, error) {
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		return parsed, &InvalidInput{Err: err}
+	}
+	return parsed, nil
+}
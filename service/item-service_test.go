@@ -0,0 +1,51 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/vivekmv23/go-web-frameworks/database"
+	"github.com/vivekmv23/go-web-frameworks/lib"
+)
+
+func TestItemService_InvalidId(t *testing.T) {
+	s := NewItemService(database.NewMemoryDatabase())
+
+	_, err := s.GetItemById("not-a-uuid")
+	assert.IsType(t, &InvalidInput{}, err)
+
+	err = s.DeleteItemById("not-a-uuid")
+	assert.IsType(t, &InvalidInput{}, err)
+
+	_, err = s.UpdateItem("not-a-uuid", "some-e-tag", lib.Item{})
+	assert.IsType(t, &InvalidInput{}, err)
+}
+
+func TestItemService_UpdatePrecondition(t *testing.T) {
+	s := NewItemService(database.NewMemoryDatabase())
+	created, err := s.CreateItem(lib.Item{Name: "name"})
+	assert.NoError(t, err)
+
+	// missing If-Match wins over a bad id so clients learn about it first
+	assert.IsType(t, &PreconditionRequired{}, s.ValidateUpdate("not-a-uuid", ""))
+
+	_, err = s.UpdateItem(created.Id.String(), "stale", lib.Item{Name: "renamed"})
+	assert.IsType(t, &database.Outdated{}, err)
+
+	updated, err := s.UpdateItem(created.Id.String(), created.UpdatedOn.String(), lib.Item{Id: uuid.New(), Name: "renamed"})
+	assert.NoError(t, err)
+	assert.Equal(t, created.Id, updated.Id, "the path id wins over the body id")
+	assert.Equal(t, "renamed", updated.Name)
+}
+
+func TestItemService_NotFound(t *testing.T) {
+	s := NewItemService(database.NewMemoryDatabase())
+	id := uuid.NewString()
+
+	_, err := s.GetItemById(id)
+	assert.IsType(t, &database.NotFound{}, err)
+
+	err = s.DeleteItemById(id)
+	assert.IsType(t, &database.NotFound{}, err)
+}
@@ -0,0 +1,22 @@
+package service
+
+// InvalidInput is returned when a caller supplied id or item can not be used
+type InvalidInput struct {
+	Err error
+}
+
+func (i *InvalidInput) Error() string {
+	return i.Err.Error()
+}
+
+func (i *InvalidInput) Unwrap() error {
+	return i.Err
+}
+
+// PreconditionRequired is returned when an update does not state which version it replaces
+type PreconditionRequired struct {
+}
+
+func (p *PreconditionRequired) Error() string {
+	return "If-Match is required header for update"
+}
@@ -0,0 +1,44 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/vivekmv23/go-web-frameworks/cache"
+)
+
+var cacheFallbackPatterns = []string{"/cache"}
+
+// CacheEndpoints show the hit and miss counters of the item cache, like the webhook endpoints they
+// are shared by every framework
+type CacheEndpoints struct {
+	c *cache.Database
+}
+
+// MountCache routes /cache to the cache endpoints behind authentication and everything else to next
+func MountCache(next http.Handler, c *cache.Database) http.Handler {
+	e := &CacheEndpoints{c: c}
+	mux := http.NewServeMux()
+
+	handle := func(pattern string, h http.HandlerFunc) {
+		mux.Handle(pattern, Chain(h, LogRequestMiddleware, AuthenticationMiddleware, LogResponseMiddleware))
+	}
+
+	handle("GET /cache", e.Stats)
+	handle("DELETE /cache", e.Purge)
+
+	for _, pattern := range cacheFallbackPatterns {
+		mux.Handle(pattern, ServeMuxNoRoute(mux, cacheFallbackPatterns...))
+	}
+	mux.Handle("/", next)
+
+	return mux
+}
+
+func (e *CacheEndpoints) Stats(w http.ResponseWriter, r *http.Request) {
+	SuccessResponse(http.StatusOK, w, r, e.c.Stats())
+}
+
+func (e *CacheEndpoints) Purge(w http.ResponseWriter, r *http.Request) {
+	e.c.Purge()
+	SuccessResponse(http.StatusNoContent, w, r, nil)
+}
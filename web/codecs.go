@@ -0,0 +1,411 @@
+package web
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vivekmv23/go-web-frameworks/lib"
+)
+
+const (
+	CONTENT_TYPE_JSON = "application/json"
+
+	// request bodies are capped before any codec reads them, items are far smaller
+	maxRequestBody = 1 << 20
+)
+
+// Codec reads and writes response and request bodies in one media type
+type Codec interface {
+	// ContentTypes lists the media types of the codec, the first one is sent in Content-Type
+	ContentTypes() []string
+	// Supports reports whether Encode can represent v
+	Supports(v any) bool
+	Encode(w io.Writer, v any) error
+	Decode(r io.Reader, v any) error
+}
+
+// NotAcceptable is returned when no codec can answer in a media type the client accepts
+type NotAcceptable struct {
+	Accept string
+}
+
+func (n *NotAcceptable) Error() string {
+	return fmt.Sprintf("none of the accepted media types %q can be served, supported are %s", n.Accept, strings.Join(supportedContentTypes(), ", "))
+}
+
+// UnsupportedMediaType is returned when no codec reads the Content-Type of a request
+type UnsupportedMediaType struct {
+	ContentType string
+}
+
+func (u *UnsupportedMediaType) Error() string {
+	return fmt.Sprintf("request content type %q is not supported, supported are %s", u.ContentType, strings.Join(supportedContentTypes(), ", "))
+}
+
+var (
+	codecsMu sync.RWMutex
+	// codecs are tried in order when the client accepts several media types equally, JSON stays the default
+	codecs = []Codec{jsonCodec{}, csvCodec{}, xmlCodec{}, msgpackCodec{}, ndjsonCodec{}}
+)
+
+// RegisterCodec adds a codec after the built in ones, codecs registered later lose ties
+func RegisterCodec(c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	// a new backing array, so that callers ranging over the old list are not affected
+	codecs = append(slices.Clip(codecs), c)
+}
+
+func registeredCodecs() []Codec {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	return codecs
+}
+
+func supportedContentTypes() []string {
+	var types []string
+	for _, c := range registeredCodecs() {
+		types = append(types, c.ContentTypes()[0])
+	}
+	return types
+}
+
+// NegotiateCodec picks the codec for v with the highest quality in the Accept header
+func NegotiateCodec(accept string, v any) (Codec, error) {
+	if strings.TrimSpace(accept) == "" {
+		accept = "*/*"
+	}
+
+	ranges := parseAccept(accept)
+
+	var best Codec
+	bestQ := 0.0
+	for _, c := range registeredCodecs() {
+		if !c.Supports(v) {
+			continue
+		}
+		if q := quality(ranges, c.ContentTypes()); q > bestQ {
+			best, bestQ = c, q
+		}
+	}
+
+	if best == nil {
+		return nil, &NotAcceptable{Accept: accept}
+	}
+	return best, nil
+}
+
+// CheckAcceptable fails when no codec at all serves the Accept header of r, so
+// handlers can refuse before they change anything
+func CheckAcceptable(r *http.Request) error {
+	accept := r.Header.Get("Accept")
+	if strings.TrimSpace(accept) == "" {
+		return nil
+	}
+
+	ranges := parseAccept(accept)
+	for _, c := range registeredCodecs() {
+		if quality(ranges, c.ContentTypes()) > 0 {
+			return nil
+		}
+	}
+	return &NotAcceptable{Accept: accept}
+}
+
+// DecodeRequest reads the body of r with the codec of its Content-Type, JSON when none is given.
+// Bodies longer than maxRequestBody fail with *http.MaxBytesError.
+func DecodeRequest(w http.ResponseWriter, r *http.Request, v any) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBody)
+
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		return jsonCodec{}.Decode(r.Body, v)
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return &UnsupportedMediaType{ContentType: contentType}
+	}
+
+	for _, c := range registeredCodecs() {
+		for _, t := range c.ContentTypes() {
+			if t == mediaType {
+				return c.Decode(r.Body, v)
+			}
+		}
+	}
+
+	return &UnsupportedMediaType{ContentType: contentType}
+}
+
+type mediaRange struct {
+	typ, subtype string
+	q            float64
+}
+
+func parseAccept(accept string) []mediaRange {
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		typ, subtype, _ := strings.Cut(mediaType, "/")
+		q := 1.0
+		if v, found := params["q"]; found {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		ranges = append(ranges, mediaRange{typ: typ, subtype: subtype, q: q})
+	}
+	return ranges
+}
+
+// quality is the q-value of the most specific range matching any of the content types
+func quality(ranges []mediaRange, contentTypes []string) float64 {
+	best, bestSpecificity := 0.0, -1
+
+	for _, ct := range contentTypes {
+		typ, subtype, _ := strings.Cut(ct, "/")
+		for _, r := range ranges {
+			specificity := -1
+			switch {
+			case r.typ == typ && r.subtype == subtype:
+				specificity = 2
+			case r.typ == typ && r.subtype == "*":
+				specificity = 1
+			case r.typ == "*" && r.subtype == "*":
+				specificity = 0
+			}
+			if specificity > bestSpecificity || (specificity == bestSpecificity && specificity >= 0 && r.q > best) {
+				best, bestSpecificity = r.q, specificity
+			}
+		}
+	}
+
+	if bestSpecificity < 0 {
+		return 0
+	}
+	return best
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentTypes() []string { return []string{CONTENT_TYPE_JSON} }
+
+func (jsonCodec) Supports(v any) bool { return true }
+
+func (jsonCodec) Encode(w io.Writer, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+func (jsonCodec) Decode(r io.Reader, v any) error {
+	return json.NewDecoder(r).Decode(v)
+}
+
+type xmlItems struct {
+	XMLName xml.Name   `xml:"items"`
+	Items   []lib.Item `xml:"item"`
+}
+
+type xmlCodec struct{}
+
+func (xmlCodec) ContentTypes() []string { return []string{"application/xml", "text/xml"} }
+
+func (xmlCodec) Supports(v any) bool {
+	switch v.(type) {
+	case lib.Item, *lib.Item, []lib.Item:
+		return true
+	}
+	return false
+}
+
+func (xmlCodec) Encode(w io.Writer, v any) error {
+	if items, isList := v.([]lib.Item); isList {
+		v = xmlItems{Items: items}
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	e := xml.NewEncoder(w)
+	if _, isList := v.(xmlItems); isList {
+		return e.Encode(v)
+	}
+	return e.EncodeElement(v, xml.StartElement{Name: xml.Name{Local: "item"}})
+}
+
+func (xmlCodec) Decode(r io.Reader, v any) error {
+	if items, isList := v.(*[]lib.Item); isList {
+		var wrapper xmlItems
+		err := xml.NewDecoder(r).Decode(&wrapper)
+		*items = wrapper.Items
+		return err
+	}
+	return xml.NewDecoder(r).Decode(v)
+}
+
+var csvHeader = []string{"id", "name", "value", "description", "isActive", "createdOn", "updatedOn"}
+
+// spreadsheets read cells starting with one of these as formulas
+const csvFormulaPrefixes = "=+-@\t\r"
+
+// csvText quotes text cells that a spreadsheet would run as a formula, csvUntext reverses it
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune(csvFormulaPrefixes, rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+func csvUntext(s string) string {
+	if len(s) > 1 && s[0] == '\'' && strings.ContainsRune(csvFormulaPrefixes, rune(s[1])) {
+		return s[1:]
+	}
+	return s
+}
+
+// csvCodec writes items as rows under a header, so lists open directly in a spreadsheet
+type csvCodec struct{}
+
+func (csvCodec) ContentTypes() []string { return []string{"text/csv"} }
+
+func (csvCodec) Supports(v any) bool {
+	switch v.(type) {
+	case lib.Item, *lib.Item, []lib.Item:
+		return true
+	}
+	return false
+}
+
+func (csvCodec) Encode(w io.Writer, v any) error {
+	var items []lib.Item
+	switch t := v.(type) {
+	case lib.Item:
+		items = []lib.Item{t}
+	case *lib.Item:
+		items = []lib.Item{*t}
+	case []lib.Item:
+		items = t
+	default:
+		return fmt.Errorf("can not encode %T as csv", v)
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write(csvHeader)
+	for _, i := range items {
+		cw.Write([]string{
+			i.Id.String(),
+			csvText(i.Name),
+			strconv.Itoa(i.Value),
+			csvText(i.Description),
+			strconv.FormatBool(i.Active),
+			i.CreatedOn.Format(time.RFC3339Nano),
+			i.UpdatedOn.Format(time.RFC3339Nano),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Decode reads a header row and then one row per item, columns may be in any order and missing
+func (csvCodec) Decode(r io.Reader, v any) error {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return err
+	}
+	if len(records) < 1 {
+		return fmt.Errorf("csv body needs a header row")
+	}
+
+	columns := map[string]int{}
+	for idx, name := range records[0] {
+		columns[strings.TrimSpace(name)] = idx
+	}
+
+	items := make([]lib.Item, 0, len(records)-1)
+	for _, record := range records[1:] {
+		i, err := csvItem(columns, record)
+		if err != nil {
+			return err
+		}
+		items = append(items, i)
+	}
+
+	switch t := v.(type) {
+	case *[]lib.Item:
+		*t = items
+	case *lib.Item:
+		if len(items) != 1 {
+			return fmt.Errorf("csv body must hold exactly one item, got %d", len(items))
+		}
+		*t = items[0]
+	default:
+		return fmt.Errorf("can not decode csv into %T", v)
+	}
+	return nil
+}
+
+func csvItem(columns map[string]int, record []string) (lib.Item, error) {
+	var i lib.Item
+	var err error
+
+	field := func(name string) (string, bool) {
+		idx, found := columns[name]
+		if !found || idx >= len(record) || record[idx] == "" {
+			return "", false
+		}
+		return record[idx], true
+	}
+
+	if v, ok := field("id"); ok {
+		if i.Id, err = uuid.Parse(v); err != nil {
+			return i, err
+		}
+	}
+	i.Name, _ = field("name")
+	i.Name = csvUntext(i.Name)
+	i.Description, _ = field("description")
+	i.Description = csvUntext(i.Description)
+	if v, ok := field("value"); ok {
+		if i.Value, err = strconv.Atoi(v); err != nil {
+			return i, fmt.Errorf("invalid value %q: %w", v, err)
+		}
+	}
+	if v, ok := field("isActive"); ok {
+		if i.Active, err = strconv.ParseBool(v); err != nil {
+			return i, fmt.Errorf("invalid isActive %q: %w", v, err)
+		}
+	}
+	if v, ok := field("createdOn"); ok {
+		if i.CreatedOn, err = time.Parse(time.RFC3339Nano, v); err != nil {
+			return i, err
+		}
+	}
+	if v, ok := field("updatedOn"); ok {
+		if i.UpdatedOn, err = time.Parse(time.RFC3339Nano, v); err != nil {
+			return i, err
+		}
+	}
+
+	return i, nil
+}
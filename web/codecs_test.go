@@ -0,0 +1,91 @@
+package web
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/vivekmv23/go-web-frameworks/lib"
+)
+
+var codecItem = lib.Item{
+	Id:          uuid.MustParse("fe9dd883-7b95-4d7a-80d9-0c80423a8e16"),
+	Name:        "name, with \"quotes\"",
+	Value:       -70000,
+	Description: "a description that is long enough to need more than a fixstr header",
+	Active:      true,
+	CreatedOn:   time.Date(2024, 9, 1, 10, 16, 35, 602000000, time.UTC),
+	UpdatedOn:   time.Date(2024, 9, 2, 10, 16, 35, 602000000, time.UTC),
+}
+
+func TestCodecs_RoundTrip(t *testing.T) {
+	for _, c := range registeredCodecs() {
+		t.Run(c.ContentTypes()[0], func(t *testing.T) {
+			var b bytes.Buffer
+			assert.NoError(t, c.Encode(&b, []lib.Item{codecItem, codecItem}))
+
+			var items []lib.Item
+			assert.NoError(t, c.Decode(&b, &items))
+			assert.Len(t, items, 2)
+			assert.Equal(t, codecItem, items[1])
+
+			b.Reset()
+			assert.NoError(t, c.Encode(&b, codecItem))
+
+			var item lib.Item
+			assert.NoError(t, c.Decode(&b, &item))
+			assert.Equal(t, codecItem, item)
+		})
+	}
+}
+
+func TestNegotiateCodec(t *testing.T) {
+	cases := map[string]string{
+		"":                                 CONTENT_TYPE_JSON,
+		"*/*":                              CONTENT_TYPE_JSON,
+		"text/csv":                         "text/csv",
+		"text/*":                           "text/csv",
+		"application/xml;q=0.9, text/csv":  "text/csv",
+		"text/xml":                         "application/xml",
+		"application/x-msgpack":            "application/msgpack",
+		"application/json;q=0, */*":        "text/csv",
+		"text/csv;q=0.1, application/json": CONTENT_TYPE_JSON,
+	}
+
+	for accept, expected := range cases {
+		c, err := NegotiateCodec(accept, []lib.Item{})
+		if assert.NoError(t, err, accept) {
+			assert.Equal(t, expected, c.ContentTypes()[0], accept)
+		}
+	}
+
+	_, err := NegotiateCodec("text/csv", lib.Error{})
+	assert.IsType(t, &NotAcceptable{}, err, "csv only holds items")
+}
+
+func TestMsgpackCodec_NestingLimit(t *testing.T) {
+	var v any
+	nested := func(depth int) []byte {
+		return append(bytes.Repeat([]byte{0x91}, depth), 0xc0)
+	}
+
+	assert.NoError(t, msgpackCodec{}.Decode(bytes.NewReader(nested(maxMsgpackDepth)), &v))
+	assert.ErrorContains(t, msgpackCodec{}.Decode(bytes.NewReader(nested(maxMsgpackDepth+1)), &v), "nesting")
+	assert.ErrorContains(t, msgpackCodec{}.Decode(bytes.NewReader(nested(1_000_000)), &v), "nesting")
+}
+
+func TestCSVCodec_QuotesFormulas(t *testing.T) {
+	i := codecItem
+	i.Name, i.Description = `=HYPERLINK("http://example.com")`, "-1+2"
+
+	var b bytes.Buffer
+	assert.NoError(t, csvCodec{}.Encode(&b, i))
+	assert.Contains(t, b.String(), `"'=HYPERLINK(""http://example.com"")"`)
+	assert.Contains(t, b.String(), ",'-1+2,")
+
+	var decoded lib.Item
+	assert.NoError(t, csvCodec{}.Decode(&b, &decoded))
+	assert.Equal(t, i, decoded)
+}
@@ -0,0 +1,271 @@
+package web
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/vivekmv23/go-web-frameworks/config"
+)
+
+const (
+	ENCODING_GZIP     = "gzip"
+	ENCODING_DEFLATE  = "deflate"
+	ENCODING_IDENTITY = "identity"
+
+	// decompressed request bodies are capped so a small upload can not expand without bound
+	maxDecompressedBody = 10 << 20
+)
+
+// encoders are in order of preference when a client rates several encodings the same
+var encoders = []string{ENCODING_GZIP, ENCODING_DEFLATE}
+
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// CompressionMiddleware must wrap the complete handler of a server. It compresses responses of at least
+// MinSize bytes with the encoding negotiated from Accept-Encoding and decompresses gzip and deflate request bodies.
+func CompressionMiddleware(c config.CompressionConfig) Middleware {
+	pools := map[string]*sync.Pool{
+		ENCODING_GZIP: {New: func() any {
+			w, _ := gzip.NewWriterLevel(io.Discard, c.Level)
+			return w
+		}},
+		ENCODING_DEFLATE: {New: func() any {
+			w, _ := zlib.NewWriterLevel(io.Discard, c.Level)
+			return w
+		}},
+	}
+
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := decompressRequest(w, r); err != nil {
+				ErrorResponse(http.StatusUnsupportedMediaType, w, r, err)
+				return
+			}
+
+			w.Header().Add("Vary", "Accept-Encoding")
+
+			encoding := NegotiateEncoding(r.Header.Get("Accept-Encoding"))
+			if encoding == "" || r.Method == http.MethodHead {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{ResponseWriter: w, encoding: encoding, pool: pools[encoding], minSize: c.MinSize}
+			defer cw.close()
+
+			h.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// NegotiateEncoding picks the supported encoding with the highest q-value, empty for identity
+func NegotiateEncoding(acceptEncoding string) string {
+	best, bestQ := "", 0.0
+
+	qualities := map[string]float64{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		q := 1.0
+		if v, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		qualities[name] = q
+	}
+
+	for _, e := range encoders {
+		q, found := qualities[e]
+		if !found {
+			q, found = qualities["*"]
+		}
+		if found && q > bestQ {
+			best, bestQ = e, q
+		}
+	}
+
+	return best
+}
+
+func decompressRequest(w http.ResponseWriter, r *http.Request) error {
+	encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+
+	var body io.ReadCloser
+	var err error
+
+	switch encoding {
+	case "", ENCODING_IDENTITY:
+		return nil
+	case ENCODING_GZIP:
+		body, err = gzip.NewReader(r.Body)
+	case ENCODING_DEFLATE:
+		body, err = zlib.NewReader(r.Body)
+	default:
+		return fmt.Errorf("request content encoding %s is not supported, use %s or %s", encoding, ENCODING_GZIP, ENCODING_DEFLATE)
+	}
+
+	if err != nil {
+		// an empty or corrupt body surfaces as a decoding error in the handler
+		body = io.NopCloser(&failingReader{err: err})
+	}
+
+	r.Body = http.MaxBytesReader(w, body, maxDecompressedBody)
+	r.Header.Del("Content-Encoding")
+	r.Header.Del("Content-Length")
+	r.ContentLength = -1
+
+	return nil
+}
+
+type failingReader struct {
+	err error
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	return 0, fmt.Errorf("failed to decompress request body: %w", f.err)
+}
+
+// compressWriter buffers the response until it is known to reach minSize, smaller ones go out as they are
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	pool     *sync.Pool
+	minSize  int
+
+	status      int
+	buf         bytes.Buffer
+	decided     bool
+	compressor  compressor
+	wroteHeader bool
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.status != 0 {
+		return
+	}
+	cw.status = status
+
+	// nothing to compress, or someone else already encoded the body
+	if !bodyAllowed(status) || cw.Header().Get("Content-Encoding") != "" {
+		cw.decide(false)
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+
+	if cw.decided {
+		if cw.compressor != nil {
+			return cw.compressor.Write(b)
+		}
+		return cw.ResponseWriter.Write(b)
+	}
+
+	cw.buf.Write(b)
+	if cw.buf.Len() >= cw.minSize {
+		cw.decide(true)
+	}
+
+	return len(b), nil
+}
+
+// Flush starts compressing right away, streamed responses can not wait for minSize
+func (cw *compressWriter) Flush() {
+	if cw.status == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if !cw.decided {
+		cw.decide(true)
+	}
+	if cw.compressor != nil {
+		cw.compressor.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// Hijack is kept available for protocol upgrades, which bypass compression entirely
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := cw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	cw.decided = true
+	cw.wroteHeader = true
+	return hj.Hijack()
+}
+
+func (cw *compressWriter) decide(compress bool) {
+	cw.decided = true
+
+	if compress {
+		cw.Header().Set("Content-Encoding", cw.encoding)
+		cw.Header().Del("Content-Length")
+		cw.compressor = cw.pool.Get().(compressor)
+		cw.compressor.Reset(cw.ResponseWriter)
+	}
+
+	cw.writeHeader()
+
+	if cw.buf.Len() > 0 {
+		if cw.compressor != nil {
+			cw.compressor.Write(cw.buf.Bytes())
+		} else {
+			cw.ResponseWriter.Write(cw.buf.Bytes())
+		}
+		cw.buf.Reset()
+	}
+}
+
+func (cw *compressWriter) writeHeader() {
+	if cw.wroteHeader || cw.status == 0 {
+		return
+	}
+	cw.wroteHeader = true
+	cw.ResponseWriter.WriteHeader(cw.status)
+}
+
+func (cw *compressWriter) close() {
+	if !cw.decided {
+		if cw.status == 0 {
+			// handler wrote nothing, keep the implicit 200 of net/http
+			return
+		}
+		cw.decide(false)
+	}
+
+	if cw.compressor != nil {
+		cw.compressor.Close()
+		cw.pool.Put(cw.compressor)
+		cw.compressor = nil
+	}
+}
+
+func bodyAllowed(status int) bool {
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
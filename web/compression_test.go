@@ -0,0 +1,47 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vivekmv23/go-web-frameworks/config"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	cases := map[string]string{
+		"":                          "",
+		"gzip":                      ENCODING_GZIP,
+		"deflate":                   ENCODING_DEFLATE,
+		"deflate, gzip":             ENCODING_GZIP,
+		"gzip;q=0.5, deflate":       ENCODING_DEFLATE,
+		"GZIP; q=0.8":               ENCODING_GZIP,
+		"br, identity":              "",
+		"*":                         ENCODING_GZIP,
+		"*;q=0.5, gzip;q=0":         ENCODING_DEFLATE,
+		"gzip;q=0, deflate;q=0, br": "",
+	}
+
+	for header, expected := range cases {
+		assert.Equal(t, expected, NegotiateEncoding(header), header)
+	}
+}
+
+func TestCompressionMiddleware_Flush(t *testing.T) {
+	c := config.Default().Compression
+	h := CompressionMiddleware(c)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{}\n"))
+		w.(http.Flusher).Flush()
+		w.Write([]byte(strings.Repeat("{}\n", 10)))
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/items", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	assert.Equal(t, ENCODING_GZIP, w.Header().Get("Content-Encoding"), "a flushed stream is compressed below min size")
+	assert.True(t, w.Flushed)
+}
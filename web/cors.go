@@ -0,0 +1,119 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vivekmv23/go-web-frameworks/config"
+)
+
+// CORSMiddleware must wrap the complete handler of a server, preflight requests are answered
+// before routing and authentication because browsers send them without credentials
+func CORSMiddleware(c config.CORSConfig) Middleware {
+	allowAll := false
+	for _, o := range c.AllowedOrigins {
+		allowAll = allowAll || o == "*"
+	}
+
+	methods := strings.Join(c.AllowedMethods, ", ")
+	headers := strings.Join(c.AllowedHeaders, ", ")
+	exposed := strings.Join(c.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(time.Duration(c.MaxAge).Seconds()))
+
+	allowedHeaders := map[string]bool{}
+	for _, h := range c.AllowedHeaders {
+		allowedHeaders[http.CanonicalHeaderKey(h)] = true
+	}
+
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && origin != "" && r.Header.Get("Access-Control-Request-Method") != ""
+
+			// the answer depends on the origin unless every origin gets the same one
+			if !allowAll || c.AllowCredentials {
+				w.Header().Add("Vary", "Origin")
+			}
+
+			if origin == "" {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			allowed := isOriginAllowed(c.AllowedOrigins, origin)
+
+			if !preflight {
+				if allowed {
+					setAllowOrigin(w, origin, allowAll, c.AllowCredentials)
+					if exposed != "" {
+						w.Header().Set("Access-Control-Expose-Headers", exposed)
+					}
+				}
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+
+			if !allowed {
+				ErrorResponse(http.StatusForbidden, w, r, fmt.Errorf("origin %s is not allowed", origin))
+				return
+			}
+
+			method := r.Header.Get("Access-Control-Request-Method")
+			if !IsMethodAllowed(c.AllowedMethods, method) {
+				ErrorResponse(http.StatusForbidden, w, r, fmt.Errorf("method %s is not allowed for cross origin requests", method))
+				return
+			}
+
+			for _, requested := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+				requested = http.CanonicalHeaderKey(strings.TrimSpace(requested))
+				if requested != "" && !allowedHeaders[requested] {
+					ErrorResponse(http.StatusForbidden, w, r, fmt.Errorf("header %s is not allowed for cross origin requests", requested))
+					return
+				}
+			}
+
+			setAllowOrigin(w, origin, allowAll, c.AllowCredentials)
+			w.Header().Set("Access-Control-Allow-Methods", methods)
+			if headers != "" {
+				w.Header().Set("Access-Control-Allow-Headers", headers)
+			}
+			w.Header().Set("Access-Control-Max-Age", maxAge)
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+func setAllowOrigin(w http.ResponseWriter, origin string, allowAll bool, credentials bool) {
+	if allowAll && !credentials {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	if credentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func isOriginAllowed(allowed []string, origin string) bool {
+	for _, a := range allowed {
+		if a == "*" || strings.EqualFold(a, origin) {
+			return true
+		}
+		// one wildcard, e.g. https://*.example.com
+		if prefix, suffix, found := strings.Cut(a, "*"); found {
+			if len(origin) >= len(prefix)+len(suffix) &&
+				strings.HasPrefix(strings.ToLower(origin), strings.ToLower(prefix)) &&
+				strings.HasSuffix(strings.ToLower(origin), strings.ToLower(suffix)) {
+				return true
+			}
+		}
+	}
+	return false
+}
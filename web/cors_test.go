@@ -0,0 +1,45 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vivekmv23/go-web-frameworks/config"
+)
+
+func TestIsOriginAllowed(t *testing.T) {
+	allowed := []string{"https://app.example.com", "https://*.internal.example.com"}
+
+	assert.True(t, isOriginAllowed(allowed, "https://app.example.com"))
+	assert.True(t, isOriginAllowed(allowed, "https://APP.example.com"))
+	assert.True(t, isOriginAllowed(allowed, "https://dash.internal.example.com"))
+	assert.False(t, isOriginAllowed(allowed, "https://internal.example.com"))
+	assert.False(t, isOriginAllowed(allowed, "https://evil.com"))
+	assert.True(t, isOriginAllowed([]string{"*"}, "https://evil.com"))
+}
+
+func TestCORSMiddleware_AnyOrigin(t *testing.T) {
+	c := config.Default().CORS
+	c.AllowedOrigins = []string{"*"}
+	h := CORSMiddleware(c)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/items", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, w.Header().Values("Vary"))
+
+	r = httptest.NewRequest(http.MethodOptions, "/items", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+	r.Header.Set("Access-Control-Request-Method", http.MethodPatch)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
@@ -0,0 +1,93 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/vivekmv23/go-web-frameworks/events"
+)
+
+const (
+	CONTENT_TYPE_EVENT_STREAM = "text/event-stream"
+
+	// comments keep idle connections from being closed by proxies
+	eventsHeartbeat = 15 * time.Second
+	// how long clients wait before reconnecting
+	eventsRetry = 3 * time.Second
+)
+
+// ItemEvents streams item changes as Server-Sent Events. Clients that reconnect with Last-Event-ID
+// first get the events they missed, or a reset event when those are no longer logged.
+func (e *ItemsEndpoints) ItemEvents(w http.ResponseWriter, r *http.Request) {
+	bus := e.s.Events()
+	if bus == nil {
+		NotFoundResponse(w, r)
+		return
+	}
+
+	sub := bus.Subscribe(r.Header.Get("Last-Event-ID"))
+	defer sub.Close()
+
+	rc := http.NewResponseController(w)
+	// the stream outlives any write timeout of the server
+	rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", CONTENT_TYPE_EVENT_STREAM)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "retry: %d\n\n", eventsRetry.Milliseconds())
+
+	if sub.Missed {
+		writeEvent(w, events.Event{Type: events.RESET})
+	}
+	for _, ev := range sub.Backlog {
+		writeEvent(w, ev)
+	}
+	rc.Flush()
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case ev, open := <-sub.C:
+			if !open {
+				// too slow to keep up, the client resumes from Last-Event-ID
+				return
+			}
+			if err := writeEvent(w, ev); err != nil {
+				return
+			}
+
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		rc.Flush()
+	}
+}
+
+// writeEvent writes ev with the item as data, a reset has no id so that clients keep their position
+func writeEvent(w io.Writer, ev events.Event) error {
+	data, err := json.Marshal(ev.Item)
+	if err != nil {
+		return err
+	}
+
+	if ev.Id != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", ev.Id); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data)
+	return err
+}
@@ -0,0 +1,118 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/vivekmv23/go-web-frameworks/lib"
+	"github.com/vivekmv23/go-web-frameworks/service"
+)
+
+// PathId extracts the raw item id from a request in whatever way the framework routes it
+type PathId func(r *http.Request) string
+
+// ItemsEndpoints adapts the item service to HTTP, frameworks only route requests to it
+type ItemsEndpoints struct {
+	s      *service.ItemService
+	pathId PathId
+}
+
+func NewItemsEndpoints(s *service.ItemService, pathId PathId) *ItemsEndpoints {
+	return &ItemsEndpoints{s: s, pathId: pathId}
+}
+
+func (e *ItemsEndpoints) GetAllItems(w http.ResponseWriter, r *http.Request) {
+	if codec, err := NegotiateCodec(r.Header.Get("Accept"), []lib.Item{}); err == nil {
+		if _, isStream := codec.(ndjsonCodec); isStream {
+			e.streamAllItems(w, r)
+			return
+		}
+	}
+
+	items, err := e.s.GetAllItems()
+	if err != nil {
+		ErrorResponse(http.StatusInternalServerError, w, r, err)
+	} else {
+		SuccessResponse(http.StatusOK, w, r, items)
+	}
+}
+
+func (e *ItemsEndpoints) streamAllItems(w http.ResponseWriter, r *http.Request) {
+	cur, err := e.s.GetItemCursor(r.Context())
+	if err != nil {
+		ErrorResponse(http.StatusInternalServerError, w, r, err)
+	} else {
+		StreamItems(w, r, cur)
+	}
+}
+
+func (e *ItemsEndpoints) CreateItem(w http.ResponseWriter, r *http.Request) {
+	if err := CheckAcceptable(r); err != nil {
+		ErrorResponse(http.StatusNotAcceptable, w, r, err)
+		return
+	}
+
+	var itemToCreate lib.Item
+
+	if err := DecodeRequest(w, r, &itemToCreate); err != nil {
+		ErrorResponse(http.StatusBadRequest, w, r, err)
+		return
+	}
+
+	createdItem, err := e.s.CreateItem(itemToCreate)
+
+	if err != nil {
+		ErrorResponse(http.StatusInternalServerError, w, r, err)
+	} else {
+		SuccessResponse(http.StatusCreated, w, r, createdItem)
+	}
+}
+
+func (e *ItemsEndpoints) GetItemById(w http.ResponseWriter, r *http.Request) {
+	item, err := e.s.GetItemById(e.pathId(r))
+
+	if err != nil {
+		ErrorResponse(http.StatusInternalServerError, w, r, err)
+	} else {
+		w.Header().Add("Etag", item.UpdatedOn.String())
+		SuccessResponse(http.StatusOK, w, r, item)
+	}
+}
+
+func (e *ItemsEndpoints) UpdateItem(w http.ResponseWriter, r *http.Request) {
+	id := e.pathId(r)
+	ifMatch := r.Header.Get("If-Match")
+
+	if err := e.s.ValidateUpdate(id, ifMatch); err != nil {
+		ErrorResponse(http.StatusBadRequest, w, r, err)
+		return
+	}
+
+	if err := CheckAcceptable(r); err != nil {
+		ErrorResponse(http.StatusNotAcceptable, w, r, err)
+		return
+	}
+
+	var itemToUpdate lib.Item
+
+	if err := DecodeRequest(w, r, &itemToUpdate); err != nil {
+		ErrorResponse(http.StatusBadRequest, w, r, err)
+		return
+	}
+
+	updatedItem, err := e.s.UpdateItem(id, ifMatch, itemToUpdate)
+
+	if err != nil {
+		ErrorResponse(http.StatusInternalServerError, w, r, err)
+	} else {
+		w.Header().Add("Etag", updatedItem.UpdatedOn.String())
+		SuccessResponse(http.StatusOK, w, r, updatedItem)
+	}
+}
+
+func (e *ItemsEndpoints) DeleteItemById(w http.ResponseWriter, r *http.Request) {
+	if err := e.s.DeleteItemById(e.pathId(r)); err != nil {
+		ErrorResponse(http.StatusInternalServerError, w, r, err)
+	} else {
+		SuccessResponse(http.StatusNoContent, w, r, nil)
+	}
+}
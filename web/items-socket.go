@@ -0,0 +1,182 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vivekmv23/go-web-frameworks/events"
+	"github.com/vivekmv23/go-web-frameworks/service"
+)
+
+const (
+	SOCKET_SUBSCRIBE   = "subscribe"
+	SOCKET_UNSUBSCRIBE = "unsubscribe"
+
+	SOCKET_SUBSCRIBED = "subscribed"
+	SOCKET_ERROR      = "error"
+
+	socketPingInterval = 30 * time.Second
+	// a client that answers no ping for this long is gone
+	socketPongWait = 2 * socketPingInterval
+)
+
+// SocketRequest is sent by clients, no ids subscribes to or unsubscribes from every item
+type SocketRequest struct {
+	Action string   `json:"action"`
+	Ids    []string `json:"ids"`
+}
+
+// SocketReply acknowledges a SocketRequest with the resulting subscription, or reports why it failed
+type SocketReply struct {
+	Type  string   `json:"type"`
+	All   bool     `json:"all"`
+	Ids   []string `json:"ids"`
+	Error string   `json:"error,omitempty"`
+}
+
+// ItemSocket upgrades to a WebSocket that sends events.Event messages for the subscribed items.
+// Authentication already ran on the upgrade request like on any other items request.
+func (e *ItemsEndpoints) ItemSocket(w http.ResponseWriter, r *http.Request) {
+	bus := e.s.Events()
+	if bus == nil {
+		NotFoundResponse(w, r)
+		return
+	}
+
+	ws, err := UpgradeWebSocket(w, r)
+	if err != nil {
+		return
+	}
+	ws.ReadTimeout = socketPongWait
+
+	// the subscription is open from the start so that no event slips by while the client subscribes
+	sub := bus.Subscribe("")
+	defer sub.Close()
+
+	filter := &socketFilter{ids: map[uuid.UUID]bool{}}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		readSocketRequests(ws, filter)
+	}()
+
+	ping := time.NewTicker(socketPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+
+		case ev, open := <-sub.C:
+			if !open {
+				// the client reads slower than items change, it has to reconnect and read the items again
+				ws.Close(WS_CLOSE_TRY_AGAIN_LATER, "too slow to keep up with changes")
+				<-done
+				return
+			}
+			if filter.matches(ev) {
+				if err := ws.WriteJSON(ev); err != nil {
+					ws.Close(WS_CLOSE_GOING_AWAY, "")
+					<-done
+					return
+				}
+			}
+
+		case <-ping.C:
+			ws.Ping()
+		}
+	}
+}
+
+func readSocketRequests(ws *WebSocket, filter *socketFilter) {
+	for {
+		op, data, err := ws.ReadMessage()
+		if err != nil {
+			ws.Close(WS_CLOSE_NORMAL, "")
+			return
+		}
+
+		if op != WS_OP_TEXT {
+			ws.Close(WS_CLOSE_UNSUPPORTED, "only JSON text messages are understood")
+			return
+		}
+
+		var req SocketRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			ws.WriteJSON(SocketReply{Type: SOCKET_ERROR, Error: err.Error()})
+			continue
+		}
+
+		if err := filter.apply(req); err != nil {
+			ws.WriteJSON(SocketReply{Type: SOCKET_ERROR, Error: err.Error()})
+			continue
+		}
+
+		ws.WriteJSON(filter.reply())
+	}
+}
+
+type socketFilter struct {
+	mu  sync.Mutex
+	all bool
+	ids map[uuid.UUID]bool
+}
+
+func (f *socketFilter) apply(req SocketRequest) error {
+	var ids []uuid.UUID
+	for _, raw := range req.Ids {
+		id, err := service.ParseId(raw)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, id)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case req.Action == SOCKET_SUBSCRIBE && len(ids) == 0:
+		f.all = true
+	case req.Action == SOCKET_SUBSCRIBE:
+		for _, id := range ids {
+			f.ids[id] = true
+		}
+	case req.Action == SOCKET_UNSUBSCRIBE && len(ids) == 0:
+		f.all = false
+		clear(f.ids)
+	case req.Action == SOCKET_UNSUBSCRIBE:
+		for _, id := range ids {
+			delete(f.ids, id)
+		}
+	default:
+		return fmt.Errorf("unknown action %q, expected %s or %s", req.Action, SOCKET_SUBSCRIBE, SOCKET_UNSUBSCRIBE)
+	}
+
+	return nil
+}
+
+// matches lets resets through to every subscriber, they invalidate whatever the client holds
+func (f *socketFilter) matches(ev events.Event) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return ev.Type == events.RESET || f.all || f.ids[ev.Item.Id]
+}
+
+func (f *socketFilter) reply() SocketReply {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	r := SocketReply{Type: SOCKET_SUBSCRIBED, All: f.all, Ids: []string{}}
+	for id := range f.ids {
+		r.Ids = append(r.Ids, id.String())
+	}
+	return r
+}
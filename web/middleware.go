@@ -0,0 +1,45 @@
+package web
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// Middleware has the same shape as mux.MiddlewareFunc so it plugs into gorilla's Use as well
+type Middleware func(http.Handler) http.Handler
+
+// Chain wraps h so that the first middleware sees the request first
+func Chain(h http.Handler, middlewares ...Middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+func AuthenticationMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Check if user is authenticated
+		if !IsAuthorized(r) {
+			ErrorResponse(http.StatusUnauthorized, w, r, fmt.Errorf("unauthorized, remove header 'unauthorized'"))
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func LogRequestMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("REQUEST: UserAgent: %s, Host: %s, Method: %s, URI: %s, Cookies: %q", r.UserAgent(), r.Host, r.Method, r.RequestURI, r.Cookies())
+		h.ServeHTTP(w, r)
+	})
+}
+
+func LogResponseMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func(w http.ResponseWriter) {
+			log.Printf("RESPONSE: Content-Type: %s", w.Header().Get("Content-Type"))
+		}(w)
+		h.ServeHTTP(w, r)
+	})
+}
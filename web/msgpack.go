@@ -0,0 +1,319 @@
+package web
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// msgpackCodec carries the same document as the JSON codec: values go through their JSON form,
+// so field names, timestamps and ids read the same in both encodings
+type msgpackCodec struct{}
+
+func (msgpackCodec) ContentTypes() []string {
+	return []string{"application/msgpack", "application/vnd.msgpack", "application/x-msgpack"}
+}
+
+func (msgpackCodec) Supports(v any) bool {
+	return true
+}
+
+func (msgpackCodec) Encode(w io.Writer, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+
+	var generic any
+	if err := d.Decode(&generic); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := writeMsgpack(&buf, generic); err != nil {
+		return err
+	}
+
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+func (msgpackCodec) Decode(r io.Reader, v any) error {
+	generic, err := readMsgpack(&msgpackReader{r: r})
+	if err != nil {
+		return fmt.Errorf("invalid msgpack: %w", err)
+	}
+
+	data, err := json.Marshal(generic)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+func writeMsgpack(b *bytes.Buffer, v any) error {
+	switch t := v.(type) {
+	case nil:
+		b.WriteByte(0xc0)
+	case bool:
+		if t {
+			b.WriteByte(0xc3)
+		} else {
+			b.WriteByte(0xc2)
+		}
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			writeMsgpackInt(b, i)
+			return nil
+		}
+		f, err := t.Float64()
+		if err != nil {
+			return err
+		}
+		b.WriteByte(0xcb)
+		binary.Write(b, binary.BigEndian, f)
+	case string:
+		writeMsgpackLength(b, len(t), 0xa0, 32, 0xd9, 0xda, 0xdb)
+		b.WriteString(t)
+	case []any:
+		writeMsgpackLength(b, len(t), 0x90, 16, 0, 0xdc, 0xdd)
+		for _, e := range t {
+			if err := writeMsgpack(b, e); err != nil {
+				return err
+			}
+		}
+	case map[string]any:
+		writeMsgpackLength(b, len(t), 0x80, 16, 0, 0xde, 0xdf)
+		// sorted keys keep the encoding deterministic
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			writeMsgpack(b, k)
+			if err := writeMsgpack(b, t[k]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("can not encode %T as msgpack", v)
+	}
+	return nil
+}
+
+func writeMsgpackInt(b *bytes.Buffer, i int64) {
+	switch {
+	case i >= 0 && i <= math.MaxInt8:
+		b.WriteByte(byte(i))
+	case i < 0 && i >= -32:
+		b.WriteByte(byte(int8(i)))
+	case i >= math.MinInt8 && i <= math.MaxInt8:
+		b.WriteByte(0xd0)
+		b.WriteByte(byte(int8(i)))
+	case i >= math.MinInt16 && i <= math.MaxInt16:
+		b.WriteByte(0xd1)
+		binary.Write(b, binary.BigEndian, int16(i))
+	case i >= math.MinInt32 && i <= math.MaxInt32:
+		b.WriteByte(0xd2)
+		binary.Write(b, binary.BigEndian, int32(i))
+	default:
+		b.WriteByte(0xd3)
+		binary.Write(b, binary.BigEndian, i)
+	}
+}
+
+// writeMsgpackLength writes the header of a str, array or map, fix is the fixed format prefix
+// used below fixMax, the 8 bit form is skipped when its prefix is 0
+func writeMsgpackLength(b *bytes.Buffer, n int, fix byte, fixMax int, p8, p16, p32 byte) {
+	switch {
+	case n < fixMax:
+		b.WriteByte(fix | byte(n))
+	case p8 != 0 && n <= math.MaxUint8:
+		b.WriteByte(p8)
+		b.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		b.WriteByte(p16)
+		binary.Write(b, binary.BigEndian, uint16(n))
+	default:
+		b.WriteByte(p32)
+		binary.Write(b, binary.BigEndian, uint32(n))
+	}
+}
+
+const (
+	// strings and binaries longer than this are rejected before anything is allocated for them
+	maxMsgpackLength = 16 << 20
+	// arrays and maps nested deeper than this are rejected, every level is a recursive call
+	maxMsgpackDepth = 32
+)
+
+type msgpackReader struct {
+	r     io.Reader
+	buf   [8]byte
+	depth int
+}
+
+// enter counts a level of nesting, leave must follow it
+func (m *msgpackReader) enter() error {
+	m.depth++
+	if m.depth > maxMsgpackDepth {
+		return fmt.Errorf("nesting exceeds %d levels", maxMsgpackDepth)
+	}
+	return nil
+}
+
+func (m *msgpackReader) leave() {
+	m.depth--
+}
+
+func (m *msgpackReader) next(n int) ([]byte, error) {
+	if n > maxMsgpackLength {
+		return nil, fmt.Errorf("length %d exceeds %d bytes", n, maxMsgpackLength)
+	}
+
+	var b []byte
+	if n <= len(m.buf) {
+		b = m.buf[:n]
+	} else {
+		b = make([]byte, n)
+	}
+	_, err := io.ReadFull(m.r, b)
+	return b, err
+}
+
+func (m *msgpackReader) uint(n int) (uint64, error) {
+	b, err := m.next(n)
+	if err != nil {
+		return 0, err
+	}
+	var u uint64
+	for _, c := range b {
+		u = u<<8 | uint64(c)
+	}
+	return u, nil
+}
+
+func readMsgpack(m *msgpackReader) (any, error) {
+	p, err := m.next(1)
+	if err != nil {
+		return nil, err
+	}
+	c := p[0]
+
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xe0 == 0xa0:
+		return readMsgpackString(m, int(c&0x1f))
+	case c&0xf0 == 0x90:
+		return readMsgpackArray(m, int(c&0x0f))
+	case c&0xf0 == 0x80:
+		return readMsgpackMap(m, int(c&0x0f))
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		u, err := m.uint(1 << (c - 0xcc))
+		return u, err
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (c - 0xd0)
+		u, err := m.uint(size)
+		shift := 64 - 8*size
+		return int64(u<<shift) >> shift, err
+	case 0xca:
+		u, err := m.uint(4)
+		return float64(math.Float32frombits(uint32(u))), err
+	case 0xcb:
+		u, err := m.uint(8)
+		return math.Float64frombits(u), err
+	case 0xd9, 0xda, 0xdb:
+		n, err := m.uint(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackString(m, int(n))
+	case 0xc4, 0xc5, 0xc6:
+		// bin is read as a string, items carry no binary fields
+		n, err := m.uint(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackString(m, int(n))
+	case 0xdc, 0xdd:
+		n, err := m.uint(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackArray(m, int(n))
+	case 0xde, 0xdf:
+		n, err := m.uint(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackMap(m, int(n))
+	}
+
+	return nil, fmt.Errorf("unsupported msgpack type 0x%x", c)
+}
+
+func readMsgpackString(m *msgpackReader, n int) (any, error) {
+	b, err := m.next(n)
+	return string(b), err
+}
+
+func readMsgpackArray(m *msgpackReader, n int) (any, error) {
+	defer m.leave()
+	if err := m.enter(); err != nil {
+		return nil, err
+	}
+
+	a := make([]any, 0, min(n, 1024))
+	for i := 0; i < n; i++ {
+		e, err := readMsgpack(m)
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, e)
+	}
+	return a, nil
+}
+
+func readMsgpackMap(m *msgpackReader, n int) (any, error) {
+	defer m.leave()
+	if err := m.enter(); err != nil {
+		return nil, err
+	}
+
+	o := make(map[string]any, min(n, 1024))
+	for i := 0; i < n; i++ {
+		k, err := readMsgpack(m)
+		if err != nil {
+			return nil, err
+		}
+		key, isString := k.(string)
+		if !isString {
+			return nil, fmt.Errorf("map keys must be strings, got %T", k)
+		}
+		if o[key], err = readMsgpack(m); err != nil {
+			return nil, err
+		}
+	}
+	return o, nil
+}
@@ -0,0 +1,89 @@
+package web
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/vivekmv23/go-web-frameworks/database"
+	"github.com/vivekmv23/go-web-frameworks/lib"
+)
+
+const CONTENT_TYPE_NDJSON = "application/x-ndjson"
+
+// ndjsonCodec writes one JSON item per line, list responses bypass it and stream from a cursor
+type ndjsonCodec struct{}
+
+func (ndjsonCodec) ContentTypes() []string {
+	return []string{CONTENT_TYPE_NDJSON, "application/jsonl", "application/x-jsonlines"}
+}
+
+func (ndjsonCodec) Supports(v any) bool {
+	switch v.(type) {
+	case lib.Item, *lib.Item, []lib.Item:
+		return true
+	}
+	return false
+}
+
+func (ndjsonCodec) Encode(w io.Writer, v any) error {
+	e := json.NewEncoder(w)
+	if items, isList := v.([]lib.Item); isList {
+		for _, i := range items {
+			if err := e.Encode(i); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return e.Encode(v)
+}
+
+func (ndjsonCodec) Decode(r io.Reader, v any) error {
+	items, isList := v.(*[]lib.Item)
+	if !isList {
+		return json.NewDecoder(r).Decode(v)
+	}
+
+	*items = []lib.Item{}
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), maxDecompressedBody)
+	for s.Scan() {
+		if len(s.Bytes()) == 0 {
+			continue
+		}
+		var i lib.Item
+		if err := json.Unmarshal(s.Bytes(), &i); err != nil {
+			return err
+		}
+		*items = append(*items, i)
+	}
+	return s.Err()
+}
+
+// StreamItems writes every item of the cursor as a line and flushes after each one, so memory stays
+// constant whatever the size of the collection. Once the first line is out the status can no longer
+// change, a failing cursor then aborts the response so that clients see a truncated stream.
+func StreamItems(w http.ResponseWriter, r *http.Request, cur database.ItemCursor) {
+	defer cur.Close(r.Context())
+
+	w.Header().Add("Content-Type", CONTENT_TYPE_NDJSON)
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	e := json.NewEncoder(w)
+	for cur.Next(r.Context()) {
+		if err := e.Encode(cur.Item()); err != nil {
+			log.Printf("ERROR: failed to stream items: %s", err)
+			return
+		}
+		rc.Flush()
+	}
+
+	if err := cur.Err(); err != nil && r.Context().Err() == nil {
+		log.Printf("ERROR: items stream ended early: %s", err)
+		panic(http.ErrAbortHandler)
+	}
+}
@@ -0,0 +1,70 @@
+package web
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/vivekmv23/go-web-frameworks/config"
+	"github.com/vivekmv23/go-web-frameworks/ratelimit"
+)
+
+// KeyFunc picks the bucket a request counts against
+type KeyFunc func(r *http.Request) string
+
+// RateLimitKey keys by principal when the caller is identified and falls back to the client ip
+func RateLimitKey(keyBy string) KeyFunc {
+	return func(r *http.Request) string {
+		if keyBy == config.RATE_LIMIT_BY_PRINCIPAL {
+			if p := Principal(r); p != "" {
+				return p
+			}
+		}
+		return "ip:" + ClientIP(r)
+	}
+}
+
+func NewRateLimitMiddleware(c config.RateLimitConfig) Middleware {
+	return RateLimitMiddleware(
+		ratelimit.NewTokenBucketLimiter(c.Read.Rate, c.Read.Burst),
+		ratelimit.NewTokenBucketLimiter(c.Write.Rate, c.Write.Burst),
+		RateLimitKey(c.KeyBy),
+	)
+}
+
+// RateLimitMiddleware answers 429 once the bucket of the request is empty, reads and writes have separate quotas
+func RateLimitMiddleware(reads, writes ratelimit.Limiter, key KeyFunc) Middleware {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limiter := writes
+			if isRead(r.Method) {
+				limiter = reads
+			}
+
+			d := limiter.Allow(key(r))
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(d.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(d.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(seconds(d.Reset)))
+
+			if !d.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(max(1, seconds(d.RetryAfter))))
+				ErrorResponse(http.StatusTooManyRequests, w, r, fmt.Errorf("rate limit exceeded, retry in %s", d.RetryAfter.Round(time.Millisecond)))
+				return
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+func isRead(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// seconds rounds up, so clients never come back before the quota allows it
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,127 @@
+package web
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/vivekmv23/go-web-frameworks/fixtures"
+)
+
+const redacted = "REDACTED"
+
+// credentials are never written to a recording, besides the header of the configured auth mode
+var credentials = []string{"Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+
+// RecordMiddleware writes every request with its response to rec. It must run after compression so
+// that plain bodies are recorded, which is why Accept-Encoding is left out of the recorded requests.
+// Event streams and upgraded connections are not recorded.
+func RecordMiddleware(rec *fixtures.Recorder) Middleware {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			e := fixtures.Exchange{
+				Time:    time.Now().UTC(),
+				Request: fixtures.Request{Method: r.Method, Target: r.RequestURI, Header: recordedHeader(r.Header)},
+			}
+			e.Request.Header.Del("Accept-Encoding")
+			e.Request.Header.Del("Content-Length")
+
+			// the handler still reads the complete body, also when it is too long to be recorded
+			body, _ := io.ReadAll(io.LimitReader(r.Body, fixtures.MAX_BODY+1))
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+			e.Request.Body = fixtures.NewBody(body)
+
+			rw := &recordWriter{ResponseWriter: w}
+			h.ServeHTTP(rw, r)
+
+			if rw.skip {
+				return
+			}
+			if rw.status == 0 {
+				rw.snapshot(http.StatusOK)
+			}
+
+			e.Response = fixtures.Response{Status: rw.status, Header: rw.header, Body: fixtures.NewBody(rw.body.Bytes())}
+			if err := rec.Record(e); err != nil {
+				log.Printf("ERROR: failed to record %s %s: %s", r.Method, r.RequestURI, err)
+			}
+		})
+	}
+}
+
+func recordedHeader(h http.Header) http.Header {
+	recorded := h.Clone()
+	for _, name := range append(credentials, authConfig.Load().Header) {
+		if recorded.Get(name) != "" {
+			recorded.Set(name, redacted)
+		}
+	}
+	return recorded
+}
+
+// recordWriter keeps a copy of the response, the headers as they were when the status was written
+type recordWriter struct {
+	http.ResponseWriter
+
+	status int
+	header http.Header
+	body   bytes.Buffer
+	skip   bool
+}
+
+func (rw *recordWriter) snapshot(status int) {
+	rw.status = status
+	rw.header = recordedHeader(rw.Header())
+	rw.skip = rw.skip || strings.HasPrefix(rw.header.Get("Content-Type"), CONTENT_TYPE_EVENT_STREAM)
+}
+
+func (rw *recordWriter) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.snapshot(status)
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *recordWriter) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.WriteHeader(http.StatusOK)
+	}
+
+	// one byte more than is kept, so that the body is marked truncated
+	if !rw.skip && rw.body.Len() <= fixtures.MAX_BODY {
+		rw.body.Write(b[:min(len(b), fixtures.MAX_BODY+1-rw.body.Len())])
+	}
+	return rw.ResponseWriter.Write(b)
+}
+
+func (rw *recordWriter) Flush() {
+	if rw.status == 0 {
+		rw.WriteHeader(http.StatusOK)
+	}
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (rw *recordWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// Hijack hands the connection over for protocol upgrades, which are not recorded
+func (rw *recordWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	rw.skip = true
+	return hj.Hijack()
+}
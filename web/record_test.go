@@ -0,0 +1,64 @@
+package web
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vivekmv23/go-web-frameworks/config"
+	"github.com/vivekmv23/go-web-frameworks/fixtures"
+)
+
+func TestRecordMiddleware(t *testing.T) {
+	var out bytes.Buffer
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusCreated)
+		w.Write(bytes.ToUpper(body))
+		w.Header().Set("Late", "not sent")
+	}), CompressionMiddleware(config.Default().Compression), RecordMiddleware(fixtures.NewRecorder(&out)))
+
+	r := httptest.NewRequest(http.MethodPost, "/items?x=1", strings.NewReader("hello"))
+	r.Header.Set("X-API-Key", "secret")
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	require.Equal(t, "HELLO", w.Body.String(), "the handler still reads the body")
+
+	exchanges, err := fixtures.Read(&out)
+	require.NoError(t, err)
+	require.Len(t, exchanges, 1)
+	e := exchanges[0]
+
+	assert.Equal(t, "/items?x=1", e.Request.Target)
+	assert.Equal(t, "hello", e.Request.Body.Text)
+	assert.Equal(t, redacted, e.Request.Header.Get("X-API-Key"))
+	assert.Empty(t, e.Request.Header.Get("Accept-Encoding"))
+
+	assert.Equal(t, http.StatusCreated, e.Response.Status)
+	assert.Equal(t, "HELLO", e.Response.Body.Text)
+	assert.Equal(t, "Accept-Encoding", e.Response.Header.Get("Vary"))
+	assert.Empty(t, e.Response.Header.Get("Late"), "headers are recorded as they were sent")
+}
+
+func TestRecordMiddleware_SkipsEventStreams(t *testing.T) {
+	var out bytes.Buffer
+	h := RecordMiddleware(fixtures.NewRecorder(&out))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", CONTENT_TYPE_EVENT_STREAM)
+		w.Write([]byte("data: {}\n\n"))
+		w.(http.Flusher).Flush()
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/items/events", nil))
+
+	assert.True(t, w.Flushed)
+	assert.Empty(t, out.String())
+}
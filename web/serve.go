@@ -0,0 +1,103 @@
+package web
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/vivekmv23/go-web-frameworks/config"
+)
+
+var authConfig atomic.Pointer[config.AuthConfig]
+
+func init() {
+	ConfigureAuth(config.Default().Auth)
+}
+
+// ConfigureAuth switches the check done by IsAuthorized for every server in the process
+func ConfigureAuth(c config.AuthConfig) {
+	authConfig.Store(&c)
+}
+
+// Serve runs h until the process receives SIGINT or SIGTERM, then shuts down gracefully
+func Serve(framework string, h http.Handler, c config.ServerConfig) {
+	s := &http.Server{
+		Addr:         c.Addr,
+		Handler:      h,
+		ReadTimeout:  time.Duration(c.ReadTimeout),
+		WriteTimeout: time.Duration(c.WriteTimeout),
+		IdleTimeout:  time.Duration(c.IdleTimeout),
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(c.ShutdownTimeout))
+		defer cancel()
+		if err := s.Shutdown(shutdownCtx); err != nil {
+			log.Printf("ERROR: failed to shutdown server gracefully: %s", err)
+		}
+	}()
+
+	log.Printf("Starting Server %s, Using %s...\n", c.Addr, framework)
+
+	var err error
+	if c.TLS.Enabled {
+		err = s.ListenAndServeTLS(c.TLS.CertFile, c.TLS.KeyFile)
+	} else {
+		err = s.ListenAndServe()
+	}
+
+	if err != nil && err != http.ErrServerClosed {
+		log.Fatalf("Failed to start server on %s: %s", c.Addr, err)
+	}
+}
+
+// Principal identifies the authenticated caller, empty when the auth mode does not identify callers
+func Principal(r *http.Request) string {
+	c := authConfig.Load()
+	if c.Mode != config.AUTH_APIKEY {
+		return ""
+	}
+
+	key := r.Header.Get(c.Header)
+	if !isValidApiKey(c, key) {
+		return ""
+	}
+
+	// never keep the key itself around in limiter state or logs
+	sum := sha256.Sum256([]byte(key))
+	return "apikey:" + hex.EncodeToString(sum[:8])
+}
+
+// ClientIP is the address of the directly connected client
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func isValidApiKey(c *config.AuthConfig, key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, k := range c.APIKeys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			return true
+		}
+	}
+	return false
+}
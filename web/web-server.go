@@ -1,31 +1,51 @@
 package web
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 
+	"github.com/vivekmv23/go-web-frameworks/config"
 	"github.com/vivekmv23/go-web-frameworks/database"
 	"github.com/vivekmv23/go-web-frameworks/lib"
+	"github.com/vivekmv23/go-web-frameworks/service"
+	"github.com/vivekmv23/go-web-frameworks/webhooks"
 )
 
 type WebServer interface {
-	Start(port int)
+	Handler() http.Handler
+	Start(c config.ServerConfig)
 }
 
+// SuccessResponse encodes response in the media type negotiated from the Accept header of r
 func SuccessResponse(statusCode int, w http.ResponseWriter, r *http.Request, response any) {
 
-	w.Header().Add("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
+	if response == nil {
+		w.Header().Add("Content-Type", CONTENT_TYPE_JSON)
+		w.WriteHeader(statusCode)
+		return
+	}
 
-	if response != nil {
-		resJson, err := json.Marshal(response)
-		if err != nil {
-			ErrorResponse(http.StatusInternalServerError, w, r, err)
-			return
-		}
-		w.Write(resJson)
+	codec, err := NegotiateCodec(r.Header.Get("Accept"), response)
+	if err != nil {
+		ErrorResponse(http.StatusNotAcceptable, w, r, err)
+		return
 	}
+
+	var body bytes.Buffer
+	if err := codec.Encode(&body, response); err != nil {
+		ErrorResponse(http.StatusInternalServerError, w, r, err)
+		return
+	}
+
+	w.Header().Add("Content-Type", codec.ContentTypes()[0])
+	w.WriteHeader(statusCode)
+	w.Write(body.Bytes())
 }
 
 func ErrorResponse(statusCode int, w http.ResponseWriter, r *http.Request, err error) {
@@ -37,6 +57,10 @@ func ErrorResponse(statusCode int, w http.ResponseWriter, r *http.Request, err e
 
 	statusCode = mapErrorToHttpStatus(err, statusCode)
 
+	if u, isUnavailable := err.(*database.Unavailable); isUnavailable && u.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(max(1, seconds(u.RetryAfter))))
+	}
+
 	ejson, err := json.Marshal(e)
 
 	if err != nil {
@@ -58,16 +82,113 @@ func mapErrorToHttpStatus(err error, statusCode int) int {
 		return http.StatusNotFound
 	}
 
+	_, isUnavailable := err.(*database.Unavailable)
+	if isUnavailable {
+		return http.StatusServiceUnavailable
+	}
+
 	_, isOutDated := err.(*database.Outdated)
 	if isOutDated {
 		return http.StatusPreconditionFailed
 	}
 
+	_, isNotAcceptable := err.(*NotAcceptable)
+	if isNotAcceptable {
+		return http.StatusNotAcceptable
+	}
+
+	_, isUnsupportedMediaType := err.(*UnsupportedMediaType)
+	if isUnsupportedMediaType {
+		return http.StatusUnsupportedMediaType
+	}
+
+	_, isInvalidInput := err.(*service.InvalidInput)
+	if isInvalidInput {
+		return http.StatusBadRequest
+	}
+
+	_, isWebhookNotFound := err.(*webhooks.NotFound)
+	if isWebhookNotFound {
+		return http.StatusNotFound
+	}
+
+	_, isInvalidSubscription := err.(*webhooks.InvalidSubscription)
+	if isInvalidSubscription {
+		return http.StatusBadRequest
+	}
+
+	_, isPreconditionRequired := err.(*service.PreconditionRequired)
+	if isPreconditionRequired {
+		return http.StatusPreconditionRequired
+	}
+
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+
 	return statusCode
 }
 
 func IsAuthorized(r *http.Request) bool {
-	isAuth := r.Header.Get("unauthorized") == ""
-	log.Printf("Stubbed auth check for host: %s authorized: %v", r.Host, isAuth)
-	return isAuth
+	c := authConfig.Load()
+
+	switch c.Mode {
+	case config.AUTH_NONE:
+		return true
+	case config.AUTH_APIKEY:
+		isAuth := isValidApiKey(c, r.Header.Get(c.Header))
+		log.Printf("Api key auth check for host: %s authorized: %v", r.Host, isAuth)
+		return isAuth
+	default:
+		isAuth := r.Header.Get("unauthorized") == ""
+		log.Printf("Stubbed auth check for host: %s authorized: %v", r.Host, isAuth)
+		return isAuth
+	}
+}
+
+func NotFoundResponse(w http.ResponseWriter, r *http.Request) {
+	ErrorResponse(http.StatusNotFound, w, r, fmt.Errorf("no resource found at %s", r.URL.Path))
+}
+
+func MethodNotAllowedResponse(allowed []string, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	ErrorResponse(http.StatusMethodNotAllowed, w, r, fmt.Errorf("method %s not allowed on url %s", r.Method, r.URL.Path))
+}
+
+// ServeMuxNoRoute answers requests that reached a fallback pattern of mux with 405 when another method
+// is routed on the path, with 404 otherwise
+func ServeMuxNoRoute(mux *http.ServeMux, fallbackPatterns ...string) http.Handler {
+	methods := []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+	fallback := map[string]bool{}
+	for _, p := range fallbackPatterns {
+		fallback[p] = true
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var allowed []string
+		for _, m := range methods {
+			candidate := r.Clone(r.Context())
+			candidate.Method = m
+			if _, pattern := mux.Handler(candidate); !fallback[pattern] {
+				allowed = append(allowed, m)
+			}
+		}
+
+		if len(allowed) == 0 {
+			NotFoundResponse(w, r)
+			return
+		}
+		MethodNotAllowedResponse(allowed, w, r)
+	})
+}
+
+func IsMethodAllowed(allowed []string, method string) bool {
+	for _, m := range allowed {
+		if m == method {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,131 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/vivekmv23/go-web-frameworks/service"
+	"github.com/vivekmv23/go-web-frameworks/webhooks"
+)
+
+var webhooksFallbackPatterns = []string{"/webhooks", "/webhooks/"}
+
+// WebhooksEndpoints manage webhook subscriptions. They are not part of the framework comparison,
+// so every framework shares the same ServeMux routes mounted in front of it by MountWebhooks.
+type WebhooksEndpoints struct {
+	d *webhooks.Dispatcher
+}
+
+// MountWebhooks routes /webhooks to the webhook endpoints behind authentication and everything else to next
+func MountWebhooks(next http.Handler, d *webhooks.Dispatcher) http.Handler {
+	e := &WebhooksEndpoints{d: d}
+	mux := http.NewServeMux()
+
+	handle := func(pattern string, h http.HandlerFunc) {
+		mux.Handle(pattern, Chain(h, LogRequestMiddleware, AuthenticationMiddleware, LogResponseMiddleware))
+	}
+
+	handle("POST /webhooks", e.Register)
+	handle("GET /webhooks", e.List)
+	handle("GET /webhooks/{id}", e.Get)
+	handle("DELETE /webhooks/{id}", e.Unregister)
+	handle("GET /webhooks/{id}/deliveries", e.Deliveries)
+	handle("POST /webhooks/{id}/deliveries/{delivery}/redeliver", e.Redeliver)
+
+	for _, pattern := range webhooksFallbackPatterns {
+		mux.Handle(pattern, ServeMuxNoRoute(mux, webhooksFallbackPatterns...))
+	}
+	mux.Handle("/", next)
+
+	return mux
+}
+
+// Register answers with the secret of the new subscription, the only time it is shown
+func (e *WebhooksEndpoints) Register(w http.ResponseWriter, r *http.Request) {
+	var s webhooks.Subscription
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		ErrorResponse(http.StatusBadRequest, w, r, err)
+		return
+	}
+
+	created, err := e.d.Register(s)
+	if err != nil {
+		ErrorResponse(http.StatusInternalServerError, w, r, err)
+	} else {
+		SuccessResponse(http.StatusCreated, w, r, created)
+	}
+}
+
+func (e *WebhooksEndpoints) List(w http.ResponseWriter, r *http.Request) {
+	subscriptions, err := e.d.Subscriptions()
+	if err != nil {
+		ErrorResponse(http.StatusInternalServerError, w, r, err)
+	} else {
+		SuccessResponse(http.StatusOK, w, r, subscriptions)
+	}
+}
+
+func (e *WebhooksEndpoints) Get(w http.ResponseWriter, r *http.Request) {
+	id, err := service.ParseId(r.PathValue("id"))
+	if err != nil {
+		ErrorResponse(http.StatusBadRequest, w, r, err)
+		return
+	}
+
+	s, err := e.d.Subscription(id)
+	if err != nil {
+		ErrorResponse(http.StatusInternalServerError, w, r, err)
+	} else {
+		SuccessResponse(http.StatusOK, w, r, s)
+	}
+}
+
+func (e *WebhooksEndpoints) Unregister(w http.ResponseWriter, r *http.Request) {
+	id, err := service.ParseId(r.PathValue("id"))
+	if err != nil {
+		ErrorResponse(http.StatusBadRequest, w, r, err)
+		return
+	}
+
+	if err := e.d.Unregister(id); err != nil {
+		ErrorResponse(http.StatusInternalServerError, w, r, err)
+	} else {
+		SuccessResponse(http.StatusNoContent, w, r, nil)
+	}
+}
+
+func (e *WebhooksEndpoints) Deliveries(w http.ResponseWriter, r *http.Request) {
+	id, err := service.ParseId(r.PathValue("id"))
+	if err != nil {
+		ErrorResponse(http.StatusBadRequest, w, r, err)
+		return
+	}
+
+	deliveries, err := e.d.Deliveries(id)
+	if err != nil {
+		ErrorResponse(http.StatusInternalServerError, w, r, err)
+	} else {
+		SuccessResponse(http.StatusOK, w, r, deliveries)
+	}
+}
+
+func (e *WebhooksEndpoints) Redeliver(w http.ResponseWriter, r *http.Request) {
+	id, err := service.ParseId(r.PathValue("id"))
+	if err != nil {
+		ErrorResponse(http.StatusBadRequest, w, r, err)
+		return
+	}
+
+	deliveryId, err := service.ParseId(r.PathValue("delivery"))
+	if err != nil {
+		ErrorResponse(http.StatusBadRequest, w, r, err)
+		return
+	}
+
+	d, err := e.d.Redeliver(id, deliveryId)
+	if err != nil {
+		ErrorResponse(http.StatusInternalServerError, w, r, err)
+	} else {
+		SuccessResponse(http.StatusAccepted, w, r, d)
+	}
+}
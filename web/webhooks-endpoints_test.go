@@ -0,0 +1,53 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vivekmv23/go-web-frameworks/config"
+	"github.com/vivekmv23/go-web-frameworks/webhooks"
+)
+
+func TestMountWebhooks(t *testing.T) {
+	d := webhooks.NewDispatcher(webhooks.NewMemoryStore(), config.WebhooksConfig{MaxAttempts: 1, Backoff: config.Duration(time.Second), Timeout: config.Duration(time.Second)})
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTeapot) })
+	h := MountWebhooks(next, d)
+
+	serve := func(method, target, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return w
+	}
+
+	w := serve(http.MethodPost, "/webhooks", `{"url": "https://example.com/hook", "events": ["item.deleted"]}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	var created webhooks.Subscription
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.NotEmpty(t, created.Secret)
+
+	w = serve(http.MethodGet, "/webhooks/"+created.Id.String(), "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), created.Secret)
+
+	w = serve(http.MethodGet, "/webhooks/"+created.Id.String()+"/deliveries", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, "[]", w.Body.String())
+
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPost, "/webhooks", `{"url": "ftp://example.com"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodGet, "/webhooks/not-a-uuid", "").Code)
+	assert.Equal(t, http.StatusNoContent, serve(http.MethodDelete, "/webhooks/"+created.Id.String(), "").Code)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/webhooks/"+created.Id.String(), "").Code)
+
+	w = serve(http.MethodPatch, "/webhooks", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "GET, POST", w.Header().Get("Allow"))
+
+	assert.Equal(t, http.StatusTeapot, serve(http.MethodGet, "/items", "").Code, "other paths reach the framework")
+}
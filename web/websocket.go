@@ -0,0 +1,418 @@
+package web
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// WebSocket opcodes and close codes of RFC 6455
+const (
+	WS_OP_CONTINUATION = 0x0
+	WS_OP_TEXT         = 0x1
+	WS_OP_BINARY       = 0x2
+	WS_OP_CLOSE        = 0x8
+	WS_OP_PING         = 0x9
+	WS_OP_PONG         = 0xA
+
+	WS_CLOSE_NORMAL          = 1000
+	WS_CLOSE_GOING_AWAY      = 1001
+	WS_CLOSE_PROTOCOL_ERROR  = 1002
+	WS_CLOSE_UNSUPPORTED     = 1003
+	WS_CLOSE_NO_STATUS       = 1005
+	WS_CLOSE_INVALID_DATA    = 1007
+	WS_CLOSE_POLICY          = 1008
+	WS_CLOSE_TOO_BIG         = 1009
+	WS_CLOSE_TRY_AGAIN_LATER = 1013
+
+	wsGUID      = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	wsVersion   = "13"
+	wsWriteWait = 10 * time.Second
+	// messages are small JSON documents, anything bigger is closed with WS_CLOSE_TOO_BIG
+	wsMaxMessage = 64 << 10
+)
+
+// CloseError is returned by ReadMessage once the peer closed the connection or broke the protocol
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (c *CloseError) Error() string {
+	return fmt.Sprintf("websocket closed with %d: %s", c.Code, c.Reason)
+}
+
+// WebSocket is one side of a connection upgraded with the standard library. ReadMessage must be called
+// from a single goroutine, writes are safe from any goroutine.
+type WebSocket struct {
+	conn   net.Conn
+	br     *bufio.Reader
+	client bool
+
+	// ReadTimeout closes a silent connection, every frame received including pongs restarts it
+	ReadTimeout time.Duration
+
+	wmu       sync.Mutex
+	closeSent bool
+}
+
+func newWebSocket(conn net.Conn, br *bufio.Reader, client bool) *WebSocket {
+	// deadlines of the http server do not apply to the upgraded connection
+	conn.SetDeadline(time.Time{})
+	return &WebSocket{conn: conn, br: br, client: client}
+}
+
+// UpgradeWebSocket completes the handshake of r, it has answered the request itself when it returns an error
+func UpgradeWebSocket(w http.ResponseWriter, r *http.Request) (*WebSocket, error) {
+	if r.Header.Get("Sec-WebSocket-Version") != wsVersion {
+		w.Header().Set("Sec-WebSocket-Version", wsVersion)
+		err := fmt.Errorf("websocket version %s is required", wsVersion)
+		ErrorResponse(http.StatusUpgradeRequired, w, r, err)
+		return nil, err
+	}
+
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 ||
+		!headerHasToken(r.Header, "Connection", "upgrade") || !headerHasToken(r.Header, "Upgrade", "websocket") {
+		err := fmt.Errorf("not a websocket handshake")
+		ErrorResponse(http.StatusBadRequest, w, r, err)
+		return nil, err
+	}
+
+	conn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		ErrorResponse(http.StatusInternalServerError, w, r, err)
+		return nil, err
+	}
+
+	ws := newWebSocket(conn, brw.Reader, false)
+
+	handshake := "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + websocketAccept(key) + "\r\n\r\n"
+
+	conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	if _, err := io.WriteString(conn, handshake); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return ws, nil
+}
+
+// DialWebSocket connects to a ws, wss, http or https url. The response is returned as well when the server refuses the upgrade.
+func DialWebSocket(ctx context.Context, rawUrl string, header http.Header) (*WebSocket, *http.Response, error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	secure := u.Scheme == "wss" || u.Scheme == "https"
+	u.Scheme = map[bool]string{false: "http", true: "https"}[secure]
+
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), map[bool]string{false: "80", true: "443"}[secure])
+	}
+
+	var conn net.Conn
+	if secure {
+		conn, err = (&tls.Dialer{Config: &tls.Config{ServerName: u.Hostname()}}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	for k, v := range header {
+		r.Header[k] = v
+	}
+	r.Header.Set("Connection", "Upgrade")
+	r.Header.Set("Upgrade", "websocket")
+	r.Header.Set("Sec-WebSocket-Version", wsVersion)
+	r.Header.Set("Sec-WebSocket-Key", key)
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if err := r.Write(conn); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, r)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		conn.Close()
+		return nil, resp, fmt.Errorf("websocket upgrade refused with %s", resp.Status)
+	}
+
+	if resp.Header.Get("Sec-WebSocket-Accept") != websocketAccept(key) {
+		conn.Close()
+		return nil, resp, fmt.Errorf("websocket upgrade answered with a wrong Sec-WebSocket-Accept")
+	}
+
+	return newWebSocket(conn, br, true), resp, nil
+}
+
+func websocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func headerHasToken(h http.Header, name string, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ReadMessage returns the next text or binary message. It answers pings and close frames on its own,
+// a *CloseError reports that the connection is done.
+func (ws *WebSocket) ReadMessage() (int, []byte, error) {
+	op := -1
+	var msg []byte
+
+	for {
+		if ws.ReadTimeout > 0 {
+			ws.conn.SetReadDeadline(time.Now().Add(ws.ReadTimeout))
+		}
+
+		fin, frameOp, payload, err := ws.readFrame()
+		if err != nil {
+			var ce *CloseError
+			if errors.As(err, &ce) {
+				ws.Close(ce.Code, ce.Reason)
+			}
+			return 0, nil, err
+		}
+
+		switch frameOp {
+		case WS_OP_PING:
+			ws.write(WS_OP_PONG, payload)
+			continue
+
+		case WS_OP_PONG:
+			continue
+
+		case WS_OP_CLOSE:
+			ce := &CloseError{Code: WS_CLOSE_NO_STATUS}
+			if len(payload) >= 2 {
+				ce.Code = int(binary.BigEndian.Uint16(payload))
+				ce.Reason = string(payload[2:])
+			}
+			// echo the code as the closing handshake asks for, 1005 only stands for a missing one
+			if ce.Code == WS_CLOSE_NO_STATUS {
+				ws.Close(WS_CLOSE_NORMAL, "")
+			} else {
+				ws.Close(ce.Code, "")
+			}
+			return 0, nil, ce
+
+		case WS_OP_CONTINUATION:
+			if op < 0 {
+				return 0, nil, ws.fail(WS_CLOSE_PROTOCOL_ERROR, "continuation without a message")
+			}
+			msg = append(msg, payload...)
+
+		case WS_OP_TEXT, WS_OP_BINARY:
+			if op >= 0 {
+				return 0, nil, ws.fail(WS_CLOSE_PROTOCOL_ERROR, "new message inside a fragmented one")
+			}
+			op, msg = frameOp, payload
+
+		default:
+			return 0, nil, ws.fail(WS_CLOSE_PROTOCOL_ERROR, fmt.Sprintf("unknown opcode %d", frameOp))
+		}
+
+		if len(msg) > wsMaxMessage {
+			return 0, nil, ws.fail(WS_CLOSE_TOO_BIG, "message too big")
+		}
+
+		if fin {
+			if op == WS_OP_TEXT && !utf8.Valid(msg) {
+				return 0, nil, ws.fail(WS_CLOSE_INVALID_DATA, "text message is not utf-8")
+			}
+			return op, msg, nil
+		}
+	}
+}
+
+func (ws *WebSocket) fail(code int, reason string) error {
+	ws.Close(code, reason)
+	return &CloseError{Code: code, Reason: reason}
+}
+
+func (ws *WebSocket) readFrame() (bool, int, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(ws.br, head[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	fin := head[0]&0x80 != 0
+	op := int(head[0] & 0x0f)
+	masked := head[1]&0x80 != 0
+
+	if head[0]&0x70 != 0 {
+		return false, 0, nil, &CloseError{Code: WS_CLOSE_PROTOCOL_ERROR, Reason: "no extension was negotiated"}
+	}
+	// clients mask every frame and servers none
+	if masked == ws.client {
+		return false, 0, nil, &CloseError{Code: WS_CLOSE_PROTOCOL_ERROR, Reason: "wrong masking"}
+	}
+
+	length := uint64(head[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(ws.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(ws.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+
+	if op >= WS_OP_CLOSE && (!fin || length > 125) {
+		return false, 0, nil, &CloseError{Code: WS_CLOSE_PROTOCOL_ERROR, Reason: "invalid control frame"}
+	}
+	if length > wsMaxMessage {
+		return false, 0, nil, &CloseError{Code: WS_CLOSE_TOO_BIG, Reason: "message too big"}
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(ws.br, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(ws.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+
+	return fin, op, payload, nil
+}
+
+func (ws *WebSocket) WriteMessage(op int, data []byte) error {
+	return ws.write(op, data)
+}
+
+func (ws *WebSocket) WriteJSON(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return ws.write(WS_OP_TEXT, data)
+}
+
+func (ws *WebSocket) Ping() error {
+	return ws.write(WS_OP_PING, nil)
+}
+
+// Close sends a close frame unless one was sent already and closes the connection
+func (ws *WebSocket) Close(code int, reason string) error {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	payload = append(payload, reason...)
+	if len(payload) > 125 {
+		payload = payload[:125]
+	}
+
+	ws.write(WS_OP_CLOSE, payload)
+	return ws.conn.Close()
+}
+
+func (ws *WebSocket) write(op int, payload []byte) error {
+	ws.wmu.Lock()
+	defer ws.wmu.Unlock()
+
+	if ws.closeSent {
+		return net.ErrClosed
+	}
+	if op == WS_OP_CLOSE {
+		ws.closeSent = true
+	}
+
+	frame := make([]byte, 0, 14+len(payload))
+	frame = append(frame, 0x80|byte(op))
+
+	maskBit := byte(0)
+	if ws.client {
+		maskBit = 0x80
+	}
+
+	switch n := len(payload); {
+	case n <= 125:
+		frame = append(frame, maskBit|byte(n))
+	case n <= 0xffff:
+		frame = append(frame, maskBit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+
+	if ws.client {
+		var mask [4]byte
+		rand.Read(mask[:])
+		frame = append(frame, mask[:]...)
+		for i, b := range payload {
+			frame = append(frame, b^mask[i%4])
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+
+	ws.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	_, err := ws.conn.Write(frame)
+	return err
+}
@@ -0,0 +1,96 @@
+package web
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func maskedFrame(fin bool, op byte, payload []byte) []byte {
+	head := op
+	if fin {
+		head |= 0x80
+	}
+	mask := []byte{1, 2, 3, 4}
+
+	frame := append([]byte{head, 0x80 | byte(len(payload))}, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	return frame
+}
+
+func pipe() (*WebSocket, net.Conn) {
+	server, client := net.Pipe()
+	return newWebSocket(server, bufio.NewReader(server), false), client
+}
+
+func TestWebSocket_FragmentsAndPing(t *testing.T) {
+	ws, client := pipe()
+	defer client.Close()
+
+	go func() {
+		client.Write(maskedFrame(false, WS_OP_TEXT, []byte("hel")))
+		client.Write(maskedFrame(true, WS_OP_PING, []byte("p")))
+		client.Write(maskedFrame(true, WS_OP_CONTINUATION, []byte("lo")))
+	}()
+
+	pong := make(chan []byte)
+	go func() {
+		b := make([]byte, 3)
+		io.ReadFull(client, b)
+		pong <- b
+	}()
+
+	op, msg, err := ws.ReadMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, WS_OP_TEXT, op)
+	assert.Equal(t, "hello", string(msg))
+	assert.Equal(t, []byte{0x80 | WS_OP_PONG, 1, 'p'}, <-pong, "pings are answered while a message is assembled")
+}
+
+func TestWebSocket_RejectsUnmaskedFrames(t *testing.T) {
+	ws, client := pipe()
+	defer client.Close()
+
+	go client.Write([]byte{0x80 | WS_OP_TEXT, 2, 'h', 'i'})
+
+	closeFrame := make(chan []byte)
+	go func() {
+		b, _ := io.ReadAll(client)
+		closeFrame <- b
+	}()
+
+	_, _, err := ws.ReadMessage()
+	var ce *CloseError
+	if assert.ErrorAs(t, err, &ce) {
+		assert.Equal(t, WS_CLOSE_PROTOCOL_ERROR, ce.Code)
+	}
+	assert.True(t, bytes.HasPrefix(<-closeFrame, []byte{0x80 | WS_OP_CLOSE}))
+}
+
+func TestWebSocket_ClientToServer(t *testing.T) {
+	ws, conn := pipe()
+	client := newWebSocket(conn, bufio.NewReader(conn), true)
+
+	long := bytes.Repeat([]byte("x"), 1000)
+	go client.WriteMessage(WS_OP_BINARY, long)
+
+	op, msg, err := ws.ReadMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, WS_OP_BINARY, op)
+	assert.Equal(t, long, msg)
+
+	go client.WriteMessage(WS_OP_TEXT, bytes.Repeat([]byte("x"), wsMaxMessage+1))
+	go io.Copy(io.Discard, conn)
+
+	_, _, err = ws.ReadMessage()
+	var ce *CloseError
+	if assert.ErrorAs(t, err, &ce) {
+		assert.Equal(t, WS_CLOSE_TOO_BIG, ce.Code)
+	}
+}
@@ -0,0 +1,334 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	mathrand "math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vivekmv23/go-web-frameworks/config"
+	"github.com/vivekmv23/go-web-frameworks/events"
+)
+
+const (
+	// DELIVERY_LOG_LIMIT is the number of deliveries shown per subscription
+	DELIVERY_LOG_LIMIT = 100
+
+	claimBatch       = 16
+	parallelAttempts = 4
+	pollInterval     = time.Second
+)
+
+// Dispatcher registers subscriptions, queues a delivery per subscription for every event and attempts
+// the due deliveries while Run is going
+type Dispatcher struct {
+	store  Store
+	c      config.WebhooksConfig
+	client *http.Client
+	wake   chan struct{}
+
+	now    func() time.Time
+	jitter func(time.Duration) time.Duration
+}
+
+func NewDispatcher(s Store, c config.WebhooksConfig) *Dispatcher {
+	return &Dispatcher{
+		store:  s,
+		c:      c,
+		client: newReceiverGuard(c.AllowedNetworks).client(time.Duration(c.Timeout)),
+		wake:   make(chan struct{}, 1),
+		now:    time.Now,
+		// spread the retries of deliveries that failed together over +-20%
+		jitter: func(d time.Duration) time.Duration {
+			return time.Duration(float64(d) * (0.8 + 0.4*mathrand.Float64()))
+		},
+	}
+}
+
+// Register validates s and stores it with a new id, a secret is generated when s has none
+func (d *Dispatcher) Register(s Subscription) (Subscription, error) {
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return s, &InvalidSubscription{Reason: fmt.Sprintf("url %q must be an absolute http or https url", s.URL)}
+	}
+
+	for _, e := range s.Events {
+		if !isEventName(e) {
+			return s, &InvalidSubscription{Reason: fmt.Sprintf("event %q must be one of %v", e, Events)}
+		}
+	}
+
+	if s.Secret == "" {
+		secret := make([]byte, 32)
+		rand.Read(secret)
+		s.Secret = hex.EncodeToString(secret)
+	}
+
+	s.Id = uuid.New()
+	s.CreatedOn = d.now().Round(0)
+	if s.Events == nil {
+		s.Events = []string{}
+	}
+
+	return s, d.store.SaveSubscription(s)
+}
+
+func isEventName(e string) bool {
+	for _, name := range Events {
+		if e == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscriptions lists the registered subscriptions without their secrets
+func (d *Dispatcher) Subscriptions() ([]Subscription, error) {
+	subscriptions, err := d.store.GetSubscriptions()
+	for idx := range subscriptions {
+		subscriptions[idx].Secret = ""
+	}
+	return subscriptions, err
+}
+
+func (d *Dispatcher) Subscription(id uuid.UUID) (Subscription, error) {
+	s, err := d.store.GetSubscription(id)
+	s.Secret = ""
+	return s, err
+}
+
+// Unregister removes a subscription, its pending deliveries are dead-lettered when they come due
+func (d *Dispatcher) Unregister(id uuid.UUID) error {
+	return d.store.DeleteSubscription(id)
+}
+
+// Deliveries is the delivery log of a subscription, newest first with every attempt
+func (d *Dispatcher) Deliveries(subscriptionId uuid.UUID) ([]Delivery, error) {
+	if _, err := d.store.GetSubscription(subscriptionId); err != nil {
+		return nil, err
+	}
+	return d.store.GetDeliveries(subscriptionId, DELIVERY_LOG_LIMIT)
+}
+
+// Redeliver queues a delivery again right away, usually one that was dead-lettered
+func (d *Dispatcher) Redeliver(subscriptionId uuid.UUID, deliveryId uuid.UUID) (Delivery, error) {
+	del, err := d.store.GetDelivery(deliveryId)
+	if err != nil {
+		return del, err
+	}
+	if del.SubscriptionId != subscriptionId {
+		return del, &NotFound{Kind: "delivery", Id: deliveryId}
+	}
+
+	del.Status = DELIVERY_PENDING
+	del.NextAttemptOn = d.now()
+	if err := d.store.SaveDelivery(del); err != nil {
+		return del, err
+	}
+
+	d.notify()
+	return del, nil
+}
+
+// Publish queues a delivery of ev for every subscription that wants it
+func (d *Dispatcher) Publish(ev events.Event) error {
+	name, known := eventNames[ev.Type]
+	if !known {
+		return nil
+	}
+
+	subscriptions, err := d.store.GetSubscriptions()
+	if err != nil {
+		return err
+	}
+
+	now := d.now().Round(0)
+	for _, s := range subscriptions {
+		if !s.wants(name) {
+			continue
+		}
+
+		del := Delivery{Id: uuid.New(), SubscriptionId: s.Id, Event: name, Status: DELIVERY_PENDING, Attempts: []Attempt{}, NextAttemptOn: now, CreatedOn: now}
+		del.Body, err = json.Marshal(Payload{Id: del.Id, Event: name, OccurredOn: ev.At, Item: ev.Item})
+		if err != nil {
+			return err
+		}
+
+		if err := d.store.SaveDelivery(del); err != nil {
+			return err
+		}
+	}
+
+	d.notify()
+	return nil
+}
+
+func (d *Dispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Consume publishes the events of bus until ctx ends. When the bus drops the subscription for being
+// slow it resumes after the last event it saw, events that already left the bus log are reported as lost.
+func (d *Dispatcher) Consume(ctx context.Context, bus *events.Bus) {
+	lastEventId := ""
+	for {
+		sub := bus.Subscribe(lastEventId)
+		if sub.Missed && lastEventId != "" {
+			log.Printf("ERROR: webhooks fell behind the event log, events after %s are not delivered", lastEventId)
+		}
+
+		for _, ev := range sub.Backlog {
+			d.consume(ev, &lastEventId)
+		}
+
+	events:
+		for {
+			select {
+			case <-ctx.Done():
+				sub.Close()
+				return
+			case ev, open := <-sub.C:
+				if !open {
+					break events
+				}
+				d.consume(ev, &lastEventId)
+			}
+		}
+	}
+}
+
+func (d *Dispatcher) consume(ev events.Event, lastEventId *string) {
+	if err := d.Publish(ev); err != nil {
+		log.Printf("ERROR: failed to queue webhook deliveries of event %s: %s", ev.Id, err)
+	}
+	*lastEventId = ev.Id
+}
+
+// Run attempts due deliveries until ctx ends
+func (d *Dispatcher) Run(ctx context.Context) {
+	poll := time.NewTicker(pollInterval)
+	defer poll.Stop()
+
+	for {
+		for d.DeliverDue(ctx) == claimBatch {
+			// a full batch, there may be more waiting
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-poll.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// DeliverDue makes one attempt for a batch of due deliveries and returns how many there were
+func (d *Dispatcher) DeliverDue(ctx context.Context) int {
+	// an attempt can not outlast its timeout, so a lease of twice that is never taken over by mistake
+	due, err := d.store.ClaimDue(d.now(), 2*time.Duration(d.c.Timeout), claimBatch)
+	if err != nil {
+		log.Printf("ERROR: failed to claim webhook deliveries: %s", err)
+		return 0
+	}
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, parallelAttempts)
+	for _, del := range due {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(del Delivery) {
+			defer func() { <-slots; wg.Done() }()
+			d.deliver(ctx, del)
+		}(del)
+	}
+	wg.Wait()
+
+	return len(due)
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, del Delivery) {
+	s, err := d.store.GetSubscription(del.SubscriptionId)
+
+	var a Attempt
+	if err != nil {
+		a = Attempt{On: d.now(), Error: fmt.Sprintf("webhook is gone: %s", err)}
+		del.Status = DELIVERY_DEAD
+	} else {
+		a = d.attempt(ctx, s, del)
+	}
+	del.Attempts = append(del.Attempts, a)
+
+	switch {
+	case del.Status == DELIVERY_DEAD:
+	case a.Error == "":
+		del.Status = DELIVERY_DELIVERED
+	case len(del.Attempts) >= d.c.MaxAttempts:
+		del.Status = DELIVERY_DEAD
+		log.Printf("ERROR: webhook delivery %s to %s dead-lettered after %d attempts: %s", del.Id, s.URL, len(del.Attempts), a.Error)
+	default:
+		del.NextAttemptOn = d.now().Add(d.backoff(len(del.Attempts)))
+	}
+
+	if err := d.store.SaveDelivery(del); err != nil {
+		log.Printf("ERROR: failed to save webhook delivery %s: %s", del.Id, err)
+	}
+}
+
+// backoff doubles the wait after every failed attempt up to MaxBackoff
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	wait := time.Duration(d.c.Backoff)
+	for n := 1; n < attempts && wait < time.Duration(d.c.MaxBackoff); n++ {
+		wait *= 2
+	}
+	return d.jitter(min(wait, time.Duration(d.c.MaxBackoff)))
+}
+
+func (d *Dispatcher) attempt(ctx context.Context, s Subscription, del Delivery) Attempt {
+	start := time.Now()
+	a := Attempt{On: d.now().Round(0)}
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(del.Body))
+	if err != nil {
+		a.Error = err.Error()
+		return a
+	}
+
+	timestamp := d.now().Unix()
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("User-Agent", "go-web-frameworks-webhooks")
+	r.Header.Set(HEADER_ID, del.Id.String())
+	r.Header.Set(HEADER_EVENT, del.Event)
+	r.Header.Set(HEADER_TIMESTAMP, strconv.FormatInt(timestamp, 10))
+	r.Header.Set(HEADER_SIGNATURE, Sign(s.Secret, timestamp, del.Body))
+
+	resp, err := d.client.Do(r)
+	a.Duration = time.Since(start)
+	if err != nil {
+		a.Error = err.Error()
+		return a
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	a.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		a.Error = fmt.Sprintf("receiver answered %s", resp.Status)
+	}
+
+	return a
+}
@@ -0,0 +1,203 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vivekmv23/go-web-frameworks/config"
+	"github.com/vivekmv23/go-web-frameworks/events"
+	"github.com/vivekmv23/go-web-frameworks/lib"
+)
+
+type receiver struct {
+	mu       sync.Mutex
+	status   int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.requests = append(rc.requests, r)
+	rc.bodies = append(rc.bodies, body)
+	w.WriteHeader(rc.status)
+}
+
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time { return c.t }
+
+func newTestDispatcher(t *testing.T, status int) (*Dispatcher, *receiver, *httptest.Server, *clock) {
+	rc := &receiver{status: status}
+	s := httptest.NewServer(rc)
+	t.Cleanup(s.Close)
+
+	c := &clock{t: time.Date(2024, 9, 1, 10, 0, 0, 0, time.UTC)}
+	d := NewDispatcher(NewMemoryStore(), config.WebhooksConfig{
+		MaxAttempts: 3,
+		Backoff:     config.Duration(time.Second),
+		MaxBackoff:  config.Duration(time.Minute),
+		Timeout:     config.Duration(5 * time.Second),
+		// the test receiver listens on loopback
+		AllowedNetworks: []string{"127.0.0.0/8", "::1/128"},
+	})
+	d.now = c.now
+	d.jitter = func(d time.Duration) time.Duration { return d }
+
+	return d, rc, s, c
+}
+
+func TestDispatcher_DeliversSigned(t *testing.T) {
+	d, rc, s, c := newTestDispatcher(t, http.StatusNoContent)
+
+	sub, err := d.Register(Subscription{URL: s.URL, Events: []string{ITEM_CREATED}})
+	require.NoError(t, err)
+	assert.Len(t, sub.Secret, 64)
+
+	item := lib.Item{Id: uuid.New(), Name: "name"}
+	require.NoError(t, d.Publish(events.Event{Type: events.ITEM_CREATED, Item: item, At: c.t}))
+	require.NoError(t, d.Publish(events.Event{Type: events.ITEM_DELETED, Item: item, At: c.t}))
+
+	assert.Equal(t, 1, d.DeliverDue(context.Background()), "item.deleted is not subscribed")
+	require.Len(t, rc.requests, 1)
+
+	r := rc.requests[0]
+	assert.Equal(t, ITEM_CREATED, r.Header.Get(HEADER_EVENT))
+	// the clock of the test is in the past, so the age check is left out
+	assert.Equal(t, Sign(sub.Secret, c.t.Unix(), rc.bodies[0]), r.Header.Get(HEADER_SIGNATURE))
+
+	var p Payload
+	require.NoError(t, json.Unmarshal(rc.bodies[0], &p))
+	assert.Equal(t, ITEM_CREATED, p.Event)
+	assert.Equal(t, item.Id, p.Item.Id)
+	assert.Equal(t, r.Header.Get(HEADER_ID), p.Id.String())
+
+	log, err := d.Deliveries(sub.Id)
+	require.NoError(t, err)
+	require.Len(t, log, 1)
+	assert.Equal(t, DELIVERY_DELIVERED, log[0].Status)
+	assert.Equal(t, http.StatusNoContent, log[0].Attempts[0].StatusCode)
+
+	assert.Zero(t, d.DeliverDue(context.Background()))
+}
+
+func TestDispatcher_RetriesAndDeadLetters(t *testing.T) {
+	d, rc, s, c := newTestDispatcher(t, http.StatusInternalServerError)
+
+	sub, err := d.Register(Subscription{URL: s.URL})
+	require.NoError(t, err)
+	require.NoError(t, d.Publish(events.Event{Type: events.ITEM_UPDATED}))
+
+	for _, wait := range []time.Duration{time.Second, 2 * time.Second} {
+		assert.Equal(t, 1, d.DeliverDue(context.Background()))
+
+		log, _ := d.Deliveries(sub.Id)
+		assert.Equal(t, DELIVERY_PENDING, log[0].Status)
+		assert.Equal(t, c.t.Add(wait), log[0].NextAttemptOn)
+
+		assert.Zero(t, d.DeliverDue(context.Background()), "not due before the backoff")
+		c.t = c.t.Add(wait)
+	}
+
+	assert.Equal(t, 1, d.DeliverDue(context.Background()))
+	log, _ := d.Deliveries(sub.Id)
+	assert.Equal(t, DELIVERY_DEAD, log[0].Status)
+	assert.Len(t, log[0].Attempts, 3)
+	assert.Len(t, rc.requests, 3)
+
+	rc.status = http.StatusOK
+	_, err = d.Redeliver(sub.Id, log[0].Id)
+	require.NoError(t, err)
+	assert.Equal(t, 1, d.DeliverDue(context.Background()))
+
+	log, _ = d.Deliveries(sub.Id)
+	assert.Equal(t, DELIVERY_DELIVERED, log[0].Status)
+	assert.Equal(t, rc.bodies[0], rc.bodies[3], "retries send the same body")
+}
+
+func TestDispatcher_ConsumesBus(t *testing.T) {
+	d, _, s, _ := newTestDispatcher(t, http.StatusOK)
+	sub, err := d.Register(Subscription{URL: s.URL})
+	require.NoError(t, err)
+
+	bus := events.NewBus(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.Consume(ctx, bus)
+
+	assert.Eventually(t, func() bool {
+		bus.Publish(events.ITEM_CREATED, lib.Item{})
+		log, _ := d.Deliveries(sub.Id)
+		return len(log) > 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestDispatcher_Register(t *testing.T) {
+	d, _, _, _ := newTestDispatcher(t, http.StatusOK)
+
+	for _, s := range []Subscription{
+		{URL: "ftp://example.com"},
+		{URL: "/relative"},
+		{URL: "https://example.com", Events: []string{"item.renamed"}},
+	} {
+		_, err := d.Register(s)
+		assert.IsType(t, &InvalidSubscription{}, err, s.URL)
+	}
+
+	sub, err := d.Register(Subscription{URL: "https://example.com/hook", Secret: "my secret"})
+	require.NoError(t, err)
+	assert.Equal(t, "my secret", sub.Secret)
+
+	listed, err := d.Subscriptions()
+	require.NoError(t, err)
+	require.Len(t, listed, 1)
+	assert.Empty(t, listed[0].Secret, "secrets are only shown once")
+
+	assert.NoError(t, d.Unregister(sub.Id))
+	assert.IsType(t, &NotFound{}, d.Unregister(sub.Id))
+}
+
+func TestDispatcher_RefusesInternalReceivers(t *testing.T) {
+	d, rc, s, _ := newTestDispatcher(t, http.StatusOK)
+	d.client = newReceiverGuard(nil).client(5 * time.Second)
+
+	port := s.URL[strings.LastIndex(s.URL, ":"):]
+	for _, url := range []string{s.URL, "http://localhost" + port} {
+		sub, err := d.Register(Subscription{URL: url})
+		require.NoError(t, err)
+		require.NoError(t, d.Publish(events.Event{Type: events.ITEM_UPDATED}))
+		assert.Equal(t, 1, d.DeliverDue(context.Background()))
+
+		log, _ := d.Deliveries(sub.Id)
+		assert.Contains(t, log[0].Attempts[0].Error, "is not allowed", url)
+		require.NoError(t, d.Unregister(sub.Id))
+	}
+	assert.Empty(t, rc.requests)
+}
+
+func TestReceiverGuard(t *testing.T) {
+	g := newReceiverGuard([]string{"10.1.0.0/16"})
+
+	for _, addr := range []string{"127.0.0.1", "::1", "10.0.0.1", "172.16.0.1", "192.168.1.1", "169.254.169.254", "fe80::1", "fd00::1", "0.0.0.0", "::ffff:127.0.0.1"} {
+		assert.False(t, g.permits(netip.MustParseAddr(addr)), addr)
+	}
+	for _, addr := range []string{"10.1.2.3", "93.184.216.34", "2606:2800:220:1::1"} {
+		assert.True(t, g.permits(netip.MustParseAddr(addr)), addr)
+	}
+}
@@ -0,0 +1,121 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	SUBSCRIPTION_COLLECTION = "webhooks"
+	DELIVERY_COLLECTION     = "webhookDeliveries"
+)
+
+// Should satisfy Store interface, keeps the queue next to the items so it survives restarts
+type MongoStore struct {
+	subscriptions *mongo.Collection
+	deliveries    *mongo.Collection
+}
+
+func NewMongoStore(connection_url string, db_name string) (Store, error) {
+	client, err := mongo.Connect(context.TODO(), options.Client().ApplyURI(connection_url))
+	if err != nil {
+		return nil, err
+	}
+
+	db := client.Database(db_name)
+	return &MongoStore{
+		subscriptions: db.Collection(SUBSCRIPTION_COLLECTION),
+		deliveries:    db.Collection(DELIVERY_COLLECTION),
+	}, nil
+}
+
+func (m *MongoStore) SaveSubscription(s Subscription) error {
+	_, err := m.subscriptions.ReplaceOne(context.TODO(), bson.D{{Key: "id", Value: s.Id}}, s, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (m *MongoStore) GetSubscription(id uuid.UUID) (Subscription, error) {
+	var s Subscription
+	err := m.subscriptions.FindOne(context.TODO(), bson.D{{Key: "id", Value: id}}).Decode(&s)
+	return s, notFound(err, "webhook", id)
+}
+
+func (m *MongoStore) GetSubscriptions() ([]Subscription, error) {
+	cur, err := m.subscriptions.Find(context.TODO(), bson.D{}, options.Find().SetSort(bson.D{{Key: "createdOn", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	subscriptions := []Subscription{}
+	err = cur.All(context.TODO(), &subscriptions)
+	return subscriptions, err
+}
+
+func (m *MongoStore) DeleteSubscription(id uuid.UUID) error {
+	res, err := m.subscriptions.DeleteOne(context.TODO(), bson.D{{Key: "id", Value: id}})
+	if err == nil && res.DeletedCount == 0 {
+		err = mongo.ErrNoDocuments
+	}
+	return notFound(err, "webhook", id)
+}
+
+func (m *MongoStore) SaveDelivery(d Delivery) error {
+	_, err := m.deliveries.ReplaceOne(context.TODO(), bson.D{{Key: "id", Value: d.Id}}, d, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (m *MongoStore) GetDelivery(id uuid.UUID) (Delivery, error) {
+	var d Delivery
+	err := m.deliveries.FindOne(context.TODO(), bson.D{{Key: "id", Value: id}}).Decode(&d)
+	return d, notFound(err, "delivery", id)
+}
+
+func (m *MongoStore) GetDeliveries(subscriptionId uuid.UUID, limit int) ([]Delivery, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "createdOn", Value: -1}}).SetLimit(int64(limit))
+	cur, err := m.deliveries.Find(context.TODO(), bson.D{{Key: "subscriptionId", Value: subscriptionId}}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := []Delivery{}
+	err = cur.All(context.TODO(), &deliveries)
+	return deliveries, err
+}
+
+// ClaimDue takes deliveries one at a time with findOneAndUpdate, so dispatchers of several processes never claim the same one
+func (m *MongoStore) ClaimDue(now time.Time, lease time.Duration, limit int) ([]Delivery, error) {
+	filter := bson.D{
+		{Key: "status", Value: DELIVERY_PENDING},
+		{Key: "nextAttemptOn", Value: bson.D{{Key: "$lte", Value: now}}},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "nextAttemptOn", Value: now.Add(lease)}}}}
+	opts := options.FindOneAndUpdate().SetSort(bson.D{{Key: "nextAttemptOn", Value: 1}})
+
+	var due []Delivery
+	for len(due) < limit {
+		var d Delivery
+		err := m.deliveries.FindOneAndUpdate(context.TODO(), filter, update, opts).Decode(&d)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			break
+		}
+		if err != nil {
+			return due, err
+		}
+		due = append(due, d)
+	}
+
+	return due, nil
+}
+
+func notFound(err error, kind string, id uuid.UUID) error {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return &NotFound{Kind: kind, Id: id}
+	}
+	return err
+}
@@ -0,0 +1,64 @@
+package webhooks
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// receiverGuard refuses connections to private, loopback, link-local and unspecified addresses, so
+// that a registered webhook cannot reach internal services. It checks the address that is dialed,
+// after resolution and on every redirect, a host name that resolves to an internal address is
+// refused as well.
+type receiverGuard struct {
+	allowed []netip.Prefix
+}
+
+// newReceiverGuard allows the given CIDRs, config.Validate rejects the invalid ones
+func newReceiverGuard(networks []string) *receiverGuard {
+	g := &receiverGuard{}
+	for _, network := range networks {
+		if p, err := netip.ParsePrefix(network); err == nil {
+			g.allowed = append(g.allowed, p.Masked())
+		}
+	}
+	return g
+}
+
+func (g *receiverGuard) permits(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, p := range g.allowed {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+
+	return !addr.IsPrivate() && !addr.IsLoopback() && !addr.IsLinkLocalUnicast() &&
+		!addr.IsLinkLocalMulticast() && !addr.IsInterfaceLocalMulticast() && !addr.IsUnspecified()
+}
+
+// control runs for every connection before it is made
+func (g *receiverGuard) control(network string, address string, _ syscall.RawConn) error {
+	ap, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !g.permits(ap.Addr()) {
+		return fmt.Errorf("receiver address %s is not allowed, add it to webhooks.allowedNetworks if it is internal", ap.Addr())
+	}
+	return nil
+}
+
+// client delivers through the guard and never through a proxy, which would be dialed instead
+func (g *receiverGuard) client(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: g.control}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
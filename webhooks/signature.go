@@ -0,0 +1,47 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	HEADER_ID        = "X-Webhook-Id"
+	HEADER_EVENT     = "X-Webhook-Event"
+	HEADER_TIMESTAMP = "X-Webhook-Timestamp"
+	HEADER_SIGNATURE = "X-Webhook-Signature"
+
+	signaturePrefix = "sha256="
+)
+
+// Sign computes the X-Webhook-Signature of body sent at timestamp, the timestamp is signed as well so
+// that a captured delivery can not be replayed later
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify is for receivers, it checks the signature of a delivery and that it was sent within tolerance
+func Verify(secret string, h http.Header, body []byte, tolerance time.Duration) error {
+	timestamp, err := strconv.ParseInt(h.Get(HEADER_TIMESTAMP), 10, 64)
+	if err != nil {
+		return fmt.Errorf("missing or malformed %s", HEADER_TIMESTAMP)
+	}
+
+	if age := time.Since(time.Unix(timestamp, 0)); age > tolerance || age < -tolerance {
+		return fmt.Errorf("delivery timestamp is %s off", age.Round(time.Second))
+	}
+
+	if !hmac.Equal([]byte(h.Get(HEADER_SIGNATURE)), []byte(Sign(secret, timestamp, body))) {
+		return fmt.Errorf("signature does not match")
+	}
+
+	return nil
+}
@@ -0,0 +1,28 @@
+package webhooks
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"event":"item.created"}`)
+	now := time.Now().Unix()
+
+	h := http.Header{}
+	h.Set(HEADER_TIMESTAMP, strconv.FormatInt(now, 10))
+	h.Set(HEADER_SIGNATURE, Sign("secret", now, body))
+
+	assert.NoError(t, Verify("secret", h, body, time.Minute))
+	assert.Error(t, Verify("other secret", h, body, time.Minute))
+	assert.Error(t, Verify("secret", h, []byte(`{"event":"item.deleted"}`), time.Minute))
+
+	old := now - 3600
+	h.Set(HEADER_TIMESTAMP, strconv.FormatInt(old, 10))
+	h.Set(HEADER_SIGNATURE, Sign("secret", old, body))
+	assert.Error(t, Verify("secret", h, body, time.Minute), "replayed deliveries are too old")
+}
@@ -0,0 +1,143 @@
+package webhooks
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Store persists subscriptions and the delivery queue, which must survive restarts so that no
+// accepted event is lost between attempts
+type Store interface {
+	SaveSubscription(s Subscription) error
+	GetSubscription(id uuid.UUID) (Subscription, error)
+	GetSubscriptions() ([]Subscription, error)
+	DeleteSubscription(id uuid.UUID) error
+
+	// SaveDelivery inserts d or replaces the delivery with the same id
+	SaveDelivery(d Delivery) error
+	GetDelivery(id uuid.UUID) (Delivery, error)
+	// GetDeliveries returns the latest deliveries of a subscription, newest first
+	GetDeliveries(subscriptionId uuid.UUID, limit int) ([]Delivery, error)
+	// ClaimDue returns pending deliveries due at now and postpones them by lease, so that a delivery whose
+	// dispatcher dies is attempted again once the lease is over
+	ClaimDue(now time.Time, lease time.Duration, limit int) ([]Delivery, error)
+}
+
+// Should satisfy Store interface, for local runs where the queue does not need to outlive the process
+type MemoryStore struct {
+	mu            sync.Mutex
+	subscriptions map[uuid.UUID]Subscription
+	deliveries    map[uuid.UUID]Delivery
+}
+
+func NewMemoryStore() Store {
+	return &MemoryStore{subscriptions: map[uuid.UUID]Subscription{}, deliveries: map[uuid.UUID]Delivery{}}
+}
+
+func (m *MemoryStore) SaveSubscription(s Subscription) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.subscriptions[s.Id] = s
+	return nil
+}
+
+func (m *MemoryStore) GetSubscription(id uuid.UUID) (Subscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, found := m.subscriptions[id]
+	if !found {
+		return s, &NotFound{Kind: "webhook", Id: id}
+	}
+	return s, nil
+}
+
+func (m *MemoryStore) GetSubscriptions() ([]Subscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	subscriptions := make([]Subscription, 0, len(m.subscriptions))
+	for _, s := range m.subscriptions {
+		subscriptions = append(subscriptions, s)
+	}
+	sort.Slice(subscriptions, func(i, j int) bool { return subscriptions[i].CreatedOn.Before(subscriptions[j].CreatedOn) })
+
+	return subscriptions, nil
+}
+
+func (m *MemoryStore) DeleteSubscription(id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, found := m.subscriptions[id]; !found {
+		return &NotFound{Kind: "webhook", Id: id}
+	}
+	delete(m.subscriptions, id)
+	return nil
+}
+
+func (m *MemoryStore) SaveDelivery(d Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.deliveries[d.Id] = d
+	return nil
+}
+
+func (m *MemoryStore) GetDelivery(id uuid.UUID) (Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	d, found := m.deliveries[id]
+	if !found {
+		return d, &NotFound{Kind: "delivery", Id: id}
+	}
+	return d, nil
+}
+
+func (m *MemoryStore) GetDeliveries(subscriptionId uuid.UUID, limit int) ([]Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deliveries := []Delivery{}
+	for _, d := range m.deliveries {
+		if d.SubscriptionId == subscriptionId {
+			deliveries = append(deliveries, d)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].CreatedOn.After(deliveries[j].CreatedOn) })
+
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+func (m *MemoryStore) ClaimDue(now time.Time, lease time.Duration, limit int) ([]Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var due []Delivery
+	for _, d := range m.deliveries {
+		if d.Status == DELIVERY_PENDING && !d.NextAttemptOn.After(now) {
+			due = append(due, d)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].NextAttemptOn.Before(due[j].NextAttemptOn) })
+
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	for idx := range due {
+		claimed := m.deliveries[due[idx].Id]
+		claimed.NextAttemptOn = now.Add(lease)
+		m.deliveries[claimed.Id] = claimed
+	}
+
+	return due, nil
+}
@@ -0,0 +1,21 @@
+package webhooks
+
+import "fmt"
+
+type NotFound struct {
+	Kind string
+	Id   interface{}
+}
+
+func (n *NotFound) Error() string {
+	return fmt.Sprintf("%s with id %s not found", n.Kind, n.Id)
+}
+
+// InvalidSubscription is returned when a webhook can not be registered as requested
+type InvalidSubscription struct {
+	Reason string
+}
+
+func (i *InvalidSubscription) Error() string {
+	return fmt.Sprintf("invalid webhook: %s", i.Reason)
+}
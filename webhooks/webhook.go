@@ -0,0 +1,83 @@
+// Package webhooks delivers item lifecycle events to URLs registered by users. Every event is queued as
+// one delivery per matching subscription in a Store, signed with the secret of the subscription and
+// retried with exponential backoff until it succeeds or is dead-lettered.
+package webhooks
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vivekmv23/go-web-frameworks/events"
+	"github.com/vivekmv23/go-web-frameworks/lib"
+)
+
+const (
+	ITEM_CREATED = "item.created"
+	ITEM_UPDATED = "item.updated"
+	ITEM_DELETED = "item.deleted"
+
+	DELIVERY_PENDING   = "pending"
+	DELIVERY_DELIVERED = "delivered"
+	// DELIVERY_DEAD is a dead-lettered delivery, it is kept for the delivery log and can be redelivered
+	DELIVERY_DEAD = "dead"
+)
+
+var (
+	Events = []string{ITEM_CREATED, ITEM_UPDATED, ITEM_DELETED}
+
+	eventNames = map[string]string{
+		events.ITEM_CREATED: ITEM_CREATED,
+		events.ITEM_UPDATED: ITEM_UPDATED,
+		events.ITEM_DELETED: ITEM_DELETED,
+	}
+)
+
+// Subscription is a registered webhook, no events means all of them
+type Subscription struct {
+	Id     uuid.UUID `bson:"id" json:"id"`
+	URL    string    `bson:"url" json:"url"`
+	Events []string  `bson:"events" json:"events"`
+	// Secret signs the deliveries, it is only shown when the subscription is created
+	Secret    string    `bson:"secret" json:"secret,omitempty"`
+	CreatedOn time.Time `bson:"createdOn" json:"createdOn"`
+}
+
+func (s Subscription) wants(event string) bool {
+	if len(s.Events) == 0 {
+		return true
+	}
+	for _, e := range s.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Payload is the body of every delivery
+type Payload struct {
+	Id         uuid.UUID `json:"id"`
+	Event      string    `json:"event"`
+	OccurredOn time.Time `json:"occurredOn"`
+	Item       lib.Item  `json:"item"`
+}
+
+type Delivery struct {
+	Id             uuid.UUID `bson:"id" json:"id"`
+	SubscriptionId uuid.UUID `bson:"subscriptionId" json:"subscriptionId"`
+	Event          string    `bson:"event" json:"event"`
+	// Body is signed once and sent unchanged on every attempt
+	Body          json.RawMessage `bson:"body" json:"body"`
+	Status        string          `bson:"status" json:"status"`
+	Attempts      []Attempt       `bson:"attempts" json:"attempts"`
+	NextAttemptOn time.Time       `bson:"nextAttemptOn" json:"nextAttemptOn"`
+	CreatedOn     time.Time       `bson:"createdOn" json:"createdOn"`
+}
+
+type Attempt struct {
+	On         time.Time     `bson:"on" json:"on"`
+	StatusCode int           `bson:"statusCode" json:"statusCode,omitempty"`
+	Error      string        `bson:"error" json:"error,omitempty"`
+	Duration   time.Duration `bson:"duration" json:"duration"`
+}
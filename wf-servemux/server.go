@@ -0,0 +1,84 @@
+package wfservemux
+
+import (
+	"net/http"
+
+	"github.com/vivekmv23/go-web-frameworks/config"
+	"github.com/vivekmv23/go-web-frameworks/database"
+	"github.com/vivekmv23/go-web-frameworks/service"
+	"github.com/vivekmv23/go-web-frameworks/web"
+)
+
+const catchAllPattern = "/"
+
+type ServeMuxWebServer struct {
+	d           database.ItemDatabase
+	middlewares []web.Middleware
+}
+
+// NewServeMuxWebServer runs middlewares on every items request once it is authenticated
+func NewServeMuxWebServer(d database.ItemDatabase, middlewares ...web.Middleware) *ServeMuxWebServer {
+	return &ServeMuxWebServer{d: d, middlewares: middlewares}
+}
+
+func (ws *ServeMuxWebServer) Start(c config.ServerConfig) {
+	web.Serve("ServeMux Patterns", ws.Handler(), c)
+}
+
+// Handler routes with Mux, but answers HEAD like the other frameworks: GET patterns also match HEAD,
+// which gorilla and the standard lib server answer with 405
+func (ws *ServeMuxWebServer) Handler() http.Handler {
+	mux := ws.Mux()
+	noRoute := NoRouteHandler(mux)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			noRoute.ServeHTTP(w, r)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// Mux holds the routes of the items API
+func (ws *ServeMuxWebServer) Mux() *http.ServeMux {
+	mux := http.NewServeMux()
+
+	chain := []web.Middleware{web.LogRequestMiddleware, web.AuthenticationMiddleware}
+	chain = append(chain, ws.middlewares...)
+	chain = append(chain, web.LogResponseMiddleware)
+
+	NewItemsHandler(ws.d, mux, chain...)
+
+	mux.Handle(catchAllPattern, NoRouteHandler(mux))
+
+	return mux
+}
+
+func NewItemsHandler(d database.ItemDatabase, mux *http.ServeMux, middlewares ...web.Middleware) *web.ItemsEndpoints {
+	ItemsHandler := web.NewItemsEndpoints(service.NewItemService(d), func(r *http.Request) string {
+		return r.PathValue("id")
+	})
+
+	handle := func(pattern string, h http.HandlerFunc) {
+		mux.Handle(pattern, web.Chain(h, middlewares...))
+	}
+
+	handle("GET /items", ItemsHandler.GetAllItems)
+	handle("GET /items/{$}", ItemsHandler.GetAllItems)
+	handle("POST /items", ItemsHandler.CreateItem)
+	handle("POST /items/{$}", ItemsHandler.CreateItem)
+	handle("GET /items/events", ItemsHandler.ItemEvents)
+	handle("GET /items/socket", ItemsHandler.ItemSocket)
+	handle("GET /items/{id}", ItemsHandler.GetItemById)
+	handle("DELETE /items/{id}", ItemsHandler.DeleteItemById)
+	handle("PUT /items/{id}", ItemsHandler.UpdateItem)
+
+	return ItemsHandler
+}
+
+// NoRouteHandler answers 405 with an Allow header when the path matches a pattern for other methods, 404 otherwise.
+// It is registered on the catch all pattern, which ServeMux prefers over its own plain text 405.
+func NoRouteHandler(mux *http.ServeMux) http.Handler {
+	return web.ServeMuxNoRoute(mux, catchAllPattern)
+}
@@ -0,0 +1,16 @@
+package wfstandardlib
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/vivekmv23/go-web-frameworks/conformance"
+	"github.com/vivekmv23/go-web-frameworks/database"
+	"github.com/vivekmv23/go-web-frameworks/web"
+)
+
+func TestConformance(t *testing.T) {
+	conformance.Run(t, func(d database.ItemDatabase, middlewares ...web.Middleware) http.Handler {
+		return NewStandardLibWebServer(d, middlewares...).Handler()
+	})
+}
@@ -1,159 +1,134 @@
 package wfstandardlib
 
 import (
-	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
 	"regexp"
 
-	"github.com/google/uuid"
+	"github.com/vivekmv23/go-web-frameworks/config"
 	"github.com/vivekmv23/go-web-frameworks/database"
-	"github.com/vivekmv23/go-web-frameworks/lib"
+	"github.com/vivekmv23/go-web-frameworks/service"
 	"github.com/vivekmv23/go-web-frameworks/web"
 )
 
+// ItemEventsPath and ItemSocketPath are matched before ItemsWithIDEndpointRegex, which would take them for ids
+const (
+	ItemEventsPath = "/items/events"
+	ItemSocketPath = "/items/socket"
+)
+
 var (
 	ItemsEndpointRegex       = regexp.MustCompile(`^/items/*$`)
-	ItemsWithIDEndpointRegex = regexp.MustCompile(`^/items/([0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12})$`)
+	ItemsWithIDEndpointRegex = regexp.MustCompile(`^/items/([^/]+)$`)
+
+	itemsMethods       = []string{http.MethodGet, http.MethodPost}
+	itemsWithIDMethods = []string{http.MethodGet, http.MethodPut, http.MethodDelete}
 )
 
 type StandardLibWebServer struct {
+	d           database.ItemDatabase
+	middlewares []web.Middleware
+}
+
+// NewStandardLibWebServer runs middlewares on every items request once it is authenticated
+func NewStandardLibWebServer(d database.ItemDatabase, middlewares ...web.Middleware) *StandardLibWebServer {
+	return &StandardLibWebServer{d: d, middlewares: middlewares}
+}
+
+func (ws *StandardLibWebServer) Start(c config.ServerConfig) {
+	web.Serve("Standard Lib", ws.Handler(), c)
 }
 
-func (ws *StandardLibWebServer) Start(port int) {
+func (ws *StandardLibWebServer) Handler() http.Handler {
 	mux := http.NewServeMux()
 
-	d := database.NewDatabase()
-	ih := NewItemsHandler(d)
+	ih := NewItemsHandler(ws.d, ws.middlewares...)
 
 	mux.Handle("/items", ih)
 	mux.Handle("/items/", ih)
+	mux.HandleFunc("/", web.NotFoundResponse)
 
-	log.Printf("Starting Server %d, Using Standard Lib...\n", port)
-	p := fmt.Sprintf(":%d", port)
-	err := http.ListenAndServe(p, mux)
-	if err != nil {
-		log.Fatalf("Failed to start server on port %d: %s", port, err)
-	}
+	return mux
 }
 
 type ItemsHandler struct {
-	d database.ItemDatabase
+	e *web.ItemsEndpoints
+	// next dispatches authorized requests through the middlewares
+	next http.Handler
 }
 
-func NewItemsHandler(d database.ItemDatabase) *ItemsHandler {
-	return &ItemsHandler{d: d}
+func NewItemsHandler(d database.ItemDatabase, middlewares ...web.Middleware) *ItemsHandler {
+	i := &ItemsHandler{e: web.NewItemsEndpoints(service.NewItemService(d), pathId)}
+	i.next = web.Chain(http.HandlerFunc(i.dispatch), middlewares...)
+	return i
 }
 
 // Satisfying the interface for handler
 func (i *ItemsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
-	// Authorization checks
-	if !web.IsAuthorized(r) {
-		web.ErrorResponse(http.StatusUnauthorized, w, r, fmt.Errorf("unauthorized, remove header 'unauthorized'"))
+	allowed := RouteMethods(r.URL.Path)
+	if allowed == nil {
+		web.NotFoundResponse(w, r)
 		return
 	}
 
-	switch {
-	// Explicitly routing request based on method and url pattern :(
-	case r.Method == http.MethodGet && ItemsEndpointRegex.MatchString(r.URL.Path):
-		i.getAllItem(w, r)
-
-	case r.Method == http.MethodGet && ItemsWithIDEndpointRegex.MatchString(r.URL.Path):
-		i.getItem(w, r)
-
-	case r.Method == http.MethodPost && ItemsEndpointRegex.MatchString(r.URL.Path):
-		i.createItem(w, r)
-
-	case r.Method == http.MethodDelete && ItemsWithIDEndpointRegex.MatchString(r.URL.Path):
-		i.deleteItem(w, r)
-
-	case r.Method == http.MethodPut && ItemsWithIDEndpointRegex.MatchString(r.URL.Path):
-		i.updateItem(w, r)
-
-	default:
-		web.ErrorResponse(http.StatusMethodNotAllowed, w, r, fmt.Errorf("method %s and/or on url %s not allowed", r.Method, r.URL.Path))
-	}
-
-}
-
-func (h *ItemsHandler) createItem(w http.ResponseWriter, r *http.Request) {
-	var itemToCreate lib.Item
-
-	if err := json.NewDecoder(r.Body).Decode(&itemToCreate); err != nil {
-		web.ErrorResponse(http.StatusBadRequest, w, r, err)
+	if !web.IsMethodAllowed(allowed, r.Method) {
+		web.MethodNotAllowedResponse(allowed, w, r)
 		return
 	}
 
-	if err := h.d.SaveItem(&itemToCreate); err != nil {
-		web.ErrorResponse(http.StatusInternalServerError, w, r, err)
-	} else {
-		web.SuccessResponse(http.StatusCreated, w, r, itemToCreate)
-	}
-
-}
-
-func (h *ItemsHandler) getItem(w http.ResponseWriter, r *http.Request) {
-	matches := ItemsWithIDEndpointRegex.FindStringSubmatch(r.RequestURI)
-	idToGet, _ := uuid.Parse(matches[1]) // 0: full string, 1: sub string matched
-
-	item, err := h.d.GetItemById(idToGet)
-
-	if err != nil {
-		// based on err, status code will be changed, e.g. 404 NOT_FOUND
-		web.ErrorResponse(http.StatusInternalServerError, w, r, err)
-	} else {
-		w.Header().Add("Etag", item.UpdatedOn.String())
-		web.SuccessResponse(http.StatusOK, w, r, item)
+	// Authorization checks
+	if !web.IsAuthorized(r) {
+		web.ErrorResponse(http.StatusUnauthorized, w, r, fmt.Errorf("unauthorized, remove header 'unauthorized'"))
+		return
 	}
 
+	i.next.ServeHTTP(w, r)
 }
 
-func (h *ItemsHandler) updateItem(w http.ResponseWriter, r *http.Request) {
-	ifMatch := r.Header.Get("If-Match")
-	if ifMatch == "" {
-		web.ErrorResponse(http.StatusPreconditionRequired, w, r, fmt.Errorf("If-Match is required header for update"))
-		return
-	}
+func (i *ItemsHandler) dispatch(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodGet && ItemsEndpointRegex.MatchString(r.URL.Path):
+		i.e.GetAllItems(w, r)
 
-	matches := ItemsWithIDEndpointRegex.FindStringSubmatch(r.RequestURI)
-	idToUpdate, _ := uuid.Parse(matches[1])
+	case r.Method == http.MethodGet && r.URL.Path == ItemEventsPath:
+		i.e.ItemEvents(w, r)
 
-	var itemToUpdate lib.Item
+	case r.Method == http.MethodGet && r.URL.Path == ItemSocketPath:
+		i.e.ItemSocket(w, r)
 
-	if err := json.NewDecoder(r.Body).Decode(&itemToUpdate); err != nil {
-		web.ErrorResponse(http.StatusBadRequest, w, r, err)
-		return
-	}
+	case r.Method == http.MethodGet:
+		i.e.GetItemById(w, r)
 
-	itemToUpdate.Id = idToUpdate
+	case r.Method == http.MethodPost:
+		i.e.CreateItem(w, r)
 
-	updatedItem, err := h.d.UpdateItem(itemToUpdate, ifMatch)
+	case r.Method == http.MethodDelete:
+		i.e.DeleteItemById(w, r)
 
-	if err != nil {
-		web.ErrorResponse(http.StatusInternalServerError, w, r, err)
-	} else {
-		web.SuccessResponse(http.StatusOK, w, r, updatedItem)
+	case r.Method == http.MethodPut:
+		i.e.UpdateItem(w, r)
 	}
 }
 
-func (h *ItemsHandler) getAllItem(w http.ResponseWriter, r *http.Request) {
-	items, err := h.d.GetAllItems()
-	if err != nil {
-		web.ErrorResponse(http.StatusInternalServerError, w, r, err)
-	} else {
-		web.SuccessResponse(http.StatusOK, w, r, items)
+// RouteMethods returns the methods served on path, nil when nothing is routed there
+func RouteMethods(path string) []string {
+	// Explicitly routing request based on method and url pattern :(
+	switch {
+	case ItemsEndpointRegex.MatchString(path):
+		return itemsMethods
+	case ItemsWithIDEndpointRegex.MatchString(path):
+		return itemsWithIDMethods
+	default:
+		return nil
 	}
-
 }
 
-func (h *ItemsHandler) deleteItem(w http.ResponseWriter, r *http.Request) {
-	matches := ItemsWithIDEndpointRegex.FindStringSubmatch(r.RequestURI)
-	idToDelete, _ := uuid.Parse(matches[1])
-	if err := h.d.DeleteItemById(idToDelete); err != nil {
-		web.ErrorResponse(http.StatusInternalServerError, w, r, err)
-	} else {
-		web.SuccessResponse(http.StatusNoContent, w, r, nil)
+// pathId returns the id captured by ItemsWithIDEndpointRegex
+func pathId(r *http.Request) string {
+	matches := ItemsWithIDEndpointRegex.FindStringSubmatch(r.URL.Path)
+	if matches == nil {
+		return ""
 	}
+	return matches[1] // 0: full string, 1: sub string matched
 }
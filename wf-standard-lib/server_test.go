@@ -7,16 +7,18 @@ import (
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/vivekmv23/go-web-frameworks/database"
 )
 
 var (
-	error_generic   error              = fmt.Errorf("generic error")
-	error_not_found *database.NotFound = &database.NotFound{Id: "some-id"}
-	error_outdated  *database.Outdated = &database.Outdated{}
-	error_conflict  *database.Conflict = &database.Conflict{}
+	error_generic     error                 = fmt.Errorf("generic error")
+	error_not_found   *database.NotFound    = &database.NotFound{Id: "some-id"}
+	error_outdated    *database.Outdated    = &database.Outdated{}
+	error_conflict    *database.Conflict    = &database.Conflict{}
+	error_unavailable *database.Unavailable = &database.Unavailable{Err: fmt.Errorf("circuit open"), RetryAfter: 1500 * time.Millisecond}
 )
 
 func readTestData(t *testing.T, name string) []byte {
@@ -87,6 +89,16 @@ func TestServer_GetById(t *testing.T) {
 	defer res.Body.Close()
 	assert.Equal(t, 404, res.StatusCode)
 	assert.NotEmpty(t, res.Body)
+
+	d = database.NewMockedDatabase(error_unavailable)
+	ih = NewItemsHandler(d)
+	w = httptest.NewRecorder()
+
+	ih.ServeHTTP(w, r)
+	res = w.Result()
+	defer res.Body.Close()
+	assert.Equal(t, 503, res.StatusCode)
+	assert.Equal(t, "2", res.Header.Get("Retry-After"))
 }
 
 func TestServer_GetById_Unauthorized(t *testing.T) {